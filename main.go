@@ -43,7 +43,7 @@ func main() {
 	r.Use(middleware.CORSMiddleware())
 	r.Use(middleware.SecurityHeadersMiddleware())
 	r.Use(middleware.RequestIDMiddleware())
-	r.Use(middleware.RateLimitMiddleware(10, 100)) // 10 requests per second, burst of 100
+	r.Use(middleware.RateLimitMiddleware(10, 100, "/events", "/ws")) // 10 requests per second, burst of 100; event streams and sockets cap themselves per user
 
 	// Initialize Swagger docs
 	docs.SwaggerInfo.Title = "Todo List API"
@@ -56,6 +56,10 @@ func main() {
 	// Connect Database
 	models.ConnectDatabase()
 
+	// Archive old completed tasks in the background
+	models.StartArchiver(models.DB)
+	models.StartNotifier(models.DB)
+
 	// Index for Testing
 	// @Summary Health check endpoint
 	// @Description Returns a simple health check response
@@ -79,6 +83,9 @@ func main() {
 	// Legacy user creation (deprecated, use /auth/register)
 	r.POST("/createUser", models.CreateUser)
 
+	// Calendar feed, authenticated by the secret token in its URL
+	r.GET("/calendar/:token/tasks.ics", models.GetCalendarFeed)
+
 	// Protected routes - require authentication
 	protected := r.Group("/")
 	protected.Use(middleware.AuthMiddleware())
@@ -90,11 +97,112 @@ func main() {
 		// Tasks
 		protected.GET("/tasks", models.GetAllTasks)
 		protected.POST("/tasks", models.CreateTask)
+		protected.GET("/tasks/export.csv", models.ExportTasksCSV)
+		protected.POST("/tasks/import.csv", models.ImportTasksCSV)
+		protected.GET("/tasks/export.txt", models.ExportTasksTodoTxt)
+		protected.POST("/tasks/import.txt", models.ImportTasksTodoTxt)
+		protected.GET("/tasks/export.md", models.ExportTasksMarkdown)
+		protected.POST("/tasks/import.md", models.ImportTasksMarkdown)
 		protected.GET("/tasks/:id", models.GetTaskByID)
 		protected.PUT("/tasks/:id", models.UpdateTask)
 		protected.DELETE("/tasks/:id", models.DeleteTask)
 		protected.PUT("/tasks/:id/complete", models.CompleteTask)
+		protected.POST("/tasks/:id/duplicate", models.DuplicateTask)
+		protected.POST("/tasks/:id/archive", models.ArchiveTask)
+		protected.POST("/tasks/:id/unarchive", models.UnarchiveTask)
+		protected.POST("/tasks/:id/snooze", models.SnoozeTask)
+		protected.POST("/tasks/:id/unsnooze", models.UnsnoozeTask)
+		protected.GET("/tasks/:id/dependencies", models.GetTaskDependencies)
+		protected.POST("/tasks/:id/dependencies", models.AddTaskDependency)
+		protected.DELETE("/tasks/:id/dependencies/:blockerId", models.RemoveTaskDependency)
+		protected.GET("/tasks/:id/links", models.GetTaskLinks)
+		protected.POST("/tasks/:id/links", models.LinkTask)
+		protected.DELETE("/tasks/:id/links/:linkId", models.UnlinkTask)
+		protected.GET("/tasks/:id/watchers", models.GetTaskWatchers)
+		protected.POST("/tasks/:id/watch", models.WatchTask)
+		protected.DELETE("/tasks/:id/watch", models.UnwatchTask)
 		protected.GET("/users/:id/tasks", models.GetTasksByUser)
+
+		// Comments
+		protected.GET("/tasks/:id/comments", models.GetTaskComments)
+		protected.POST("/tasks/:id/comments", models.CreateComment)
+
+		// Checklists and attachments
+		protected.GET("/tasks/:id/checklist", models.GetChecklist)
+		protected.POST("/tasks/:id/checklist", models.CreateChecklistItem)
+		protected.PUT("/tasks/:id/checklist/:itemId", models.UpdateChecklistItem)
+		protected.GET("/tasks/:id/attachments", models.GetAttachments)
+		protected.POST("/tasks/:id/attachments", models.CreateAttachment)
+
+		// Search
+		protected.GET("/search", models.Search)
+
+		// Statistics
+		protected.GET("/stats", models.GetStats)
+		protected.GET("/stats/flow", models.GetTaskFlow)
+
+		// Views
+		protected.GET("/views/matrix", models.GetMatrixView)
+		protected.GET("/views/inbox", models.GetInboxView)
+
+		// Projects and custom fields
+		protected.GET("/projects", models.GetProjects)
+		protected.POST("/projects", models.CreateProject)
+		protected.GET("/projects/:id", models.GetProjectByID)
+		protected.POST("/projects/:id/fields", middleware.RequireRole("admin"), models.CreateCustomField)
+		protected.DELETE("/projects/:id/fields/:fieldId", middleware.RequireRole("admin"), models.DeleteCustomField)
+		protected.GET("/fields", models.GetWorkspaceFields)
+		protected.POST("/fields", middleware.RequireRole("admin"), models.CreateWorkspaceField)
+		protected.DELETE("/fields/:fieldId", middleware.RequireRole("admin"), models.DeleteWorkspaceField)
+
+		// Templates
+		protected.GET("/templates", models.GetTemplates)
+		protected.POST("/templates", models.CreateTemplate)
+		protected.GET("/templates/:id", models.GetTemplateByID)
+		protected.DELETE("/templates/:id", models.DeleteTemplate)
+		protected.POST("/templates/:id/instantiate", models.InstantiateTemplate)
+
+		// Notifications
+		protected.GET("/notifications", models.GetNotifications)
+		protected.GET("/notifications/unread-count", models.GetUnreadNotificationCount)
+		protected.POST("/notifications/read-all", models.MarkAllNotificationsRead)
+		protected.POST("/notifications/:id/read", models.MarkNotificationRead)
+
+		// Settings
+		protected.GET("/settings", models.GetSettings)
+		protected.PUT("/settings", models.UpdateSettings)
+
+		// Calendar feed tokens
+		protected.POST("/calendar/token", models.CreateCalendarToken)
+		protected.DELETE("/calendar/token", models.RevokeCalendarToken)
+
+		// Import
+		protected.POST("/import/ical", models.ImportICal)
+		protected.POST("/import/todoist", models.ImportTodoist)
+		protected.POST("/import/trello", models.ImportTrello)
+
+		// App passwords for CalDAV clients
+		protected.GET("/app-passwords", models.GetAppPasswords)
+		protected.POST("/app-passwords", models.CreateAppPassword)
+		protected.DELETE("/app-passwords/:id", models.DeleteAppPassword)
+
+		// Task events
+		protected.GET("/events", models.StreamEvents)
+		protected.GET("/ws", models.Socket)
+
+		// Account export and import
+		protected.POST("/account/export", models.RequestAccountExport)
+		protected.GET("/account/export/:id", models.GetAccountExport)
+		protected.GET("/account/export/:id/download", models.DownloadAccountExport)
+		protected.POST("/account/import", models.ImportAccount)
+	}
+
+	// CalDAV, authenticated with app passwords
+	r.GET("/.well-known/caldav", models.CalDAVWellKnown)
+	r.Handle("PROPFIND", "/.well-known/caldav", models.CalDAVWellKnown)
+	dav := r.Group("/dav", models.AppPasswordAuth("Tasks"))
+	for _, method := range models.CalDAVMethods {
+		dav.Handle(method, "/*path", models.CalDAV)
 	}
 
 	r.Run()
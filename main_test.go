@@ -1,14 +1,22 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/KingLeak95/todo-list-go/middleware"
 	"github.com/KingLeak95/todo-list-go/models"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -25,7 +33,7 @@ func testRouter(t *testing.T) *gin.Engine {
 	}
 
 	// Auto-migrate schemas
-	if err := db.AutoMigrate(&models.User{}, &models.Task{}); err != nil {
+	if err := models.Migrate(db); err != nil {
 		t.Fatalf("auto migrate failed: %v", err)
 	}
 
@@ -34,6 +42,8 @@ func testRouter(t *testing.T) *gin.Engine {
 
 	r := gin.New()
 	r.Use(gin.Recovery())
+	// Identify the caller when a token is sent, without requiring one
+	r.Use(middleware.OptionalAuth())
 
 	// Public authentication routes
 	r.POST("/auth/register", models.Register)
@@ -43,6 +53,9 @@ func testRouter(t *testing.T) *gin.Engine {
 	// Legacy user creation (deprecated, use /auth/register)
 	r.POST("/createUser", models.CreateUser)
 
+	// Calendar feed, authenticated by the secret token in its URL
+	r.GET("/calendar/:token/tasks.ics", models.GetCalendarFeed)
+
 	// Protected routes - require authentication
 	protected := r.Group("/")
 	// Note: In tests, we'll bypass auth middleware for simplicity
@@ -54,11 +67,112 @@ func testRouter(t *testing.T) *gin.Engine {
 		// Tasks
 		protected.GET("/tasks", models.GetAllTasks)
 		protected.POST("/tasks", models.CreateTask)
+		protected.GET("/tasks/export.csv", models.ExportTasksCSV)
+		protected.POST("/tasks/import.csv", models.ImportTasksCSV)
+		protected.GET("/tasks/export.txt", models.ExportTasksTodoTxt)
+		protected.POST("/tasks/import.txt", models.ImportTasksTodoTxt)
+		protected.GET("/tasks/export.md", models.ExportTasksMarkdown)
+		protected.POST("/tasks/import.md", models.ImportTasksMarkdown)
 		protected.GET("/tasks/:id", models.GetTaskByID)
 		protected.PUT("/tasks/:id", models.UpdateTask)
 		protected.DELETE("/tasks/:id", models.DeleteTask)
 		protected.PUT("/tasks/:id/complete", models.CompleteTask)
+		protected.POST("/tasks/:id/duplicate", models.DuplicateTask)
+		protected.POST("/tasks/:id/archive", models.ArchiveTask)
+		protected.POST("/tasks/:id/unarchive", models.UnarchiveTask)
+		protected.POST("/tasks/:id/snooze", models.SnoozeTask)
+		protected.POST("/tasks/:id/unsnooze", models.UnsnoozeTask)
+		protected.GET("/tasks/:id/dependencies", models.GetTaskDependencies)
+		protected.POST("/tasks/:id/dependencies", models.AddTaskDependency)
+		protected.DELETE("/tasks/:id/dependencies/:blockerId", models.RemoveTaskDependency)
+		protected.GET("/tasks/:id/links", models.GetTaskLinks)
+		protected.POST("/tasks/:id/links", models.LinkTask)
+		protected.DELETE("/tasks/:id/links/:linkId", models.UnlinkTask)
+		protected.GET("/tasks/:id/watchers", models.GetTaskWatchers)
+		protected.POST("/tasks/:id/watch", models.WatchTask)
+		protected.DELETE("/tasks/:id/watch", models.UnwatchTask)
 		protected.GET("/users/:id/tasks", models.GetTasksByUser)
+
+		// Comments
+		protected.GET("/tasks/:id/comments", models.GetTaskComments)
+		protected.POST("/tasks/:id/comments", models.CreateComment)
+
+		// Checklists and attachments
+		protected.GET("/tasks/:id/checklist", models.GetChecklist)
+		protected.POST("/tasks/:id/checklist", models.CreateChecklistItem)
+		protected.PUT("/tasks/:id/checklist/:itemId", models.UpdateChecklistItem)
+		protected.GET("/tasks/:id/attachments", models.GetAttachments)
+		protected.POST("/tasks/:id/attachments", models.CreateAttachment)
+
+		// Search
+		protected.GET("/search", models.Search)
+
+		// Statistics
+		protected.GET("/stats", models.GetStats)
+		protected.GET("/stats/flow", models.GetTaskFlow)
+
+		// Views
+		protected.GET("/views/matrix", models.GetMatrixView)
+		protected.GET("/views/inbox", models.GetInboxView)
+
+		// Projects and custom fields
+		protected.GET("/projects", models.GetProjects)
+		protected.POST("/projects", models.CreateProject)
+		protected.GET("/projects/:id", models.GetProjectByID)
+		protected.POST("/projects/:id/fields", middleware.RequireRole("admin"), models.CreateCustomField)
+		protected.DELETE("/projects/:id/fields/:fieldId", middleware.RequireRole("admin"), models.DeleteCustomField)
+		protected.GET("/fields", models.GetWorkspaceFields)
+		protected.POST("/fields", middleware.RequireRole("admin"), models.CreateWorkspaceField)
+		protected.DELETE("/fields/:fieldId", middleware.RequireRole("admin"), models.DeleteWorkspaceField)
+
+		// Templates
+		protected.GET("/templates", models.GetTemplates)
+		protected.POST("/templates", models.CreateTemplate)
+		protected.GET("/templates/:id", models.GetTemplateByID)
+		protected.DELETE("/templates/:id", models.DeleteTemplate)
+		protected.POST("/templates/:id/instantiate", models.InstantiateTemplate)
+
+		// Notifications
+		protected.GET("/notifications", models.GetNotifications)
+		protected.GET("/notifications/unread-count", models.GetUnreadNotificationCount)
+		protected.POST("/notifications/read-all", models.MarkAllNotificationsRead)
+		protected.POST("/notifications/:id/read", models.MarkNotificationRead)
+
+		// Settings
+		protected.GET("/settings", models.GetSettings)
+		protected.PUT("/settings", models.UpdateSettings)
+
+		// Calendar feed tokens
+		protected.POST("/calendar/token", models.CreateCalendarToken)
+		protected.DELETE("/calendar/token", models.RevokeCalendarToken)
+
+		// Import
+		protected.POST("/import/ical", models.ImportICal)
+		protected.POST("/import/todoist", models.ImportTodoist)
+		protected.POST("/import/trello", models.ImportTrello)
+
+		// App passwords for CalDAV clients
+		protected.GET("/app-passwords", models.GetAppPasswords)
+		protected.POST("/app-passwords", models.CreateAppPassword)
+		protected.DELETE("/app-passwords/:id", models.DeleteAppPassword)
+
+		// Task events
+		protected.GET("/events", models.StreamEvents)
+		protected.GET("/ws", models.Socket)
+
+		// Account export and import
+		protected.POST("/account/export", models.RequestAccountExport)
+		protected.GET("/account/export/:id", models.GetAccountExport)
+		protected.GET("/account/export/:id/download", models.DownloadAccountExport)
+		protected.POST("/account/import", models.ImportAccount)
+	}
+
+	// CalDAV, authenticated with app passwords
+	r.GET("/.well-known/caldav", models.CalDAVWellKnown)
+	r.Handle("PROPFIND", "/.well-known/caldav", models.CalDAVWellKnown)
+	dav := r.Group("/dav", models.AppPasswordAuth("Tasks"))
+	for _, method := range models.CalDAVMethods {
+		dav.Handle(method, "/*path", models.CalDAV)
 	}
 
 	return r
@@ -194,3 +308,2416 @@ func TestTaskLifecycle(t *testing.T) {
 		t.Fatalf("delete task expected 200, got %d, body=%s", w.Code, w.Body.String())
 	}
 }
+
+func TestTaskFilterExpression(t *testing.T) {
+	r := testRouter(t)
+
+	w := doJSONRequest(t, r, http.MethodPost, "/auth/register", map[string]interface{}{
+		"name":     "Filter User",
+		"email":    "filter@example.com",
+		"password": "password123",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register user expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	for _, payload := range []map[string]interface{}{
+		{"task": "Write report", "priority": "high", "category": "work", "userId": 1},
+		{"task": "Book dentist", "priority": "high", "category": "home", "userId": 1},
+		{"task": "Tidy desk", "priority": "low", "category": "work", "userId": 1},
+	} {
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks", payload); w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d, body=%s", w.Code, w.Body.String())
+		}
+	}
+
+	w = doJSONRequest(t, r, http.MethodGet, "/tasks?q=priority:high%20AND%20(category:work%20OR%20task:dentist)", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("filter tasks expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []models.Task `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(resp.Data) != 2 {
+		t.Fatalf("expected 2 tasks, got %d", len(resp.Data))
+	}
+
+	w = doJSONRequest(t, r, http.MethodGet, "/tasks?q=priority:urgent", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid filter expected 400, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var errResp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("failed to parse error response: %v", err)
+	}
+	if errResp["position"] != float64(9) {
+		t.Fatalf("expected error position 9, got %v", errResp["position"])
+	}
+}
+
+func TestSearchTasksAndComments(t *testing.T) {
+	r := testRouter(t)
+
+	w := doJSONRequest(t, r, http.MethodPost, "/auth/register", map[string]interface{}{
+		"name":     "Search User",
+		"email":    "search@example.com",
+		"password": "password123",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register user expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	for _, payload := range []map[string]interface{}{
+		{"task": "Invoice customer", "description": "Send the quarterly invoice", "priority": "high", "userId": 1},
+		{"task": "Call accountant", "description": "Ask about the invoice template", "priority": "low", "userId": 1},
+		{"task": "Water plants", "priority": "high", "userId": 1},
+	} {
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks", payload); w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d, body=%s", w.Code, w.Body.String())
+		}
+	}
+	w = doJSONRequest(t, r, http.MethodPost, "/tasks/3/comments", map[string]interface{}{"body": "Remember the invoice for the plant service"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create comment expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	w = doJSONRequest(t, r, http.MethodGet, "/search?q=invoice", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("search expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var searchResp struct {
+		Data []models.SearchHit `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &searchResp); err != nil {
+		t.Fatalf("failed to parse search response: %v", err)
+	}
+	if len(searchResp.Data) != 3 {
+		t.Fatalf("expected 3 hits, got %d: %s", len(searchResp.Data), w.Body.String())
+	}
+	if searchResp.Data[0].TaskID != 1 {
+		t.Fatalf("expected title match to rank first, got task %d", searchResp.Data[0].TaskID)
+	}
+	for _, hit := range searchResp.Data {
+		if !bytes.Contains([]byte(hit.Snippet), []byte("<mark>")) {
+			t.Fatalf("expected highlighted snippet, got %q", hit.Snippet)
+		}
+	}
+
+	// Snippets are HTML, so the text around the highlights is escaped
+	if w := doJSONRequest(t, r, http.MethodPost, "/tasks", map[string]interface{}{"task": `<script>alert(1)</script> payroll`, "description": `<img src=x onerror="alert(2)">`, "userId": 1}); w.Code != http.StatusCreated {
+		t.Fatalf("create task expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	w = doJSONRequest(t, r, http.MethodGet, "/search?q=payroll", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &searchResp); err != nil || len(searchResp.Data) != 1 {
+		t.Fatalf("expected one payroll hit, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if snippet := searchResp.Data[0].Snippet; strings.Contains(snippet, "<script>") || strings.Contains(snippet, "<img") ||
+		!strings.Contains(snippet, "&lt;script&gt;") || !strings.Contains(snippet, "<mark>payroll</mark>") {
+		t.Fatalf("expected an escaped snippet with the match marked, got %q", snippet)
+	}
+
+	// The search filter must not swallow other conditions
+	w = doJSONRequest(t, r, http.MethodGet, "/tasks?search=invoice&priority=high", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list tasks expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var listResp struct {
+		Data []models.Task `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listResp); err != nil {
+		t.Fatalf("failed to parse list response: %v", err)
+	}
+	if len(listResp.Data) != 1 || listResp.Data[0].ID != 1 {
+		t.Fatalf("expected only task 1, got %+v", listResp.Data)
+	}
+}
+
+type taskPage struct {
+	Data       []models.Task `json:"data"`
+	Pagination struct {
+		NextCursor string `json:"nextCursor"`
+		PrevCursor string `json:"prevCursor"`
+		HasNext    bool   `json:"hasNext"`
+	} `json:"pagination"`
+}
+
+func getTaskPage(t *testing.T, r http.Handler, path string) taskPage {
+	t.Helper()
+	w := doJSONRequest(t, r, http.MethodGet, path, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s expected 200, got %d, body=%s", path, w.Code, w.Body.String())
+	}
+	var page taskPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("failed to parse page: %v", err)
+	}
+	return page
+}
+
+func TestTaskCursorPagination(t *testing.T) {
+	r := testRouter(t)
+
+	w := doJSONRequest(t, r, http.MethodPost, "/auth/register", map[string]interface{}{
+		"name":     "Cursor User",
+		"email":    "cursor@example.com",
+		"password": "password123",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register user expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	// Seven tasks sharing due dates, some without one, to exercise ties and nulls
+	dueDates := []string{"2024-05-02T00:00:00Z", "", "2024-05-01T00:00:00Z", "2024-05-02T00:00:00Z", "", "2024-05-03T00:00:00Z", "2024-05-01T00:00:00Z"}
+	for i, due := range dueDates {
+		payload := map[string]interface{}{"task": "Task " + string(rune('A'+i)), "userId": 1}
+		if due != "" {
+			payload["dueDate"] = due
+		}
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks", payload); w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d, body=%s", w.Code, w.Body.String())
+		}
+	}
+
+	seen := map[uint]bool{}
+	var order []uint
+	page := getTaskPage(t, r, "/tasks?sortBy=due_date&sortOrder=asc&limit=3")
+	for {
+		for _, task := range page.Data {
+			if seen[task.ID] {
+				t.Fatalf("task %d returned twice", task.ID)
+			}
+			seen[task.ID] = true
+			order = append(order, task.ID)
+		}
+		if page.Pagination.NextCursor == "" {
+			break
+		}
+		if len(order) == 3 {
+			// A task inserted mid-scroll must not shift later pages
+			doJSONRequest(t, r, http.MethodPost, "/tasks", map[string]interface{}{"task": "Early", "dueDate": "2024-04-01T00:00:00Z", "userId": 1})
+		}
+		page = getTaskPage(t, r, "/tasks?sortBy=due_date&sortOrder=asc&limit=3&after="+page.Pagination.NextCursor)
+	}
+
+	want := []uint{3, 7, 1, 4, 6, 2, 5}
+	if len(order) != len(want) {
+		t.Fatalf("expected %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, order)
+		}
+	}
+
+	// Paging backwards from the last page returns the preceding rows
+	back := getTaskPage(t, r, "/tasks?sortBy=due_date&sortOrder=asc&limit=3&before="+page.Pagination.PrevCursor)
+	if len(back.Data) != 3 || back.Data[0].ID != 4 || back.Data[2].ID != 2 {
+		t.Fatalf("unexpected previous page: %+v", back.Data)
+	}
+
+	w = doJSONRequest(t, r, http.MethodGet, "/tasks?sortBy=created_at&after="+page.Pagination.PrevCursor, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("cursor for another sort expected 400, got %d", w.Code)
+	}
+}
+
+func TestTaskSparseFieldsetsAndIncludes(t *testing.T) {
+	r := testRouter(t)
+
+	w := doJSONRequest(t, r, http.MethodPost, "/auth/register", map[string]interface{}{
+		"name":     "View User",
+		"email":    "view@example.com",
+		"password": "password123",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register user expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	w = doJSONRequest(t, r, http.MethodPost, "/tasks", map[string]interface{}{
+		"task":   "Plan offsite",
+		"userId": 1,
+		"tags":   []string{"planning", "team"},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create task expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	doJSONRequest(t, r, http.MethodPost, "/tasks/1/comments", map[string]interface{}{"body": "Venue booked"})
+
+	// Without include, relations are omitted entirely
+	w = doJSONRequest(t, r, http.MethodGet, "/tasks/1", nil)
+	var full struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &full); err != nil {
+		t.Fatalf("failed to parse task: %v", err)
+	}
+	if _, ok := full.Data["user"]; ok {
+		t.Fatalf("expected no user without include, got %v", full.Data["user"])
+	}
+
+	w = doJSONRequest(t, r, http.MethodGet, "/tasks?fields=id,task&include=user,tags,comments", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list tasks expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var list struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to parse tasks: %v", err)
+	}
+	if len(list.Data) != 1 {
+		t.Fatalf("expected 1 task, got %d", len(list.Data))
+	}
+	item := list.Data[0]
+	if len(item) != 5 {
+		t.Fatalf("expected ID, task, user, tags and comments only, got %v", item)
+	}
+	if item["task"] != "Plan offsite" {
+		t.Fatalf("unexpected task name %v", item["task"])
+	}
+	if user, ok := item["user"].(map[string]interface{}); !ok || user["email"] != "view@example.com" {
+		t.Fatalf("expected embedded user, got %v", item["user"])
+	}
+	if tags, ok := item["tags"].([]interface{}); !ok || len(tags) != 2 {
+		t.Fatalf("expected 2 tags, got %v", item["tags"])
+	}
+	if comments, ok := item["comments"].([]interface{}); !ok || len(comments) != 1 {
+		t.Fatalf("expected 1 comment, got %v", item["comments"])
+	}
+
+	w = doJSONRequest(t, r, http.MethodGet, "/tasks/1?fields=owner", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown field expected 400, got %d", w.Code)
+	}
+}
+
+func TestTaskMultiColumnSort(t *testing.T) {
+	r := testRouter(t)
+
+	w := doJSONRequest(t, r, http.MethodPost, "/auth/register", map[string]interface{}{
+		"name":     "Sort User",
+		"email":    "sort@example.com",
+		"password": "password123",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register user expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	for _, payload := range []map[string]interface{}{
+		{"task": "A", "priority": "low", "dueDate": "2024-01-01T00:00:00Z", "userId": 1},
+		{"task": "B", "priority": "high", "userId": 1},
+		{"task": "C", "priority": "medium", "dueDate": "2024-01-05T00:00:00Z", "userId": 1},
+		{"task": "D", "priority": "high", "dueDate": "2024-01-03T00:00:00Z", "userId": 1},
+		{"task": "E", "priority": "high", "dueDate": "2024-01-02T00:00:00Z", "userId": 1},
+	} {
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks", payload); w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d, body=%s", w.Code, w.Body.String())
+		}
+	}
+
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"-priority,dueDate,created_at", "EDBCA"},
+		{"priority,-dueDate", "ACDEB"},
+		{"-dueDate", "CDEAB"},
+	}
+	for _, tt := range tests {
+		page := getTaskPage(t, r, "/tasks?sort="+tt.sort)
+		got := ""
+		for _, task := range page.Data {
+			got += task.Task
+		}
+		if got != tt.want {
+			t.Fatalf("sort=%s: expected %s, got %s", tt.sort, tt.want, got)
+		}
+	}
+
+	for _, path := range []string{
+		"/tasks?sort=name%3BDROP%20TABLE%20tasks",
+		"/tasks?sortBy=(SELECT%201)",
+		"/tasks?sort=priority,-priority",
+	} {
+		if w := doJSONRequest(t, r, http.MethodGet, path, nil); w.Code != http.StatusBadRequest {
+			t.Fatalf("GET %s expected 400, got %d", path, w.Code)
+		}
+	}
+}
+
+// registerUser registers a user and returns the Authorization headers for it
+func registerUser(t *testing.T, r http.Handler, name, email string) map[string]string {
+	t.Helper()
+	w := doJSONRequest(t, r, http.MethodPost, "/auth/register", map[string]interface{}{
+		"name":     name,
+		"email":    email,
+		"password": "password123",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register user expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			AccessToken string `json:"access_token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse register response: %v", err)
+	}
+	return map[string]string{"Authorization": "Bearer " + resp.Data.AccessToken}
+}
+
+func TestTemplateInstantiation(t *testing.T) {
+	r := testRouter(t)
+	headers := registerUser(t, r, "Template User", "template@example.com")
+
+	template := map[string]interface{}{
+		"name": "Client onboarding",
+		"items": []map[string]interface{}{
+			{
+				"task":          "Kickoff with {{client}}",
+				"priority":      "high",
+				"category":      "{{client}}",
+				"dueOffsetDays": 0,
+				"children": []map[string]interface{}{
+					{"task": "Send welcome pack to {{ contact }}", "dueOffsetDays": 2},
+				},
+			},
+			{"task": "First review", "dueOffsetDays": 14},
+		},
+	}
+	w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/templates", template, headers)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create template expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	w = doJSONRequestWithHeaders(t, r, http.MethodPost, "/templates/1/instantiate", map[string]interface{}{
+		"startDate": "2024-06-03",
+		"variables": map[string]string{"client": "Acme"},
+	}, headers)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("missing variable expected 400, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	w = doJSONRequestWithHeaders(t, r, http.MethodPost, "/templates/1/instantiate", map[string]interface{}{
+		"startDate": "2024-06-03",
+		"variables": map[string]string{"client": "Acme", "contact": "Jo"},
+	}, headers)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("instantiate expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []models.Task `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse tasks: %v", err)
+	}
+	if len(resp.Data) != 3 {
+		t.Fatalf("expected 3 tasks, got %d", len(resp.Data))
+	}
+	kickoff, welcome, review := resp.Data[0], resp.Data[1], resp.Data[2]
+	if kickoff.Task != "Kickoff with Acme" || kickoff.Category != "Acme" || kickoff.Priority != models.PriorityHigh {
+		t.Fatalf("unexpected kickoff task: %+v", kickoff)
+	}
+	if welcome.Task != "Send welcome pack to Jo" || welcome.ParentID == nil || *welcome.ParentID != kickoff.ID {
+		t.Fatalf("unexpected welcome task: %+v", welcome)
+	}
+	if welcome.DueDate == nil || welcome.DueDate.Format("2006-01-02") != "2024-06-05" {
+		t.Fatalf("expected welcome due 2024-06-05, got %v", welcome.DueDate)
+	}
+	if review.DueDate == nil || review.DueDate.Format("2006-01-02") != "2024-06-17" {
+		t.Fatalf("expected review due 2024-06-17, got %v", review.DueDate)
+	}
+
+	w = doJSONRequestWithHeaders(t, r, http.MethodPost, "/templates/1/instantiate", map[string]interface{}{
+		"variables": map[string]string{"client": strings.Repeat("A", 101), "contact": "Jo"},
+	}, headers)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("oversized variable expected 400, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	// Created tasks are watched by the caller and announced to the assignee
+	registerUser(t, r, "Assignee", "assignee@example.com")
+	w = doJSONRequestWithHeaders(t, r, http.MethodPost, "/templates/1/instantiate", map[string]interface{}{
+		"userId":    2,
+		"variables": map[string]string{"client": "Globex", "contact": "Sam"},
+	}, headers)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("instantiate for another user expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var watched, assigned int64
+	models.DB.Model(&models.TaskWatcher{}).Where("task_id = ? AND user_id = ?", resp.Data[0].ID, 1).Count(&watched)
+	models.DB.Model(&models.Notification{}).Where("user_id = ? AND type = ?", 2, models.NotificationAssigned).Count(&assigned)
+	if watched != 1 || assigned != 3 {
+		t.Fatalf("expected the caller to watch and the assignee to be notified, got %d watchers and %d notifications", watched, assigned)
+	}
+}
+
+func TestDuplicateTaskSubtree(t *testing.T) {
+	r := testRouter(t)
+	registerUser(t, r, "Clone User", "clone@example.com")
+
+	w := doJSONRequest(t, r, http.MethodPost, "/tasks", map[string]interface{}{
+		"task": "Quarterly close", "description": "Close the books", "category": "finance",
+		"priority": "high", "dueDate": "2024-03-31T00:00:00Z", "userId": 1, "tags": []string{"finance"},
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create task expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	doJSONRequest(t, r, http.MethodPut, "/tasks/1/complete", nil)
+	doJSONRequest(t, r, http.MethodPost, "/tasks/1/checklist", map[string]interface{}{"text": "Reconcile", "done": true})
+	doJSONRequest(t, r, http.MethodPost, "/tasks/1/attachments", map[string]interface{}{
+		"fileName": "ledger.xlsx", "size": 1024, "url": "https://files.example.com/ledger.xlsx",
+	})
+	subtask := map[string]interface{}{"task": "Collect receipts", "userId": 1}
+	if w := doJSONRequest(t, r, http.MethodPost, "/tasks", subtask); w.Code != http.StatusCreated {
+		t.Fatalf("create subtask expected 201, got %d", w.Code)
+	}
+	models.DB.Model(&models.Task{}).Where("id = ?", 2).Update("parent_id", 1)
+
+	w = doJSONRequest(t, r, http.MethodPost, "/tasks/1/duplicate", map[string]interface{}{
+		"subtasks":          true,
+		"category":          false,
+		"dueDateOffsetDays": 91,
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("duplicate expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data models.Task `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse duplicate: %v", err)
+	}
+	clone := resp.Data
+	if clone.ID == 1 || clone.Status != models.StatusPending || clone.Completed {
+		t.Fatalf("expected a new pending task, got %+v", clone)
+	}
+	if clone.Description != "Close the books" || clone.Category != "" || clone.Priority != models.PriorityHigh {
+		t.Fatalf("unexpected copied fields: %+v", clone)
+	}
+	if clone.DueDate == nil || clone.DueDate.Format("2006-01-02") != "2024-06-30" {
+		t.Fatalf("expected shifted due date 2024-06-30, got %v", clone.DueDate)
+	}
+	if len(clone.Tags) != 1 || len(clone.Checklist) != 1 || clone.Checklist[0].Done {
+		t.Fatalf("expected copied tag and unticked checklist, got %+v %+v", clone.Tags, clone.Checklist)
+	}
+	if len(clone.Attachments) != 1 || clone.Attachments[0].URL != "https://files.example.com/ledger.xlsx" {
+		t.Fatalf("expected attachment copied by reference, got %+v", clone.Attachments)
+	}
+	if len(clone.Subtasks) != 1 || clone.Subtasks[0].Task != "Collect receipts" || *clone.Subtasks[0].ParentID != clone.ID {
+		t.Fatalf("expected duplicated subtask, got %+v", clone.Subtasks)
+	}
+	var watchers int64
+	models.DB.Model(&models.TaskWatcher{}).Where("task_id IN ? AND user_id = ?", []uint{clone.ID, clone.Subtasks[0].ID}, 1).Count(&watchers)
+	if watchers != 2 {
+		t.Fatalf("expected the clones to be watched like new tasks, got %d watchers", watchers)
+	}
+
+	// A cycle of parents in stored data fails instead of recursing forever
+	models.DB.Model(&models.Task{}).Where("id = ?", 1).Update("parent_id", 2)
+	if w := doJSONRequest(t, r, http.MethodPost, "/tasks/1/duplicate", map[string]interface{}{"subtasks": true}); w.Code != http.StatusInternalServerError {
+		t.Fatalf("duplicating a cyclic subtree expected 500, got %d", w.Code)
+	}
+}
+
+func TestArchiveCompletedTasks(t *testing.T) {
+	r := testRouter(t)
+	registerUser(t, r, "Archive User", "archive@example.com")
+	keeper := registerUser(t, r, "Keeper User", "keeper@example.com")
+
+	w := doJSONRequestWithHeaders(t, r, http.MethodPut, "/settings", map[string]interface{}{"archiveAfterDays": 0}, keeper)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update settings expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	for _, task := range []map[string]interface{}{
+		{"task": "Old done", "userId": 1},
+		{"task": "Kept done", "userId": 2},
+		{"task": "Still open", "userId": 1},
+		{"task": "Recently done", "userId": 1},
+	} {
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks", task); w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d", w.Code)
+		}
+	}
+	for _, id := range []string{"1", "2", "4"} {
+		doJSONRequest(t, r, http.MethodPut, "/tasks/"+id+"/complete", nil)
+	}
+	old := time.Now().AddDate(0, 0, -40)
+	models.DB.Model(&models.Task{}).Where("id IN ?", []int{1, 2, 3}).
+		UpdateColumns(map[string]interface{}{"completed_at": old, "updated_at": old})
+
+	archived, err := models.ArchiveCompletedTasks(models.DB, time.Now())
+	if err != nil || archived != 1 {
+		t.Fatalf("expected 1 archived task, got %d (%v)", archived, err)
+	}
+	if page := getTaskPage(t, r, "/tasks?sort=id"); len(page.Data) != 3 || page.Data[0].ID != 2 {
+		t.Fatalf("expected archived task hidden, got %+v", page.Data)
+	}
+	page := getTaskPage(t, r, "/tasks?sort=id&archived=true")
+	if len(page.Data) != 4 || page.Data[0].ArchivedAt == nil {
+		t.Fatalf("expected archived task with archived=true, got %+v", page.Data)
+	}
+
+	if w := doJSONRequest(t, r, http.MethodPost, "/tasks/1/unarchive", nil); w.Code != http.StatusOK {
+		t.Fatalf("unarchive expected 200, got %d", w.Code)
+	}
+	if archived, _ := models.ArchiveCompletedTasks(models.DB, time.Now()); archived != 0 {
+		t.Fatalf("expected unarchived task to stay visible, archived %d", archived)
+	}
+	if page := getTaskPage(t, r, "/tasks"); len(page.Data) != 4 {
+		t.Fatalf("expected 4 visible tasks after unarchive, got %d", len(page.Data))
+	}
+}
+
+func TestStats(t *testing.T) {
+	r := testRouter(t)
+	headers := registerUser(t, r, "Stats User", "stats@example.com")
+	registerUser(t, r, "Other User", "other@example.com")
+
+	for _, task := range []map[string]interface{}{
+		{"task": "Write report", "priority": "high", "category": "work", "userId": 1, "dueDate": "2024-06-02T00:00:00Z"},
+		{"task": "Review report", "priority": "high", "category": "work", "userId": 1},
+		{"task": "Buy milk", "priority": "low", "category": "home", "userId": 1, "dueDate": "2024-06-01T00:00:00Z"},
+		{"task": "Not mine", "userId": 2},
+	} {
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks", task); w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d", w.Code)
+		}
+	}
+	day := func(d, h int) time.Time { return time.Date(2024, 6, d, h, 0, 0, 0, time.UTC) }
+	backdate := func(id int, values map[string]interface{}) {
+		models.DB.Model(&models.Task{}).Where("id = ?", id).UpdateColumns(values)
+	}
+	backdate(1, map[string]interface{}{"created_at": day(1, 9), "status": "completed", "completed_at": day(3, 9), "updated_at": day(3, 9)})
+	backdate(2, map[string]interface{}{"created_at": day(1, 10), "status": "completed", "completed_at": day(1, 14), "updated_at": day(1, 14)})
+	backdate(3, map[string]interface{}{"created_at": day(2, 8)})
+	backdate(4, map[string]interface{}{"created_at": day(2, 8)})
+
+	w := doJSONRequestWithHeaders(t, r, http.MethodGet, "/stats?from=2024-06-01&to=2024-06-03", nil, headers)
+	if w.Code != http.StatusOK {
+		t.Fatalf("stats expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data models.TaskStats `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse stats: %v", err)
+	}
+	stats := resp.Data
+	if stats.Created != 3 || stats.Completed != 2 || len(stats.Daily) != 3 {
+		t.Fatalf("unexpected totals: %+v", stats)
+	}
+	if stats.Daily[0].Created != 2 || stats.Daily[0].Completed != 1 || stats.Daily[2].Completed != 1 {
+		t.Fatalf("unexpected daily counts: %+v", stats.Daily)
+	}
+	if stats.MedianHoursToComplete == nil {
+		t.Fatal("expected a median time to complete")
+	}
+	if *stats.MedianHoursToComplete != 26 {
+		t.Fatalf("expected median of 4h and 48h to be 26h, got %v", *stats.MedianHoursToComplete)
+	}
+	if stats.Overdue.Open != 1 || stats.Overdue.CompletedLate != 1 {
+		t.Fatalf("unexpected overdue counts: %+v", stats.Overdue)
+	}
+	if stats.ByPriority["high"] != 2 || stats.ByCategory["home"] != 1 || stats.ByStatus["completed"] != 2 {
+		t.Fatalf("unexpected breakdowns: %+v %+v %+v", stats.ByPriority, stats.ByCategory, stats.ByStatus)
+	}
+
+	w = doJSONRequestWithHeaders(t, r, http.MethodGet, "/stats?userId=2", nil, headers)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin stats for another user expected 403, got %d", w.Code)
+	}
+}
+
+func TestTaskFlow(t *testing.T) {
+	r := testRouter(t)
+	registerUser(t, r, "Flow User", "flow@example.com")
+
+	for _, task := range []map[string]interface{}{
+		{"task": "Design", "priority": "high", "userId": 1},
+		{"task": "Build", "priority": "high", "userId": 1},
+		{"task": "Ship", "priority": "high", "userId": 1},
+		{"task": "Unrelated", "priority": "low", "userId": 1},
+	} {
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks", task); w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d", w.Code)
+		}
+	}
+	// Replay a sprint: created on June 1st, completed on the 2nd and 3rd
+	day := func(d int) time.Time { return time.Date(2024, 6, d, 12, 0, 0, 0, time.UTC) }
+	models.DB.Model(&models.TaskStatusChange{}).Where("from_status = ''").Update("changed_at", day(1))
+	doJSONRequest(t, r, http.MethodPut, "/tasks/1/complete", nil)
+	doJSONRequest(t, r, http.MethodPut, "/tasks/2", map[string]interface{}{"status": "cancelled"})
+	doJSONRequest(t, r, http.MethodPut, "/tasks/4/complete", nil)
+	models.DB.Model(&models.TaskStatusChange{}).Where("task_id = 1 AND from_status <> ''").Update("changed_at", day(2))
+	models.DB.Model(&models.TaskStatusChange{}).Where("task_id IN (2, 4) AND from_status <> ''").Update("changed_at", day(3))
+
+	w := doJSONRequest(t, r, http.MethodGet, "/stats/flow?from=2024-05-31&to=2024-06-03&priority=high", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("flow expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data models.TaskFlow `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse flow: %v", err)
+	}
+	var open []int64
+	for _, d := range resp.Data.Days {
+		open = append(open, d.Open)
+	}
+	if len(open) != 4 || open[0] != 0 || open[1] != 3 || open[2] != 2 || open[3] != 1 {
+		t.Fatalf("expected open counts [0 3 2 1], got %v", open)
+	}
+	last := resp.Data.Days[3].ByStatus
+	if last["completed"] != 1 || last["cancelled"] != 1 || last["pending"] != 1 {
+		t.Fatalf("unexpected final statuses: %+v", last)
+	}
+}
+
+func TestUrgencySortAndMatrix(t *testing.T) {
+	r := testRouter(t)
+	registerUser(t, r, "Urgent User", "urgent@example.com")
+
+	yesterday := time.Now().Add(-24 * time.Hour).Format(time.RFC3339)
+	tomorrow := time.Now().Add(24 * time.Hour).Format(time.RFC3339)
+	for _, task := range []map[string]interface{}{
+		{"task": "Overdue report", "priority": "high", "dueDate": yesterday, "userId": 1},
+		{"task": "Plan next year", "priority": "high", "userId": 1},
+		{"task": "Answer email", "priority": "low", "dueDate": tomorrow, "userId": 1},
+		{"task": "Tidy desk", "priority": "medium", "userId": 1},
+		{"task": "Launch", "priority": "high", "dueDate": tomorrow, "userId": 1},
+	} {
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks", task); w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d", w.Code)
+		}
+	}
+	if w := doJSONRequest(t, r, http.MethodPost, "/tasks/5/dependencies", map[string]interface{}{"blockedById": 4}); w.Code != http.StatusCreated {
+		t.Fatalf("add dependency expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSONRequest(t, r, http.MethodPost, "/tasks/4/dependencies", map[string]interface{}{"blockedById": 5}); w.Code != http.StatusBadRequest {
+		t.Fatalf("cyclic dependency expected 400, got %d", w.Code)
+	}
+
+	ids := func(tasks []models.Task) []uint {
+		var out []uint
+		for _, task := range tasks {
+			out = append(out, task.ID)
+		}
+		return out
+	}
+	page := getTaskPage(t, r, "/tasks?sort=-urgency&limit=2")
+	order := ids(page.Data)
+	page = getTaskPage(t, r, "/tasks?sort=-urgency&limit=3&after="+page.Pagination.NextCursor)
+	order = append(order, ids(page.Data)...)
+	if fmt.Sprint(order) != "[1 3 5 2 4]" {
+		t.Fatalf("expected urgency order [1 3 5 2 4], got %v", order)
+	}
+	if page.Data[0].Blocked == nil || !*page.Data[0].Blocked || page.Data[0].Urgency == nil {
+		t.Fatalf("expected task 5 to be blocked with an urgency score, got %+v", page.Data[0])
+	}
+	if blocked := getTaskPage(t, r, "/tasks?q=blocked:true"); fmt.Sprint(ids(blocked.Data)) != "[5]" {
+		t.Fatalf("expected only task 5 blocked, got %v", ids(blocked.Data))
+	}
+
+	w := doJSONRequest(t, r, http.MethodGet, "/views/matrix", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("matrix expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data map[string]struct {
+			Tasks []models.Task `json:"tasks"`
+			Total int64         `json:"total"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse matrix: %v", err)
+	}
+	expected := map[string]string{"do": "[1 5]", "schedule": "[2]", "delegate": "[3]", "eliminate": "[4]"}
+	for quadrant, want := range expected {
+		if got := fmt.Sprint(ids(resp.Data[quadrant].Tasks)); got != want {
+			t.Fatalf("quadrant %s: expected %s, got %s", quadrant, want, got)
+		}
+	}
+}
+
+func TestSnoozeAndInbox(t *testing.T) {
+	r := testRouter(t)
+	headers := registerUser(t, r, "Inbox User", "inbox@example.com")
+
+	for _, task := range []map[string]interface{}{
+		{"task": "Untriaged idea", "userId": 1},
+		{"task": "Filed task", "category": "work", "userId": 1},
+		{"task": "Later task", "category": "work", "userId": 1},
+	} {
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks", task); w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d", w.Code)
+		}
+	}
+	if w := doJSONRequest(t, r, http.MethodPost, "/tasks/3/snooze", map[string]interface{}{"preset": "someday"}); w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown preset expected 400, got %d", w.Code)
+	}
+	if w := doJSONRequest(t, r, http.MethodPost, "/tasks/3/snooze", map[string]interface{}{"preset": "tomorrow"}); w.Code != http.StatusOK {
+		t.Fatalf("snooze expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	if page := getTaskPage(t, r, "/tasks?sort=id"); len(page.Data) != 2 {
+		t.Fatalf("expected snoozed task hidden, got %d tasks", len(page.Data))
+	}
+	if page := getTaskPage(t, r, "/tasks?sort=id&deferred=true"); len(page.Data) != 3 {
+		t.Fatalf("expected snoozed task with deferred=true, got %d tasks", len(page.Data))
+	}
+
+	inbox := func() string {
+		t.Helper()
+		w := doJSONRequestWithHeaders(t, r, http.MethodGet, "/views/inbox", nil, headers)
+		if w.Code != http.StatusOK {
+			t.Fatalf("inbox expected 200, got %d, body=%s", w.Code, w.Body.String())
+		}
+		var page taskPage
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatalf("failed to parse inbox: %v", err)
+		}
+		var ids []uint
+		for _, task := range page.Data {
+			ids = append(ids, task.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+	if got := inbox(); got != "[1]" {
+		t.Fatalf("expected inbox [1], got %s", got)
+	}
+
+	// Once the defer time passes the task resurfaces at the top of the inbox
+	models.DB.Model(&models.Task{}).Where("id = ?", 3).UpdateColumn("defer_until", time.Now().Add(-time.Minute))
+	if got := inbox(); got != "[3 1]" {
+		t.Fatalf("expected resurfaced task first, got %s", got)
+	}
+	doJSONRequest(t, r, http.MethodPost, "/tasks/3/unsnooze", nil)
+	if got := inbox(); got != "[1]" {
+		t.Fatalf("expected unsnoozed task to leave the inbox, got %s", got)
+	}
+}
+
+func TestProjectCustomFields(t *testing.T) {
+	r := testRouter(t)
+	headers := registerUser(t, r, "Field Admin", "fields@example.com")
+
+	w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/projects", map[string]interface{}{"name": "Bugs"}, headers)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create project expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	field := map[string]interface{}{"key": "points", "name": "Story points", "type": "number"}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/projects/1/fields", field, headers); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin field definition expected 403, got %d", w.Code)
+	}
+
+	// Tokens carry the role, so promote the user and register a fresh session
+	models.DB.Model(&models.User{}).Where("id = ?", 1).Update("role", "admin")
+	w = doJSONRequest(t, r, http.MethodPost, "/auth/login", map[string]interface{}{"email": "fields@example.com", "password": "password123"})
+	var login struct {
+		Data struct {
+			AccessToken string `json:"access_token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &login); err != nil {
+		t.Fatalf("failed to parse login response: %v", err)
+	}
+	admin := map[string]string{"Authorization": "Bearer " + login.Data.AccessToken}
+
+	for _, field := range []map[string]interface{}{
+		{"key": "points", "name": "Story points", "type": "number", "required": true},
+		{"key": "labels", "name": "Labels", "type": "multiselect", "options": []string{"bug", "ui", "api"}},
+		{"key": "start", "name": "Start", "type": "date"},
+	} {
+		if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/projects/1/fields", field, admin); w.Code != http.StatusCreated {
+			t.Fatalf("create field expected 201, got %d, body=%s", w.Code, w.Body.String())
+		}
+	}
+	invalid := map[string]interface{}{"key": "Bad Key", "name": "Bad", "type": "text"}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/projects/1/fields", invalid, admin); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid key expected 400, got %d", w.Code)
+	}
+
+	for _, values := range []map[string]interface{}{
+		{"labels": []string{"bug"}},
+		{"points": "many"},
+		{"points": 2, "labels": []string{"docs"}},
+		{"points": 2, "unknown": true},
+	} {
+		task := map[string]interface{}{"task": "Invalid", "userId": 1, "projectId": 1, "customFields": values}
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks", task); w.Code != http.StatusBadRequest {
+			t.Fatalf("custom fields %v expected 400, got %d", values, w.Code)
+		}
+	}
+	for _, values := range []map[string]interface{}{
+		{"points": 2, "labels": []string{"bug"}, "start": "2026-03-01"},
+		{"points": 5, "labels": []string{"ui", "api"}, "start": "2026-04-01"},
+		{"points": 8},
+	} {
+		task := map[string]interface{}{"task": "Ticket", "userId": 1, "projectId": 1, "customFields": values}
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks", task); w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d, body=%s", w.Code, w.Body.String())
+		}
+	}
+	if w := doJSONRequest(t, r, http.MethodPost, "/tasks", map[string]interface{}{"task": "Loose", "userId": 1}); w.Code != http.StatusCreated {
+		t.Fatalf("create task expected 201, got %d", w.Code)
+	}
+
+	ids := func(path string) string {
+		t.Helper()
+		var got []uint
+		for _, task := range getTaskPage(t, r, path).Data {
+			got = append(got, task.ID)
+		}
+		return fmt.Sprint(got)
+	}
+	for path, want := range map[string]string{
+		"/tasks?sort=id&q=cf.points>3":              "[2 3]",
+		"/tasks?sort=id&q=cf.labels:bug":            "[1]",
+		"/tasks?sort=id&q=cf.labels!=bug":           "[2 3 4]",
+		"/tasks?sort=id&q=cf.start>=2026-03-15":     "[2]",
+		"/tasks?sort=-cf.points,id":                 "[3 2 1 4]",
+		"/tasks?sort=id&projectId=1":                "[1 2 3]",
+		"/tasks?sort=id&q=project:1%20cf.points<=5": "[1 2]",
+	} {
+		if got := ids(path); got != want {
+			t.Fatalf("GET %s expected %s, got %s", path, want, got)
+		}
+	}
+	for _, path := range []string{"/tasks?q=cf.missing:1", "/tasks?sort=cf.labels"} {
+		if w := doJSONRequest(t, r, http.MethodGet, path, nil); w.Code != http.StatusBadRequest {
+			t.Fatalf("GET %s expected 400, got %d", path, w.Code)
+		}
+	}
+
+	// Updates merge into the stored values; null clears an optional field
+	update := map[string]interface{}{"customFields": map[string]interface{}{"labels": nil, "points": 3}}
+	w = doJSONRequest(t, r, http.MethodPut, "/tasks/1", update)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update task expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var updated struct {
+		Data models.Task `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &updated); err != nil {
+		t.Fatalf("failed to parse task: %v", err)
+	}
+	if got := fmt.Sprint(updated.Data.CustomFields); got != "map[points:3 start:2026-03-01]" {
+		t.Fatalf("unexpected custom fields after update: %s", got)
+	}
+	if w := doJSONRequest(t, r, http.MethodPut, "/tasks/1", map[string]interface{}{"customFields": map[string]interface{}{"points": nil}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("clearing a required field expected 400, got %d", w.Code)
+	}
+	if w := doJSONRequest(t, r, http.MethodPut, "/tasks/1", map[string]interface{}{"projectId": 0}); w.Code != http.StatusOK {
+		t.Fatalf("removing project expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if got := ids("/tasks?sort=id&projectId=1"); got != "[2 3]" {
+		t.Fatalf("expected task removed from project, got %s", got)
+	}
+
+	// Workspace fields apply to every task and stay with it across projects
+	team := map[string]interface{}{"key": "team", "name": "Team", "type": "select", "options": []string{"core", "web"}}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/fields", team, headers); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin workspace field expected 403, got %d", w.Code)
+	}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/fields", team, admin); w.Code != http.StatusCreated {
+		t.Fatalf("create workspace field expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/projects/1/fields", team, admin); w.Code != http.StatusBadRequest {
+		t.Fatalf("project field shadowing a workspace field expected 400, got %d", w.Code)
+	}
+	var fields struct {
+		Data []models.CustomFieldDefinition `json:"data"`
+	}
+	w = doJSONRequestWithHeaders(t, r, http.MethodGet, "/fields", nil, headers)
+	if err := json.Unmarshal(w.Body.Bytes(), &fields); err != nil || len(fields.Data) != 1 || fields.Data[0].ProjectID != nil {
+		t.Fatalf("unexpected workspace fields: %s", w.Body.String())
+	}
+	task := map[string]interface{}{"task": "Team", "userId": 1, "customFields": map[string]interface{}{"team": "Web"}}
+	if w := doJSONRequest(t, r, http.MethodPost, "/tasks", task); w.Code != http.StatusCreated {
+		t.Fatalf("create task with workspace field expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	move := map[string]interface{}{"projectId": 1, "customFields": map[string]interface{}{"points": 1}}
+	if w := doJSONRequest(t, r, http.MethodPut, "/tasks/5", move); w.Code != http.StatusOK {
+		t.Fatalf("moving task into project expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if got := ids("/tasks?sort=id&q=cf.team:web"); got != "[5]" {
+		t.Fatalf("expected workspace value kept across projects, got %s", got)
+	}
+
+	// Values left by a deleted definition do not match a redefined key
+	// of another type
+	w = doJSONRequestWithHeaders(t, r, http.MethodPost, "/projects/1/fields", map[string]interface{}{"key": "size", "name": "Size", "type": "text"}, admin)
+	var size struct {
+		Data models.CustomFieldDefinition `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &size); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("create field expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	doJSONRequest(t, r, http.MethodPut, "/tasks/2", map[string]interface{}{"customFields": map[string]interface{}{"size": "big"}})
+	if w := doJSONRequestWithHeaders(t, r, http.MethodDelete, fmt.Sprintf("/projects/1/fields/%d", size.Data.ID), nil, admin); w.Code != http.StatusOK {
+		t.Fatalf("delete field expected 200, got %d", w.Code)
+	}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/projects/1/fields", map[string]interface{}{"key": "size", "name": "Size", "type": "number"}, admin); w.Code != http.StatusCreated {
+		t.Fatalf("recreate field expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	doJSONRequest(t, r, http.MethodPut, "/tasks/3", map[string]interface{}{"customFields": map[string]interface{}{"size": 2}})
+	if got := ids("/tasks?sort=id&q=cf.size<5"); got != "[3]" {
+		t.Fatalf("expected only the redefined value to match, got %s", got)
+	}
+	if got := ids("/tasks?sort=-cf.size,id&projectId=1"); got != "[3 2 5]" {
+		t.Fatalf("expected stale values to sort as unset, got %s", got)
+	}
+}
+
+func TestTaskLinks(t *testing.T) {
+	r := testRouter(t)
+	registerUser(t, r, "Link User", "links@example.com")
+	for _, name := range []string{"Login fails on Safari", "Safari login broken", "Write postmortem"} {
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks", map[string]interface{}{"task": name, "userId": 1}); w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d", w.Code)
+		}
+	}
+
+	for _, link := range []map[string]interface{}{
+		{"type": "blocks", "targetId": 1},
+		{"type": "relates", "targetId": 2},
+		{"type": "relates", "targetId": 99},
+		{"type": "follows", "targetId": 1, "cancel": true},
+	} {
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks/2/links", link); w.Code != http.StatusBadRequest {
+			t.Fatalf("link %v expected 400, got %d", link, w.Code)
+		}
+	}
+	w := doJSONRequest(t, r, http.MethodPost, "/tasks/2/links", map[string]interface{}{"type": "duplicates", "targetId": 1, "cancel": true})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("link expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if w := doJSONRequest(t, r, http.MethodPost, "/tasks/3/links", map[string]interface{}{"type": "follows", "targetId": 1}); w.Code != http.StatusCreated {
+		t.Fatalf("link expected 201, got %d", w.Code)
+	}
+	if w := doJSONRequest(t, r, http.MethodPost, "/tasks/2/links", map[string]interface{}{"type": "duplicates", "targetId": 3}); w.Code != http.StatusBadRequest {
+		t.Fatalf("second canonical task expected 400, got %d", w.Code)
+	}
+	if w := doJSONRequest(t, r, http.MethodPost, "/tasks/1/links", map[string]interface{}{"type": "follows", "targetId": 3}); w.Code != http.StatusBadRequest {
+		t.Fatalf("reverse follow-up expected 400, got %d", w.Code)
+	}
+
+	getTask := func(id int) models.Task {
+		t.Helper()
+		w := doJSONRequest(t, r, http.MethodGet, fmt.Sprintf("/tasks/%d", id), nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("get task expected 200, got %d", w.Code)
+		}
+		var resp struct {
+			Data models.Task `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to parse task: %v", err)
+		}
+		return resp.Data
+	}
+	links := func(task models.Task) string {
+		var got []string
+		for _, link := range task.Links {
+			got = append(got, fmt.Sprintf("%s:%d", link.Type, link.TaskID))
+		}
+		return fmt.Sprint(got)
+	}
+
+	duplicate := getTask(2)
+	if duplicate.Status != models.StatusCancelled || duplicate.DuplicateOf == nil || *duplicate.DuplicateOf != 1 {
+		t.Fatalf("expected cancelled duplicate of 1, got status %s, duplicateOf %v", duplicate.Status, duplicate.DuplicateOf)
+	}
+	canonical := getTask(1)
+	if got := links(canonical); got != "[duplicatedBy:2 followedBy:3]" {
+		t.Fatalf("unexpected links on canonical task: %s", got)
+	}
+	if canonical.DuplicateOf != nil {
+		t.Fatalf("canonical task should not be a duplicate")
+	}
+
+	// Links can be removed from either end
+	if w := doJSONRequest(t, r, http.MethodDelete, fmt.Sprintf("/tasks/1/links/%d", canonical.Links[0].ID), nil); w.Code != http.StatusOK {
+		t.Fatalf("unlink expected 200, got %d", w.Code)
+	}
+	if got := links(getTask(2)); got != "[]" {
+		t.Fatalf("expected duplicate link removed, got %s", got)
+	}
+	if w := doJSONRequest(t, r, http.MethodDelete, fmt.Sprintf("/tasks/2/links/%d", canonical.Links[1].ID), nil); w.Code != http.StatusNotFound {
+		t.Fatalf("unlink from an unrelated task expected 404, got %d", w.Code)
+	}
+}
+
+func TestWatchersAndNotifications(t *testing.T) {
+	r := testRouter(t)
+	w := doJSONRequest(t, r, http.MethodPost, "/auth/register", map[string]interface{}{
+		"name": "Alice", "email": "alice@example.com", "password": "password123", "handle": "Alice",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register with handle expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var registered struct {
+		Data struct {
+			AccessToken string `json:"access_token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &registered); err != nil {
+		t.Fatalf("failed to parse register response: %v", err)
+	}
+	alice := map[string]string{"Authorization": "Bearer " + registered.Data.AccessToken}
+	bob := registerUser(t, r, "Bob", "bob@example.com")
+	carol := registerUser(t, r, "Carol", "carol@example.com")
+
+	type notificationList struct {
+		Data []struct {
+			ID      uint   `json:"id"`
+			Type    string `json:"type"`
+			TaskID  uint   `json:"taskId"`
+			Message string `json:"message"`
+		} `json:"data"`
+		UnreadCount int64 `json:"unreadCount"`
+	}
+	inbox := func(headers map[string]string, query string) notificationList {
+		t.Helper()
+		w := doJSONRequestWithHeaders(t, r, http.MethodGet, "/notifications"+query, nil, headers)
+		if w.Code != http.StatusOK {
+			t.Fatalf("notifications expected 200, got %d, body=%s", w.Code, w.Body.String())
+		}
+		var list notificationList
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatalf("failed to parse notifications: %v", err)
+		}
+		return list
+	}
+	types := func(list notificationList) string {
+		var got []string
+		for _, n := range list.Data {
+			got = append(got, n.Type)
+		}
+		return fmt.Sprint(got)
+	}
+
+	// Alice creates a task for Bob, mentioning Carol by email
+	task := map[string]interface{}{"task": "Ship release", "description": "cc @carol@example.com", "userId": 2}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/tasks", task, alice); w.Code != http.StatusCreated {
+		t.Fatalf("create task expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if got := types(inbox(bob, "")); got != "[assigned]" {
+		t.Fatalf("expected Bob to be notified of the assignment, got %s", got)
+	}
+	if list := inbox(carol, ""); types(list) != "[mentioned]" || list.Data[0].Message != `Alice mentioned you on "Ship release"` {
+		t.Fatalf("unexpected mention notification: %+v", list.Data)
+	}
+	if got := types(inbox(alice, "")); got != "[]" {
+		t.Fatalf("expected no notifications for the actor, got %s", got)
+	}
+
+	w = doJSONRequest(t, r, http.MethodGet, "/tasks/1/watchers", nil)
+	var watchers struct {
+		Data []models.User `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &watchers); err != nil || len(watchers.Data) != 2 {
+		t.Fatalf("expected creator and assignee to watch, got %s", w.Body.String())
+	}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/tasks/1/watch", nil, carol); w.Code != http.StatusOK {
+		t.Fatalf("watch expected 200, got %d", w.Code)
+	}
+
+	// Bob completes the task and mentions Alice by handle in a comment
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPut, "/tasks/1/complete", nil, bob); w.Code != http.StatusOK {
+		t.Fatalf("complete expected 200, got %d", w.Code)
+	}
+	comment := map[string]interface{}{"body": "Done, thanks @alice! Mail me at bob@example.com"}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/tasks/1/comments", comment, bob); w.Code != http.StatusCreated {
+		t.Fatalf("comment expected 201, got %d", w.Code)
+	}
+	list := inbox(alice, "")
+	if types(list) != "[mentioned statusChanged]" || list.UnreadCount != 2 {
+		t.Fatalf("unexpected notifications for Alice: %s, unread %d", types(list), list.UnreadCount)
+	}
+	if got := types(inbox(carol, "?unread=true")); got != "[statusChanged mentioned]" {
+		t.Fatalf("unexpected notifications for Carol: %s", got)
+	}
+	if got := types(inbox(bob, "")); got != "[assigned]" {
+		t.Fatalf("expected Bob's own changes not to notify him, got %s", got)
+	}
+
+	// Reading notifications
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, fmt.Sprintf("/notifications/%d/read", list.Data[0].ID), nil, bob); w.Code != http.StatusNotFound {
+		t.Fatalf("reading another user's notification expected 404, got %d", w.Code)
+	}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, fmt.Sprintf("/notifications/%d/read", list.Data[0].ID), nil, alice); w.Code != http.StatusOK {
+		t.Fatalf("mark read expected 200, got %d", w.Code)
+	}
+	if got := types(inbox(alice, "?unread=true")); got != "[statusChanged]" {
+		t.Fatalf("expected one unread notification, got %s", got)
+	}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/notifications/read-all", nil, alice); w.Code != http.StatusOK {
+		t.Fatalf("read all expected 200, got %d", w.Code)
+	}
+	w = doJSONRequestWithHeaders(t, r, http.MethodGet, "/notifications/unread-count", nil, alice)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"unreadCount":0`) {
+		t.Fatalf("expected no unread notifications, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Due soon notifications go to watchers once per window
+	due := time.Now().Add(3 * time.Hour)
+	task = map[string]interface{}{"task": "Renew certificate", "userId": 2, "dueDate": due}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/tasks", task, bob); w.Code != http.StatusCreated {
+		t.Fatalf("create task expected 201, got %d", w.Code)
+	}
+	if n, err := models.NotifyDueSoon(models.DB, time.Now()); err != nil || n != 1 {
+		t.Fatalf("expected one due soon notification, got %d (%v)", n, err)
+	}
+	if n, _ := models.NotifyDueSoon(models.DB, time.Now()); n != 0 {
+		t.Fatalf("expected due soon notifications not to repeat, got %d", n)
+	}
+	if got := types(inbox(bob, "?unread=true")); got != "[dueSoon assigned]" {
+		t.Fatalf("unexpected notifications for Bob: %s", got)
+	}
+	if w := doJSONRequest(t, r, http.MethodGet, "/notifications", nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous notifications expected 401, got %d", w.Code)
+	}
+}
+
+func TestCalendarFeed(t *testing.T) {
+	r := testRouter(t)
+	headers := registerUser(t, r, "Calendar User", "calendar@example.com")
+	registerUser(t, r, "Other User", "other-calendar@example.com")
+
+	due := time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+	timed := time.Date(2024, 6, 4, 14, 30, 0, 0, time.UTC)
+	for _, task := range []map[string]interface{}{
+		{"task": "Pay rent, early", "priority": "high", "category": "home", "dueDate": due, "tags": []string{"money"}, "userId": 1},
+		{"task": "Dentist", "description": "Bring\nforms", "dueDate": timed, "userId": 1},
+		{"task": "Someone else's", "userId": 2},
+	} {
+		if w := doJSONRequest(t, r, http.MethodPost, "/tasks", task); w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d", w.Code)
+		}
+	}
+	doJSONRequest(t, r, http.MethodPut, "/tasks/2/complete", nil)
+	// Imported tasks keep their UID, which their relations refer to
+	models.DB.Model(&models.Task{}).Where("id = ?", 1).Update("external_id", "ical:rent@bank.example")
+	models.DB.Model(&models.Task{}).Where("id = ?", 2).Updates(map[string]interface{}{"parent_id": 1, "external_id": "caldav:dentist@phone.example"})
+
+	w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/calendar/token", nil, headers)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create token expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var issued struct {
+		Data struct {
+			URL string `json:"url"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &issued); err != nil {
+		t.Fatalf("failed to parse token response: %v", err)
+	}
+
+	w = doJSONRequest(t, r, http.MethodGet, issued.Data.URL+"?events=true", nil)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/calendar") {
+		t.Fatalf("feed expected 200 text/calendar, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, line := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"SUMMARY:Pay rent\\, early\r\n",
+		"PRIORITY:1\r\n",
+		"STATUS:NEEDS-ACTION\r\n",
+		"CATEGORIES:home,money\r\n",
+		"DUE;VALUE=DATE:20240603\r\n",
+		"DESCRIPTION:Bring\\nforms\r\n",
+		"DUE:20240604T143000Z\r\n",
+		"STATUS:COMPLETED\r\n",
+		"PERCENT-COMPLETE:100\r\n",
+		"BEGIN:VEVENT\r\nUID:task-2-due@todo-list-go\r\n",
+		"RELATED-TO:rent@bank.example\r\n",
+		"RELATED-TO:dentist@phone.example\r\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Fatalf("feed missing %q:\n%s", line, body)
+		}
+	}
+	if strings.Count(body, "BEGIN:VTODO") != 2 || strings.Count(body, "BEGIN:VEVENT") != 1 {
+		t.Fatalf("expected the caller's two tasks and one timed event:\n%s", body)
+	}
+
+	// Conditional requests are answered without a body until tasks change
+	etag := w.Header().Get("ETag")
+	lastModified := w.Header().Get("Last-Modified")
+	if w := doJSONRequestWithHeaders(t, r, http.MethodGet, issued.Data.URL+"?events=true", nil, map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Fatalf("matching ETag expected 304, got %d", w.Code)
+	}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodGet, issued.Data.URL, nil, map[string]string{"If-None-Match": etag}); w.Code != http.StatusOK {
+		t.Fatalf("a different view of the feed expected 200, got %d", w.Code)
+	}
+	if w := doJSONRequestWithHeaders(t, r, http.MethodGet, issued.Data.URL+"?events=true", nil, map[string]string{"If-Modified-Since": lastModified}); w.Code != http.StatusNotModified {
+		t.Fatalf("If-Modified-Since expected 304, got %d", w.Code)
+	}
+	doJSONRequest(t, r, http.MethodDelete, "/tasks/1", nil)
+	if w := doJSONRequestWithHeaders(t, r, http.MethodGet, issued.Data.URL+"?events=true", nil, map[string]string{"If-None-Match": etag}); w.Code != http.StatusOK {
+		t.Fatalf("deleting a task should change the ETag, got %d", w.Code)
+	}
+
+	if w := doJSONRequestWithHeaders(t, r, http.MethodDelete, "/calendar/token", nil, headers); w.Code != http.StatusOK {
+		t.Fatalf("revoke expected 200, got %d", w.Code)
+	}
+	if w := doJSONRequest(t, r, http.MethodGet, issued.Data.URL, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("revoked feed expected 404, got %d", w.Code)
+	}
+}
+
+func TestImportICal(t *testing.T) {
+	r := testRouter(t)
+	headers := registerUser(t, r, "Import User", "import@example.com")
+
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Other App//EN",
+		"BEGIN:VTIMEZONE",
+		"TZID:Europe/Berlin",
+		"END:VTIMEZONE",
+		"BEGIN:VTODO",
+		"UID:todo-1",
+		"SUMMARY:File taxes\\, finally",
+		"DESCRIPTION:Forms in\\ndrawer",
+		"DUE;TZID=Europe/Berlin:20240603T173000",
+		"PRIORITY:2",
+		"CATEGORIES:finance,home,urgent",
+		"RRULE:FREQ=YEARLY",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:todo-2",
+		"SUMMARY:Old chore",
+		"STATUS:COMPLETED",
+		"COMPLETED:20240101T100000Z",
+		"PRIORITY:9",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:todo-3",
+		"DESCRIPTION:No summary",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:todo-4",
+		"SUMMARY:Bad rule",
+		"RRULE:INTERVAL=2",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:todo-5",
+		"SUMMARY:Long rule",
+		"RRULE:FREQ=DAILY;BYHOUR=" + strings.Repeat("1,", 130) + "1",
+		"END:VTODO",
+		"BEGIN:VTODO",
+		"UID:todo-6",
+		"SUMMARY:Long tag",
+		"CATEGORIES:home," + strings.Repeat("t", 101),
+		"END:VTODO",
+		"BEGIN:VEVENT",
+		"UID:event-1",
+		"SUMMARY:Meeting",
+		"END:VEVENT",
+		"BEGIN:VTODO",
+		"UID:todo-1",
+		"SUMMARY:Same UID again",
+		"END:VTODO",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+
+	type importResponse struct {
+		Data struct {
+			Imported int                  `json:"imported"`
+			TaskIDs  []uint               `json:"taskIds"`
+			Skipped  []models.ImportIssue `json:"skipped"`
+			Invalid  []models.ImportIssue `json:"invalid"`
+		} `json:"data"`
+	}
+	upload := func() importResponse {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/import/ical", strings.NewReader(calendar))
+		req.Header.Set("Content-Type", "text/calendar")
+		req.Header.Set("Authorization", headers["Authorization"])
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("import expected 200, got %d, body=%s", w.Code, w.Body.String())
+		}
+		var resp importResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to parse import response: %v", err)
+		}
+		return resp
+	}
+	issues := func(list []models.ImportIssue) string {
+		var got []string
+		for _, issue := range list {
+			got = append(got, fmt.Sprintf("%d:%s", issue.Index, issue.UID))
+		}
+		return fmt.Sprint(got)
+	}
+
+	first := upload()
+	if first.Data.Imported != 2 || issues(first.Data.Invalid) != "[2:todo-3 3:todo-4 4:todo-5 5:todo-6]" || issues(first.Data.Skipped) != "[6:event-1 7:todo-1]" {
+		t.Fatalf("unexpected import result: %+v", first.Data)
+	}
+
+	var taxes models.Task
+	models.DB.Preload("Tags").First(&taxes, first.Data.TaskIDs[0])
+	if taxes.Task != "File taxes, finally" || taxes.Description != "Forms in\ndrawer" || taxes.Priority != models.PriorityHigh ||
+		taxes.Category != "finance" || len(taxes.Tags) != 2 || taxes.Recurrence != "FREQ=YEARLY" || taxes.UserID != 1 {
+		t.Fatalf("unexpected imported task: %+v", taxes)
+	}
+	if taxes.DueDate == nil || !taxes.DueDate.Equal(time.Date(2024, 6, 3, 15, 30, 0, 0, time.UTC)) {
+		t.Fatalf("expected due date converted from Berlin time, got %v", taxes.DueDate)
+	}
+	var chore models.Task
+	models.DB.First(&chore, first.Data.TaskIDs[1])
+	if chore.Status != models.StatusCompleted || chore.Priority != models.PriorityLow || chore.CompletedAt == nil || chore.CompletedAt.Year() != 2024 {
+		t.Fatalf("unexpected completed task: %+v", chore)
+	}
+
+	// Importing again only reports the tasks as already imported
+	second := upload()
+	if second.Data.Imported != 0 || issues(second.Data.Skipped) != "[0:todo-1 1:todo-2 6:event-1 7:todo-1]" {
+		t.Fatalf("unexpected re-import result: %+v", second.Data)
+	}
+	if second.Data.Skipped[0].Reason != "already imported" {
+		t.Fatalf("unexpected skip reason %q", second.Data.Skipped[0].Reason)
+	}
+
+	w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/import/ical", "BEGIN:VTODO", headers)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("malformed calendar expected 400, got %d", w.Code)
+	}
+}
+
+func TestCalDAV(t *testing.T) {
+	r := testRouter(t)
+	headers := registerUser(t, r, "DAV User", "dav@example.com")
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/tasks", map[string]interface{}{"task": "Made in the app", "userId": 1}, headers); w.Code != http.StatusCreated {
+		t.Fatalf("create task expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/app-passwords", map[string]interface{}{"name": "Phone"}, headers)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create app password expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Data struct {
+			Password string `json:"password"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || len(created.Data.Password) != 24 {
+		t.Fatalf("unexpected app password response: %s", w.Body.String())
+	}
+
+	dav := func(method, path, body string, extra map[string]string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.SetBasicAuth("DAV@example.com", strings.ToUpper(created.Data.Password))
+		for key, value := range extra {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	vtodo := func(uid string, lines ...string) string {
+		return strings.Join(append(append([]string{"BEGIN:VCALENDAR", "VERSION:2.0", "PRODID:-//Phone//EN", "BEGIN:VTODO", "UID:" + uid},
+			lines...), "END:VTODO", "END:VCALENDAR", ""), "\r\n")
+	}
+
+	req := httptest.NewRequest("PROPFIND", "/dav/tasks/", nil)
+	req.SetBasicAuth("dav@example.com", "wrong-password")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), "Basic") {
+		t.Fatalf("wrong password expected 401 with a challenge, got %d %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+
+	w = dav(http.MethodOptions, "/dav/", "", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("DAV"), "calendar-access") {
+		t.Fatalf("OPTIONS expected calendar-access, got %d %q", w.Code, w.Header().Get("DAV"))
+	}
+	w = dav("PROPFIND", "/dav/", `<propfind xmlns="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><prop><C:calendar-home-set/><quota-used-bytes/></prop></propfind>`, map[string]string{"Depth": "0"})
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "<C:calendar-home-set><D:href>/dav/</D:href></C:calendar-home-set>") ||
+		!strings.Contains(w.Body.String(), "404 Not Found") {
+		t.Fatalf("unexpected principal PROPFIND: %d %s", w.Code, w.Body.String())
+	}
+
+	// Creating a resource
+	w = dav(http.MethodPut, "/dav/tasks/phone-1.ics", vtodo("phone-1", "SUMMARY:Buy milk", "DUE;VALUE=DATE:20240610", "CATEGORIES:errands,shop"), map[string]string{"If-None-Match": "*"})
+	if w.Code != http.StatusCreated || w.Header().Get("ETag") == "" {
+		t.Fatalf("PUT new resource expected 201 with an ETag, got %d, body=%s", w.Code, w.Body.String())
+	}
+	etag := w.Header().Get("ETag")
+	if w = dav(http.MethodPut, "/dav/tasks/phone-1.ics", vtodo("phone-1", "SUMMARY:Again"), map[string]string{"If-None-Match": "*"}); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("PUT over existing resource with If-None-Match expected 412, got %d", w.Code)
+	}
+	w = dav(http.MethodGet, "/dav/tasks/phone-1.ics", "", nil)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != etag || !strings.Contains(w.Body.String(), "UID:phone-1\r\n") ||
+		!strings.Contains(w.Body.String(), "CATEGORIES:errands,shop") {
+		t.Fatalf("unexpected GET: %d %q %s", w.Code, w.Header().Get("ETag"), w.Body.String())
+	}
+
+	w = dav("PROPFIND", "/dav/tasks/", "", map[string]string{"Depth": "1"})
+	body := w.Body.String()
+	if w.Code != http.StatusMultiStatus || !strings.Contains(body, "<D:href>/dav/tasks/task-1@todo-list-go.ics</D:href>") ||
+		!strings.Contains(body, "<D:href>/dav/tasks/phone-1.ics</D:href>") || !strings.Contains(body, "<CS:getctag>") ||
+		!strings.Contains(body, `<C:comp name="VTODO"/>`) {
+		t.Fatalf("unexpected collection PROPFIND: %d %s", w.Code, body)
+	}
+
+	// Updating goes through task validation and honours If-Match
+	if w = dav(http.MethodPut, "/dav/tasks/phone-1.ics", vtodo("phone-1", "SUMMARY:Buy milk", "PRIORITY:12"), map[string]string{"If-Match": etag}); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid priority expected 400, got %d", w.Code)
+	}
+	if w = dav(http.MethodPut, "/dav/tasks/phone-1.ics", vtodo("other", "SUMMARY:Buy milk"), nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("mismatched UID expected 400, got %d", w.Code)
+	}
+	event := strings.Replace(vtodo("meeting", "SUMMARY:Meeting"), "VTODO", "VEVENT", 2)
+	if w = dav(http.MethodPut, "/dav/tasks/meeting.ics", event, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("VEVENT expected 403, got %d", w.Code)
+	}
+	for _, line := range []string{"RRULE:FREQ=DAILY;BYHOUR=" + strings.Repeat("1,", 130) + "1", "CATEGORIES:errands," + strings.Repeat("t", 101)} {
+		if w = dav(http.MethodPut, "/dav/tasks/long.ics", vtodo("long", "SUMMARY:Long", line), nil); w.Code != http.StatusBadRequest {
+			t.Fatalf("oversized %.10s expected 400, got %d", line, w.Code)
+		}
+	}
+	w = dav(http.MethodPut, "/dav/tasks/phone-1.ics", vtodo("phone-1", "SUMMARY:Buy oat milk", "STATUS:COMPLETED", "COMPLETED:20240601T083000Z", "CATEGORIES:errands"), map[string]string{"If-Match": etag})
+	if w.Code != http.StatusNoContent || w.Header().Get("ETag") == etag {
+		t.Fatalf("PUT update expected 204 with a new ETag, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if w = dav(http.MethodPut, "/dav/tasks/phone-1.ics", vtodo("phone-1", "SUMMARY:Stale"), map[string]string{"If-Match": etag}); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale If-Match expected 412, got %d", w.Code)
+	}
+	var task models.Task
+	models.DB.Preload("Tags").Where("external_id = ?", "caldav:phone-1").First(&task)
+	if task.Task != "Buy oat milk" || task.Status != models.StatusCompleted || task.CompletedAt == nil ||
+		!task.CompletedAt.Equal(time.Date(2024, 6, 1, 8, 30, 0, 0, time.UTC)) || task.DueDate != nil ||
+		task.Category != "errands" || len(task.Tags) != 0 {
+		t.Fatalf("unexpected task after PUT: %+v", task)
+	}
+
+	// Reports
+	query := `<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:prop><D:getetag/></D:prop>` +
+		`<C:filter><C:comp-filter name="VCALENDAR"><C:comp-filter name="VTODO"><C:prop-filter name="COMPLETED"><C:is-not-defined/></C:prop-filter>` +
+		`</C:comp-filter></C:comp-filter></C:filter></C:calendar-query>`
+	w = dav("REPORT", "/dav/tasks/", query, map[string]string{"Depth": "1"})
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "task-1@todo-list-go.ics") || strings.Contains(w.Body.String(), "phone-1.ics") {
+		t.Fatalf("unexpected calendar-query: %d %s", w.Code, w.Body.String())
+	}
+	multiget := `<C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav"><D:prop><D:getetag/><C:calendar-data/></D:prop>` +
+		`<D:href>/dav/tasks/phone-1.ics</D:href><D:href>/dav/tasks/missing.ics</D:href></C:calendar-multiget>`
+	w = dav("REPORT", "/dav/tasks/", multiget, map[string]string{"Depth": "1"})
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "SUMMARY:Buy oat milk") || !strings.Contains(w.Body.String(), "404 Not Found") {
+		t.Fatalf("unexpected calendar-multiget: %d %s", w.Code, w.Body.String())
+	}
+
+	if w = dav(http.MethodDelete, "/dav/tasks/phone-1.ics", "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE expected 204, got %d", w.Code)
+	}
+	if w = dav(http.MethodGet, "/dav/tasks/phone-1.ics", "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("GET deleted resource expected 404, got %d", w.Code)
+	}
+
+	// Revoked passwords stop working
+	w = doJSONRequestWithHeaders(t, r, http.MethodGet, "/app-passwords", nil, headers)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), created.Data.Password) || !strings.Contains(w.Body.String(), "lastUsedAt") {
+		t.Fatalf("unexpected app password list: %s", w.Body.String())
+	}
+	if w = doJSONRequestWithHeaders(t, r, http.MethodDelete, "/app-passwords/1", nil, headers); w.Code != http.StatusOK {
+		t.Fatalf("revoke expected 200, got %d", w.Code)
+	}
+	if w = dav("PROPFIND", "/dav/", "", nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked password expected 401, got %d", w.Code)
+	}
+
+	// The prefix finds the password to check, and the rest must match it
+	for i := 0; i < 20; i++ {
+		w = doJSONRequestWithHeaders(t, r, http.MethodPost, "/app-passwords", map[string]interface{}{"name": fmt.Sprintf("Device %d", i)}, headers)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create app password %d expected 201, got %d, body=%s", i, w.Code, w.Body.String())
+		}
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w = doJSONRequestWithHeaders(t, r, http.MethodPost, "/app-passwords", map[string]interface{}{"name": "One too many"}, headers); w.Code != http.StatusBadRequest {
+		t.Fatalf("app password beyond the limit expected 400, got %d", w.Code)
+	}
+	if w = dav("PROPFIND", "/dav/", "", nil); w.Code != http.StatusMultiStatus {
+		t.Fatalf("new password expected 207, got %d", w.Code)
+	}
+	created.Data.Password = created.Data.Password[:5] + "aaaa-aaaa-aaaa-aaaa"
+	if w = dav("PROPFIND", "/dav/", "", nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong secret expected 401, got %d", w.Code)
+	}
+}
+
+func TestTasksCSV(t *testing.T) {
+	r := testRouter(t)
+	headers := registerUser(t, r, "CSV User", "csv@example.com")
+
+	upload := func(path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/csv")
+		req.Header.Set("Authorization", headers["Authorization"])
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	type importResponse struct {
+		Data models.CSVImportResult `json:"data"`
+	}
+	parse := func(w *httptest.ResponseRecorder) models.CSVImportResult {
+		t.Helper()
+		var resp importResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to parse import response: %v", err)
+		}
+		return resp.Data
+	}
+	countTasks := func() int64 {
+		var count int64
+		models.DB.Model(&models.Task{}).Count(&count)
+		return count
+	}
+
+	mapping := url.QueryEscape(`{"Title":"task","Due":"dueDate","Labels":"tags"}`)
+	valid := "Title,Priority,Due,Labels,Owner\n" +
+		"Rotate keys,high,2024-06-01T09:00:00Z,\"ops, security\",Sam\n" +
+		"\"Renew cert, staging\",low,,,Sam\n"
+
+	// A dry run validates without importing
+	w := upload("/tasks/import.csv?dryRun=true&mapping="+mapping, strings.Replace(valid, "Priority", "priority", 1))
+	result := parse(w)
+	if w.Code != http.StatusOK || !result.DryRun || result.Rows != 2 || result.Imported != 0 || len(result.Errors) != 0 ||
+		fmt.Sprint(result.IgnoredColumns) != "[Owner]" || countTasks() != 0 {
+		t.Fatalf("unexpected dry run: %d %s", w.Code, w.Body.String())
+	}
+
+	// Any invalid row rolls back the whole import
+	invalid := "task,priority,dueDate,status\n" +
+		"Fine,medium,,\n" +
+		",high,,\n" +
+		"Bad priority,urgent,,\n" +
+		"Bad date,low,01/06/2024,\n" +
+		"Bad status,low,,done\n"
+	w = upload("/tasks/import.csv", invalid)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid rows expected 400, got %d, body=%s", w.Code, w.Body.String())
+	}
+	result = parse(w)
+	var lines []string
+	for _, rowErr := range result.Errors {
+		lines = append(lines, fmt.Sprintf("%d:%s", rowErr.Line, rowErr.Column))
+	}
+	if fmt.Sprint(lines) != "[3: 4: 5:dueDate 6:status]" || countTasks() != 0 {
+		t.Fatalf("unexpected row errors %v: %s", lines, w.Body.String())
+	}
+
+	w = upload("/tasks/import.csv?mapping="+mapping, strings.Replace(valid, "Priority", "priority", 1))
+	result = parse(w)
+	if w.Code != http.StatusOK || result.Imported != 2 || len(result.TaskIDs) != 2 {
+		t.Fatalf("unexpected import: %d %s", w.Code, w.Body.String())
+	}
+	var keys models.Task
+	models.DB.Preload("Tags").First(&keys, result.TaskIDs[0])
+	if keys.Task != "Rotate keys" || keys.Priority != models.PriorityHigh || keys.UserID != 1 || len(keys.Tags) != 2 ||
+		keys.DueDate == nil || !keys.DueDate.Equal(time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected imported task: %+v", keys)
+	}
+
+	// Export honours the listing filters
+	w = doJSONRequestWithHeaders(t, r, http.MethodGet, "/tasks/export.csv?priority=low", nil, headers)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("export expected CSV, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil || len(records) != 2 || records[0][1] != "task" || records[1][1] != "Renew cert, staging" {
+		t.Fatalf("unexpected export %v: %v", records, err)
+	}
+	w = doJSONRequestWithHeaders(t, r, http.MethodGet, "/tasks/export.csv?sort=dueDate", nil, headers)
+	records, _ = csv.NewReader(w.Body).ReadAll()
+	if len(records) != 3 || records[1][1] != "Rotate keys" || records[1][6] != "2024-06-01T09:00:00Z" || records[1][7] != "ops, security" {
+		t.Fatalf("unexpected sorted export %v", records)
+	}
+	if w = doJSONRequestWithHeaders(t, r, http.MethodGet, "/tasks/export.csv?q=priority:", nil, headers); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid filter expected 400, got %d", w.Code)
+	}
+
+	// Cells that would run as formulas are quoted, and read back unquoted
+	formula := `=HYPERLINK("https://evil.example","click")`
+	for _, name := range []string{formula, "'=quoted already", "'plain quote"} {
+		body := map[string]interface{}{"task": name, "description": "@SUM(A1)", "category": "Formulas", "userId": 1}
+		if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/tasks", body, headers); w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d, body=%s", w.Code, w.Body.String())
+		}
+	}
+	w = doJSONRequestWithHeaders(t, r, http.MethodGet, "/tasks/export.csv?category=Formulas&sort=id", nil, headers)
+	exported := w.Body.String()
+	records, _ = csv.NewReader(strings.NewReader(exported)).ReadAll()
+	if len(records) != 4 || records[1][1] != "'"+formula || records[1][2] != "'@SUM(A1)" || records[2][1] != "''=quoted already" || records[3][1] != "'plain quote" {
+		t.Fatalf("unexpected escaped export %v", records)
+	}
+	w = upload("/tasks/import.csv", exported)
+	result = parse(w)
+	var reimported []models.Task
+	models.DB.Where("id IN ?", result.TaskIDs).Order("id ASC").Find(&reimported)
+	if w.Code != http.StatusOK || len(reimported) != 3 || reimported[0].Task != formula || reimported[0].Description != "@SUM(A1)" ||
+		reimported[1].Task != "'=quoted already" || reimported[2].Task != "'plain quote" {
+		t.Fatalf("unexpected re-import %d: %+v", w.Code, reimported)
+	}
+}
+
+func TestTodoTxt(t *testing.T) {
+	r := testRouter(t)
+	headers := registerUser(t, r, "Todo User", "todotxt@example.com")
+
+	file := strings.Join([]string{
+		"(A) 2024-06-01 Call mom +family @phone due:2024-06-05",
+		"x 2024-06-03 2024-06-02 Water plants +home @garden pri:C",
+		"",
+		"x 2024-06-04 2024-06-02 Old idea pri:B status:cancelled",
+		"(B) +only @tokens",
+		"2024-06-01 Read https://example.com/post t:2024-07-01 due:soon",
+		"",
+	}, "\n")
+	req := httptest.NewRequest(http.MethodPost, "/tasks/import.txt", strings.NewReader(file))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Authorization", headers["Authorization"])
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp struct {
+		Data struct {
+			Imported int                  `json:"imported"`
+			TaskIDs  []uint               `json:"taskIds"`
+			Invalid  []models.ImportIssue `json:"invalid"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("import expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if resp.Data.Imported != 3 || len(resp.Data.Invalid) != 2 || resp.Data.Invalid[0].Index != 4 || resp.Data.Invalid[1].Index != 5 {
+		t.Fatalf("unexpected import result: %s", w.Body.String())
+	}
+
+	var call models.Task
+	models.DB.Preload("Tags").First(&call, resp.Data.TaskIDs[0])
+	if call.Task != "Call mom" || call.Priority != models.PriorityHigh || call.Category != "family" || len(call.Tags) != 1 ||
+		call.DueDate == nil || call.DueDate.Format("2006-01-02") != "2024-06-05" || call.CreatedAt.Format("2006-01-02") != "2024-06-01" {
+		t.Fatalf("unexpected imported task: %+v", call)
+	}
+	var plants, idea models.Task
+	models.DB.First(&plants, resp.Data.TaskIDs[1])
+	models.DB.First(&idea, resp.Data.TaskIDs[2])
+	if plants.Status != models.StatusCompleted || plants.Priority != models.PriorityLow || plants.CompletedAt == nil ||
+		plants.CompletedAt.Format("2006-01-02") != "2024-06-03" {
+		t.Fatalf("unexpected completed task: %+v", plants)
+	}
+	if idea.Status != models.StatusCancelled || idea.Priority != models.PriorityMedium {
+		t.Fatalf("unexpected cancelled task: %+v", idea)
+	}
+
+	// Pending and completed tasks export back to the lines they came from
+	w = doJSONRequestWithHeaders(t, r, http.MethodGet, "/tasks/export.txt?sort=id&q="+url.QueryEscape("status:pending OR status:completed"), nil, headers)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("export expected text, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	want := "(A) 2024-06-01 Call mom +family @phone due:2024-06-05\n" +
+		"x 2024-06-03 2024-06-02 Water plants +home @garden pri:C\n"
+	if w.Body.String() != want {
+		t.Fatalf("unexpected export:\n%s", w.Body.String())
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	r := testRouter(t)
+	headers := registerUser(t, r, "Markdown User", "markdown@example.com")
+
+	file := strings.Join([]string{
+		"# Weekly sync",
+		"",
+		"Notes from the meeting.",
+		"",
+		"- [ ] Book venue !high due:2024-06-05 #events",
+		"  Ask about catering",
+		"  - [x] Compare prices",
+		"    - [ ] Call the hotel !low",
+		"- [ ] due:2024-06-07",
+		"  - [ ] Orphan",
+		"",
+		"## Ops",
+		"",
+		"* [X] ~~Old idea~~",
+		"1. [ ] Renew certificate due:soon",
+	}, "\n")
+	req := httptest.NewRequest(http.MethodPost, "/tasks/import.md", strings.NewReader(file))
+	req.Header.Set("Content-Type", "text/markdown")
+	req.Header.Set("Authorization", headers["Authorization"])
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp struct {
+		Data struct {
+			Imported int                  `json:"imported"`
+			TaskIDs  []uint               `json:"taskIds"`
+			Invalid  []models.ImportIssue `json:"invalid"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("import expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if resp.Data.Imported != 4 || len(resp.Data.Invalid) != 3 || resp.Data.Invalid[0].Index != 8 ||
+		resp.Data.Invalid[1].Index != 9 || resp.Data.Invalid[2].Index != 14 {
+		t.Fatalf("unexpected import result: %s", w.Body.String())
+	}
+
+	var venue, prices, hotel, idea models.Task
+	models.DB.Preload("Tags").First(&venue, resp.Data.TaskIDs[0])
+	models.DB.First(&prices, resp.Data.TaskIDs[1])
+	models.DB.First(&hotel, resp.Data.TaskIDs[2])
+	models.DB.First(&idea, resp.Data.TaskIDs[3])
+	if venue.Task != "Book venue" || venue.Priority != models.PriorityHigh || venue.Description != "Ask about catering" ||
+		venue.DueDate == nil || venue.DueDate.Format("2006-01-02") != "2024-06-05" || len(venue.Tags) != 1 || venue.Tags[0].Name != "events" {
+		t.Fatalf("unexpected imported task: %+v", venue)
+	}
+	if prices.ParentID == nil || *prices.ParentID != venue.ID || prices.Status != models.StatusCompleted {
+		t.Fatalf("unexpected subtask: %+v", prices)
+	}
+	if hotel.ParentID == nil || *hotel.ParentID != prices.ID || hotel.Priority != models.PriorityLow {
+		t.Fatalf("unexpected nested subtask: %+v", hotel)
+	}
+	if idea.Task != "Old idea" || idea.Status != models.StatusCancelled || idea.Category != "Ops" || idea.ParentID != nil {
+		t.Fatalf("unexpected cancelled task: %+v", idea)
+	}
+
+	// Subtasks are exported under their parent even when only the parent
+	// matches the filters
+	w = doJSONRequestWithHeaders(t, r, http.MethodGet, "/tasks/export.md?sort=id&title=Sync&q="+url.QueryEscape("priority:high OR category:Ops"), nil, headers)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/markdown") {
+		t.Fatalf("export expected Markdown, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	want := "# Sync\n\n" +
+		"- [ ] Book venue !high due:2024-06-05 #events\n" +
+		"  Ask about catering\n" +
+		"  - [x] Compare prices\n" +
+		"    - [ ] Call the hotel !low\n" +
+		"\n## Ops\n\n" +
+		"- [x] ~~Old idea~~\n"
+	if w.Body.String() != want {
+		t.Fatalf("unexpected export:\n%s", w.Body.String())
+	}
+}
+
+func TestAccountExportImport(t *testing.T) {
+	r := testRouter(t)
+	// The export runs in the background; a single connection keeps it on
+	// the same in-memory database as the requests
+	sqlDB, err := models.DB.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	alice := registerUser(t, r, "Alice Archive", "alice-archive@example.com")
+	bob := registerUser(t, r, "Bob Restore", "bob-restore@example.com")
+	var aliceUser models.User
+	models.DB.Where("email = ?", "alice-archive@example.com").First(&aliceUser)
+
+	w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/projects", map[string]interface{}{"name": "Launch"}, alice)
+	var project struct {
+		Data models.Project `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &project)
+	createTask := func(body map[string]interface{}) models.Task {
+		body["userId"] = aliceUser.ID
+		w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/tasks", body, alice)
+		var resp struct {
+			Data models.Task `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusCreated {
+			t.Fatalf("create task expected 201, got %d, body=%s", w.Code, w.Body.String())
+		}
+		return resp.Data
+	}
+	parent := createTask(map[string]interface{}{"task": "Ship it", "projectId": project.Data.ID, "tags": []string{"release"}})
+	child := createTask(map[string]interface{}{"task": "Write notes"})
+	models.DB.Model(&child).UpdateColumn("parent_id", parent.ID)
+	doJSONRequestWithHeaders(t, r, http.MethodPut, fmt.Sprintf("/tasks/%d/complete", child.ID), nil, alice)
+	doJSONRequestWithHeaders(t, r, http.MethodPost, fmt.Sprintf("/tasks/%d/dependencies", parent.ID), map[string]interface{}{"blockedById": child.ID}, alice)
+	doJSONRequestWithHeaders(t, r, http.MethodPost, fmt.Sprintf("/tasks/%d/comments", parent.ID), map[string]interface{}{"body": "Almost there"}, alice)
+	doJSONRequestWithHeaders(t, r, http.MethodPost, fmt.Sprintf("/tasks/%d/checklist", parent.ID), map[string]interface{}{"text": "Tag the build"}, alice)
+	doJSONRequestWithHeaders(t, r, http.MethodPost, fmt.Sprintf("/tasks/%d/attachments", parent.ID), map[string]interface{}{"fileName": "plan.pdf", "url": "https://files.example.com/plan.pdf"}, alice)
+	doJSONRequestWithHeaders(t, r, http.MethodPut, "/settings", map[string]interface{}{"archiveAfterDays": 7}, alice)
+
+	w = doJSONRequestWithHeaders(t, r, http.MethodPost, "/account/export", nil, alice)
+	var export struct {
+		Data models.AccountExport `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &export); err != nil || w.Code != http.StatusAccepted || w.Header().Get("Location") == "" {
+		t.Fatalf("export expected 202, got %d, body=%s", w.Code, w.Body.String())
+	}
+	exportPath := fmt.Sprintf("/account/export/%d", export.Data.ID)
+	if w := doJSONRequestWithHeaders(t, r, http.MethodGet, exportPath, nil, bob); w.Code != http.StatusNotFound {
+		t.Fatalf("another user's export expected 404, got %d", w.Code)
+	}
+	for deadline := time.Now().Add(5 * time.Second); export.Data.Status == models.ExportPending; {
+		if time.Now().After(deadline) {
+			t.Fatalf("export did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+		w = doJSONRequestWithHeaders(t, r, http.MethodGet, exportPath, nil, alice)
+		json.Unmarshal(w.Body.Bytes(), &export)
+	}
+	if export.Data.Status != models.ExportReady {
+		t.Fatalf("export failed: %+v", export.Data)
+	}
+
+	w = doJSONRequestWithHeaders(t, r, http.MethodGet, exportPath+"/download", nil, alice)
+	var archive models.AccountArchive
+	if err := json.Unmarshal(w.Body.Bytes(), &archive); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("download expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if archive.Version != models.AccountArchiveVersion || archive.Profile.Email != "alice-archive@example.com" || len(archive.Tasks) != 2 ||
+		len(archive.Projects) != 1 || len(archive.Dependencies) != 1 || archive.Settings.ArchiveAfterDays != 7 {
+		t.Fatalf("unexpected archive: %s", w.Body.String())
+	}
+
+	downloaded := w.Body.Bytes()
+	req := httptest.NewRequest(http.MethodPost, "/account/import", bytes.NewReader(downloaded))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", bob["Authorization"])
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var imported struct {
+		Data models.AccountImportResult `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &imported); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("import expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+	newParentID, newChildID := imported.Data.Tasks[parent.ID], imported.Data.Tasks[child.ID]
+	if newParentID == 0 || newParentID == parent.ID || newChildID == 0 || imported.Data.Comments != 1 ||
+		imported.Data.ChecklistItems != 1 || imported.Data.Attachments != 1 || imported.Data.Dependencies != 1 {
+		t.Fatalf("unexpected import result: %s", w.Body.String())
+	}
+
+	var bobUser models.User
+	models.DB.Where("email = ?", "bob-restore@example.com").First(&bobUser)
+	var restored, restoredChild models.Task
+	models.DB.Preload("Tags").Preload("Comments").First(&restored, newParentID)
+	models.DB.First(&restoredChild, newChildID)
+	if restored.UserID != int(bobUser.ID) || restored.ProjectID == nil || *restored.ProjectID != imported.Data.Projects[project.Data.ID] ||
+		len(restored.Tags) != 1 || len(restored.Comments) != 1 || restored.Comments[0].UserID != bobUser.ID {
+		t.Fatalf("unexpected restored task: %+v", restored)
+	}
+	if restoredChild.ParentID == nil || *restoredChild.ParentID != newParentID || restoredChild.Status != models.StatusCompleted {
+		t.Fatalf("unexpected restored subtask: %+v", restoredChild)
+	}
+	var history []models.TaskStatusChange
+	models.DB.Where("task_id = ?", newChildID).Order("changed_at ASC").Find(&history)
+	if len(history) != 2 || history[1].To != models.StatusCompleted {
+		t.Fatalf("unexpected restored history: %+v", history)
+	}
+
+	archive.Version = models.AccountArchiveVersion + 1
+	w = doJSONRequestWithHeaders(t, r, http.MethodPost, "/account/import", archive, bob)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unsupported version expected 400, got %d", w.Code)
+	}
+
+	// Archives are validated like the requests that create their records
+	edited := func(edit func(archive *models.AccountArchive)) models.AccountArchive {
+		var archive models.AccountArchive
+		json.Unmarshal(downloaded, &archive)
+		edit(&archive)
+		return archive
+	}
+	invalid := map[string]models.AccountArchive{
+		"recurrence": edited(func(a *models.AccountArchive) { a.Tasks[0].Recurrence = "FREQ=DAILY\r\nX-INJECTED:1" }),
+		"category":   edited(func(a *models.AccountArchive) { a.Tasks[0].Category = strings.Repeat("c", 101) }),
+		"template": edited(func(a *models.AccountArchive) {
+			a.Templates = []models.TaskTemplate{{Name: "Empty", Items: []models.TemplateItem{{Task: " "}}}}
+		}),
+		"attachment": edited(func(a *models.AccountArchive) { a.Tasks[0].Attachments[0].URL = "plan.pdf" }),
+		"link": edited(func(a *models.AccountArchive) {
+			a.Links = []models.TaskLink{{TaskID: parent.ID, TargetID: child.ID, Type: "owns"}}
+		}),
+		"dependency": edited(func(a *models.AccountArchive) {
+			a.Dependencies = append(a.Dependencies, models.TaskDependency{TaskID: child.ID, BlockedByID: parent.ID})
+		}),
+		"parent": edited(func(a *models.AccountArchive) {
+			for i := range a.Tasks {
+				if a.Tasks[i].ID == parent.ID {
+					a.Tasks[i].ParentID = &child.ID
+				}
+			}
+		}),
+	}
+	for name, archive := range invalid {
+		if w := doJSONRequestWithHeaders(t, r, http.MethodPost, "/account/import", archive, bob); w.Code != http.StatusBadRequest {
+			t.Fatalf("archive with an invalid %s expected 400, got %d, body=%s", name, w.Code, w.Body.String())
+		}
+	}
+
+	// Only admins define custom fields, so others import tasks without them
+	withFields := edited(func(a *models.AccountArchive) {
+		a.Projects[0].Fields = []models.CustomFieldDefinition{{Key: "effort", Name: "Effort", Type: models.FieldNumber}}
+		a.Tasks[0].CustomFields = models.CustomFieldValues{"effort": 3}
+	})
+	w = doJSONRequestWithHeaders(t, r, http.MethodPost, "/account/import", withFields, bob)
+	if err := json.Unmarshal(w.Body.Bytes(), &imported); err != nil || w.Code != http.StatusOK || imported.Data.CustomFieldsDropped != 1 {
+		t.Fatalf("import with custom fields expected 200 without them, got %d, body=%s", w.Code, w.Body.String())
+	}
+	var fields int64
+	models.DB.Model(&models.CustomFieldDefinition{}).Where("key = ?", "effort").Count(&fields)
+	if fields != 0 {
+		t.Fatalf("expected no custom field to be defined, got %d", fields)
+	}
+}
+
+func TestImportTodoistAndTrello(t *testing.T) {
+	r := testRouter(t)
+	headers := registerUser(t, r, "Migrating User", "migrating@example.com")
+
+	type report struct {
+		Imported       int                  `json:"imported"`
+		TaskIDs        []uint               `json:"taskIds"`
+		Skipped        []models.ImportIssue `json:"skipped"`
+		Invalid        []models.ImportIssue `json:"invalid"`
+		DryRun         bool                 `json:"dryRun"`
+		Projects       int                  `json:"projects"`
+		Comments       int                  `json:"comments"`
+		ChecklistItems int                  `json:"checklistItems"`
+		Attachments    int                  `json:"attachments"`
+		Unmapped       map[string]int       `json:"unmapped"`
+	}
+	post := func(path, body string) report {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", headers["Authorization"])
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp struct {
+			Data report `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s expected 200, got %d, body=%s", path, w.Code, w.Body.String())
+		}
+		return resp.Data
+	}
+	countTasks := func() int64 {
+		var count int64
+		models.DB.Model(&models.Task{}).Count(&count)
+		return count
+	}
+
+	todoist := `{
+		"projects": [{"id": "p1", "name": "Home", "color": "red"}],
+		"sections": [{"id": "s1", "name": "Garden", "project_id": "p1"}],
+		"labels": [{"id": "l1", "name": "outside", "color": "green"}],
+		"items": [
+			{"id": "i2", "project_id": "p1", "parent_id": "i1", "content": "Buy seeds", "priority": 1, "checked": true, "completed_at": "2024-05-02T10:00:00Z"},
+			{"id": "i1", "project_id": "p1", "section_id": "s1", "content": "Plant tomatoes", "priority": 4, "labels": ["outside"],
+			 "due": {"date": "2024-06-01", "is_recurring": false, "string": "Jun 1"}, "responsible_uid": "u9", "added_at": "2024-05-01T09:00:00Z"},
+			{"id": 3, "project_id": "p1", "content": "  "},
+			{"id": "i4", "project_id": "p1", "content": "Gone", "is_deleted": true}
+		],
+		"notes": [{"id": "n1", "item_id": "i1", "content": "Use the raised bed", "posted_at": "2024-05-03T08:00:00Z",
+			"file_attachment": {"file_name": "bed.jpg", "file_type": "image/jpeg", "file_size": 100, "file_url": "https://files.example.com/bed.jpg"}}]
+	}`
+	preview := post("/import/todoist?dryRun=true", todoist)
+	if !preview.DryRun || preview.Imported != 2 || len(preview.TaskIDs) != 0 || countTasks() != 0 {
+		t.Fatalf("unexpected dry run: %+v", preview)
+	}
+	result := post("/import/todoist", todoist)
+	if result.Imported != 2 || result.Projects != 1 || result.Comments != 1 || result.Attachments != 1 ||
+		len(result.Invalid) != 1 || result.Invalid[0].Index != 2 {
+		t.Fatalf("unexpected Todoist import: %+v", result)
+	}
+	for _, field := range []string{"projects.color", "labels.color", "items.due.string", "items.responsible_uid"} {
+		if result.Unmapped[field] != 1 {
+			t.Fatalf("expected %s to be reported unmapped: %+v", field, result.Unmapped)
+		}
+	}
+	var seeds, tomatoes models.Task
+	models.DB.First(&seeds, result.TaskIDs[0])
+	models.DB.Preload("Tags").Preload("Project").First(&tomatoes, result.TaskIDs[1])
+	if tomatoes.Category != "Garden" || tomatoes.Priority != models.PriorityHigh || tomatoes.DueDate == nil || len(tomatoes.Tags) != 1 ||
+		tomatoes.Project == nil || tomatoes.Project.Name != "Home" || tomatoes.CreatedAt.Format("2006-01-02") != "2024-05-01" {
+		t.Fatalf("unexpected Todoist task: %+v", tomatoes)
+	}
+	if seeds.ParentID == nil || *seeds.ParentID != tomatoes.ID || seeds.Status != models.StatusCompleted {
+		t.Fatalf("unexpected Todoist subtask: %+v", seeds)
+	}
+	if again := post("/import/todoist", todoist); again.Imported != 0 || len(again.Skipped) != 2 || again.Projects != 0 {
+		t.Fatalf("unexpected repeated import: %+v", again)
+	}
+	cyclic := post("/import/todoist", `{"items": [
+		{"id": "c1", "parent_id": "c2", "content": "One"},
+		{"id": "c2", "parent_id": "c1", "content": "Two"},
+		{"id": "c3", "parent_id": "c3", "content": "Self"}]}`)
+	if cyclic.Imported != 3 || len(cyclic.Invalid) != 2 || cyclic.Invalid[0].Index != 1 || cyclic.Invalid[1].Index != 2 {
+		t.Fatalf("unexpected import of cyclic parents: %+v", cyclic)
+	}
+	duplicate := fmt.Sprintf("/tasks/%d/duplicate", cyclic.TaskIDs[1])
+	if w := doJSONRequestWithHeaders(t, r, http.MethodPost, duplicate, map[string]interface{}{"subtasks": true}, headers); w.Code != http.StatusCreated {
+		t.Fatalf("duplicating an imported subtree expected 201, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	trello := `{
+		"id": "b1", "name": "Launch", "desc": "Product launch", "prefs": {"background": "blue"},
+		"lists": [{"id": "l1", "name": "Doing", "closed": false}],
+		"labels": [{"id": "x1", "name": "", "color": "red"}],
+		"cards": [
+			{"id": "c1", "name": "Write post", "desc": "Draft first", "idList": "l1", "due": "2024-06-05T12:00:00.000Z", "dueComplete": false,
+			 "labels": [{"id": "x1", "name": "", "color": "red"}], "idMembers": ["m1"],
+			 "attachments": [{"id": "a1", "name": "brief.pdf", "url": "https://trello.example.com/brief.pdf", "bytes": 2048}]},
+			{"id": "c2", "name": "Old idea", "idList": "l1", "closed": true, "dueComplete": true}
+		],
+		"checklists": [
+			{"id": "k1", "idCard": "c1", "name": "Review", "checkItems": [
+				{"id": "ci2", "name": "Legal", "state": "incomplete", "pos": 2},
+				{"id": "ci1", "name": "Copy", "state": "complete", "pos": 1}]}
+		],
+		"actions": [
+			{"id": "a1", "type": "commentCard", "date": "2024-06-01T10:00:00Z", "data": {"text": "Looks good", "card": {"id": "c1"}}},
+			{"id": "a2", "type": "updateCard", "date": "2024-06-01T11:00:00Z", "data": {"card": {"id": "c1"}}}
+		]
+	}`
+	result = post("/import/trello", trello)
+	if result.Imported != 2 || result.Projects != 1 || result.Comments != 1 || result.ChecklistItems != 2 || result.Attachments != 1 {
+		t.Fatalf("unexpected Trello import: %+v", result)
+	}
+	for _, field := range []string{"prefs", "cards.idMembers", "actions[updateCard]"} {
+		if result.Unmapped[field] != 1 {
+			t.Fatalf("expected %s to be reported unmapped: %+v", field, result.Unmapped)
+		}
+	}
+	var post1, idea models.Task
+	models.DB.Preload("Tags").Preload("Checklist").First(&post1, result.TaskIDs[0])
+	models.DB.First(&idea, result.TaskIDs[1])
+	if post1.Category != "Doing" || post1.Description != "Draft first" || len(post1.Tags) != 1 || post1.Tags[0].Name != "red" ||
+		len(post1.Checklist) != 2 || post1.DueDate == nil {
+		t.Fatalf("unexpected Trello task: %+v", post1)
+	}
+	var checklist []models.ChecklistItem
+	models.DB.Where("task_id = ?", post1.ID).Order("position ASC").Find(&checklist)
+	if checklist[0].Text != "Copy" || !checklist[0].Done || checklist[1].Text != "Legal" {
+		t.Fatalf("unexpected checklist: %+v", checklist)
+	}
+	if idea.Status != models.StatusCompleted || idea.ArchivedAt == nil {
+		t.Fatalf("unexpected archived card: %+v", idea)
+	}
+
+	// Keys differing only in case decode into the same field of the board
+	mixed := post("/import/trello", `{"name": "Mixed", "cards": [], "actions": [{}, {"type": "commentCard"}], "Actions": []}`)
+	if mixed.Imported != 0 || mixed.Comments != 0 || mixed.Unmapped["actions[]"] != 1 {
+		t.Fatalf("unexpected import of mixed-case actions: %+v", mixed)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/import/trello", strings.NewReader(`{"items": []}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", headers["Authorization"])
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("non-board export expected 400, got %d", w.Code)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	t.Setenv("EVENT_HEARTBEAT_SECONDS", "1")
+	t.Setenv("EVENT_STREAMS_PER_USER", "2")
+	r := testRouter(t)
+	headers := registerUser(t, r, "Dashboard User", "dashboard@example.com")
+	var user models.User
+	models.DB.Where("email = ?", "dashboard@example.com").First(&user)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	type event struct {
+		id, name string
+		data     models.TaskEvent
+	}
+	// open starts a stream and returns a function reading its next event,
+	// or a heartbeat as an event named "heartbeat"
+	open := func(lastEventID string) (func() event, func()) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+		req.Header.Set("Authorization", headers["Authorization"])
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		// Closed streams are released once the server notices the disconnect
+		for deadline := time.Now().Add(2 * time.Second); err == nil && resp.StatusCode == http.StatusTooManyRequests && time.Now().Before(deadline); {
+			resp.Body.Close()
+			time.Sleep(10 * time.Millisecond)
+			resp, err = http.DefaultClient.Do(req)
+		}
+		if err != nil {
+			t.Fatalf("failed to open stream: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("stream expected 200 event-stream, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		scanner := bufio.NewScanner(resp.Body)
+		next := func() event {
+			t.Helper()
+			var e event
+			for scanner.Scan() {
+				line := scanner.Text()
+				switch {
+				case line == "" && e.name != "":
+					return e
+				case line == ": heartbeat":
+					return event{name: "heartbeat"}
+				case strings.HasPrefix(line, "id: "):
+					e.id = strings.TrimPrefix(line, "id: ")
+				case strings.HasPrefix(line, "event: "):
+					e.name = strings.TrimPrefix(line, "event: ")
+				case strings.HasPrefix(line, "data: "):
+					json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e.data)
+				}
+			}
+			t.Fatalf("stream ended: %v", scanner.Err())
+			return e
+		}
+		return next, func() { resp.Body.Close() }
+	}
+	do := func(method, path string, body interface{}) {
+		t.Helper()
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(body)
+		req, _ := http.NewRequest(method, server.URL+path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", headers["Authorization"])
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil || resp.StatusCode >= 300 {
+			t.Fatalf("%s %s failed: %v %v", method, path, err, resp)
+		}
+		resp.Body.Close()
+	}
+
+	next, closeStream := open("")
+	do(http.MethodPost, "/tasks", map[string]interface{}{"task": "Watch me", "userId": user.ID})
+	created := next()
+	if created.name != models.EventTaskCreated || created.data.Task.Task != "Watch me" || created.data.ActorID != user.ID || created.id == "" {
+		t.Fatalf("unexpected created event: %+v", created)
+	}
+	taskID := created.data.TaskID
+	do(http.MethodPut, fmt.Sprintf("/tasks/%d/complete", taskID), nil)
+	do(http.MethodDelete, fmt.Sprintf("/tasks/%d", taskID), nil)
+	if completed := next(); completed.name != models.EventTaskCompleted || completed.data.Task.Status != models.StatusCompleted {
+		t.Fatalf("unexpected completed event: %+v", completed)
+	}
+	if deleted := next(); deleted.name != models.EventTaskDeleted || deleted.data.TaskID != taskID {
+		t.Fatalf("unexpected deleted event: %+v", deleted)
+	}
+	if heartbeat := next(); heartbeat.name != "heartbeat" {
+		t.Fatalf("expected a heartbeat, got %+v", heartbeat)
+	}
+
+	// Resuming replays what came after the last event seen
+	resumed, closeResumed := open(created.id)
+	if e := resumed(); e.name != models.EventTaskCompleted {
+		t.Fatalf("expected the completed event to be replayed, got %+v", e)
+	}
+	if e := resumed(); e.name != models.EventTaskDeleted {
+		t.Fatalf("expected the deleted event to be replayed, got %+v", e)
+	}
+
+	// Streams are capped per user
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+	req.Header.Set("Authorization", headers["Authorization"])
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("third stream expected 429, got %v %v", err, resp)
+	}
+	closeStream()
+	closeResumed()
+
+	// An ID that is not in the buffer asks the client to reload
+	unknown, closeUnknown := open("1")
+	if e := unknown(); e.name != "reset" {
+		t.Fatalf("expected a reset event, got %+v", e)
+	}
+	closeUnknown()
+
+	// Event streams are left out of the rate limit
+	limited := gin.New()
+	limited.Use(middleware.RateLimitMiddleware(0, 1, "/events"))
+	limited.GET("/events", func(c *gin.Context) { c.Status(http.StatusOK) })
+	limited.GET("/tasks", func(c *gin.Context) { c.Status(http.StatusOK) })
+	for i, path := range []string{"/tasks", "/tasks", "/events", "/events"} {
+		w := httptest.NewRecorder()
+		limited.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if want := map[bool]int{true: http.StatusTooManyRequests, false: http.StatusOK}[i == 1]; w.Code != want {
+			t.Fatalf("request %d to %s expected %d, got %d", i, path, want, w.Code)
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	t.Setenv("WS_CONNECTIONS_PER_USER", "1")
+	t.Setenv("WS_MESSAGES_PER_SECOND", "10")
+	r := testRouter(t)
+	headers := registerUser(t, r, "Desktop User", "desktop@example.com")
+	var user models.User
+	models.DB.Where("email = ?", "desktop@example.com").First(&user)
+	server := httptest.NewServer(r)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("dial without a token expected 401, got %v %v", err, resp)
+	}
+
+	type message struct {
+		Type   string           `json:"type"`
+		ID     string           `json:"id"`
+		OK     bool             `json:"ok"`
+		Status int              `json:"status"`
+		Data   models.Task      `json:"data"`
+		Error  string           `json:"error"`
+		Event  models.TaskEvent `json:"event"`
+	}
+	dial := func(query string) *websocket.Conn {
+		t.Helper()
+		header := http.Header{"Authorization": {headers["Authorization"]}}
+		conn, resp, err := websocket.DefaultDialer.Dial(wsURL+query, header)
+		// Closed sockets are released once the server notices the disconnect
+		for deadline := time.Now().Add(2 * time.Second); err != nil && resp != nil && resp.StatusCode == http.StatusTooManyRequests && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+			conn, resp, err = websocket.DefaultDialer.Dial(wsURL+query, header)
+		}
+		if err != nil {
+			t.Fatalf("failed to dial: %v %v", err, resp)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn
+	}
+	conn := dial("")
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Authorization": {headers["Authorization"]}}); err == nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("second socket expected 429, got %v %v", err, resp)
+	}
+
+	// Events and acks may arrive in either order, so events read while
+	// waiting for an ack are kept for next
+	var pending []message
+	read := func() message {
+		t.Helper()
+		var m message
+		if err := conn.ReadJSON(&m); err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		return m
+	}
+	send := func(request map[string]interface{}) message {
+		t.Helper()
+		if err := conn.WriteJSON(request); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+		for {
+			m := read()
+			if m.Type == "ack" && m.ID == request["id"] {
+				return m
+			}
+			pending = append(pending, m)
+		}
+	}
+	next := func() message {
+		t.Helper()
+		if len(pending) > 0 {
+			m := pending[0]
+			pending = pending[1:]
+			return m
+		}
+		return read()
+	}
+
+	if ack := send(map[string]interface{}{"id": "1", "type": "subscribe", "topic": "category:Ops"}); !ack.OK || ack.Status != http.StatusOK {
+		t.Fatalf("subscribe failed: %+v", ack)
+	}
+	if ack := send(map[string]interface{}{"id": "2", "type": "subscribe", "topic": "project:x"}); ack.OK || ack.Status != http.StatusBadRequest {
+		t.Fatalf("invalid topic expected a 400 ack, got %+v", ack)
+	}
+	if ack := send(map[string]interface{}{"id": "3", "type": "create", "task": map[string]interface{}{"task": "Unwatched", "category": "Home", "userId": user.ID}}); !ack.OK || ack.Status != http.StatusCreated {
+		t.Fatalf("create failed: %+v", ack)
+	}
+	created := send(map[string]interface{}{"id": "4", "type": "create", "task": map[string]interface{}{"task": "Rotate keys", "category": "Ops", "userId": user.ID}})
+	if !created.OK || created.Status != http.StatusCreated || created.Data.ID == 0 {
+		t.Fatalf("create failed: %+v", created)
+	}
+	taskID := created.Data.ID
+	// Only the task in the subscribed category is sent
+	event := next()
+	if event.Type != "event" || event.Event.Type != models.EventTaskCreated || event.Event.TaskID != taskID || event.Event.ActorID != user.ID {
+		t.Fatalf("unexpected created event: %+v", event)
+	}
+	createdEventID := event.Event.ID
+
+	if ack := send(map[string]interface{}{"id": "5", "type": "update", "taskId": taskID, "task": map[string]interface{}{"priority": "high"}}); !ack.OK || ack.Data.Priority != models.PriorityHigh {
+		t.Fatalf("update failed: %+v", ack)
+	}
+	if e := next(); e.Event.Type != models.EventTaskUpdated || e.Event.Task.Priority != models.PriorityHigh {
+		t.Fatalf("unexpected updated event: %+v", e)
+	}
+	if ack := send(map[string]interface{}{"id": "6", "type": "complete", "taskId": taskID}); !ack.OK || ack.Data.Status != models.StatusCompleted {
+		t.Fatalf("complete failed: %+v", ack)
+	}
+	if e := next(); e.Event.Type != models.EventTaskCompleted {
+		t.Fatalf("unexpected completed event: %+v", e)
+	}
+
+	// Failures are acknowledged with the status of the equivalent request
+	failures := []struct {
+		request map[string]interface{}
+		status  int
+	}{
+		{map[string]interface{}{"id": "7", "type": "create", "task": map[string]interface{}{"category": "Ops"}}, http.StatusBadRequest},
+		{map[string]interface{}{"id": "8", "type": "update", "taskId": taskID, "task": map[string]interface{}{"priority": "urgent"}}, http.StatusBadRequest},
+		{map[string]interface{}{"id": "9", "type": "complete", "taskId": 99999}, http.StatusNotFound},
+		{map[string]interface{}{"id": "10", "type": "delete", "taskId": taskID}, http.StatusBadRequest},
+	}
+	for _, tt := range failures {
+		if ack := send(tt.request); ack.OK || ack.Status != tt.status || ack.Error == "" {
+			t.Fatalf("%v expected a %d ack, got %+v", tt.request, tt.status, ack)
+		}
+	}
+	// Malformed messages do not close the socket
+	conn.WriteMessage(websocket.TextMessage, []byte("not json"))
+	if m := next(); m.Type != "ack" || m.Status != http.StatusBadRequest {
+		t.Fatalf("malformed message expected a 400 ack, got %+v", m)
+	}
+
+	// Requests beyond the rate limit are refused
+	limited := false
+	for i := 0; i < 50 && !limited; i++ {
+		ack := send(map[string]interface{}{"id": fmt.Sprintf("burst-%d", i), "type": "unsubscribe", "topic": "tasks"})
+		limited = ack.Status == http.StatusTooManyRequests
+	}
+	if !limited {
+		t.Fatalf("expected requests to be rate limited")
+	}
+	conn.Close()
+
+	// Reconnecting with the last event seen replays the later ones for the
+	// topics given on connect
+	conn = dial(fmt.Sprintf("?topics=task:%d&lastEventId=%d", taskID, createdEventID))
+	defer conn.Close()
+	pending = nil
+	if e := next(); e.Event.Type != models.EventTaskUpdated {
+		t.Fatalf("expected the updated event to be replayed, got %+v", e)
+	}
+	if e := next(); e.Event.Type != models.EventTaskCompleted {
+		t.Fatalf("expected the completed event to be replayed, got %+v", e)
+	}
+}
@@ -13,10 +13,12 @@ func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, Last-Event-ID")
 		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
 
-		if c.Request.Method == "OPTIONS" {
+		// Only preflight requests are answered here; other OPTIONS requests,
+		// such as CalDAV capability discovery, reach their handlers
+		if c.Request.Method == "OPTIONS" && c.GetHeader("Access-Control-Request-Method") != "" {
 			c.AbortWithStatus(204)
 			return
 		}
@@ -38,10 +40,20 @@ func SecurityHeadersMiddleware() gin.HandlerFunc {
 	}
 }
 
-// RateLimitMiddleware implements rate limiting
-func RateLimitMiddleware(r rate.Limit, b int) gin.HandlerFunc {
+// RateLimitMiddleware implements rate limiting. Requests to the exempt
+// paths, such as long-lived event streams whose clients give up on a 429
+// when reconnecting, are not counted; their handlers limit them instead.
+func RateLimitMiddleware(r rate.Limit, b int, exempt ...string) gin.HandlerFunc {
 	limiter := rate.NewLimiter(r, b)
+	exempted := make(map[string]bool, len(exempt))
+	for _, path := range exempt {
+		exempted[path] = true
+	}
 	return func(c *gin.Context) {
+		if exempted[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
 		if !limiter.Allow() {
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error":       "Rate limit exceeded",
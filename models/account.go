@@ -0,0 +1,561 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KingLeak95/todo-list-go/pkg/ical"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+// AccountArchiveVersion is the format version of account archives. Imports
+// accept archives up to this version.
+const AccountArchiveVersion = 1
+
+// AccountExportStatus tracks an export job
+type AccountExportStatus string
+
+const (
+	ExportPending AccountExportStatus = "pending"
+	ExportReady   AccountExportStatus = "ready"
+	ExportFailed  AccountExportStatus = "failed"
+)
+
+// accountExportSlots bounds how many archives are built at once, to
+// EXPORT_WORKERS (default 2)
+var accountExportSlots = make(chan struct{}, getEnvInt("EXPORT_WORKERS", 2))
+
+// accountExportTimeout is how long a pending export is waited for before a
+// new request replaces it, such as one interrupted by a restart
+const accountExportTimeout = time.Hour
+
+// AccountExport is a job building the archive of a user's data. Requesting
+// an export replaces the user's earlier ones.
+type AccountExport struct {
+	ID          uint                `gorm:"primarykey" json:"id"`
+	UserID      uint                `gorm:"index" json:"userId"`
+	Status      AccountExportStatus `gorm:"type:varchar(20)" json:"status"`
+	Error       string              `gorm:"type:text" json:"error,omitempty"`
+	Archive     []byte              `json:"-"`
+	Size        int                 `json:"size"`
+	CreatedAt   time.Time           `json:"createdAt"`
+	CompletedAt *time.Time          `json:"completedAt,omitempty"`
+}
+
+// AccountArchive is everything a user owns. Tasks carry their tags,
+// checklist, attachment metadata and comments; dependencies, links and
+// status history are limited to the archived tasks. IDs are those of the
+// exporting instance and are remapped on import.
+type AccountArchive struct {
+	Version       int                `json:"version"`
+	ExportedAt    time.Time          `json:"exportedAt"`
+	Profile       ArchiveProfile     `json:"profile"`
+	Settings      ArchiveSettings    `json:"settings"`
+	Projects      []Project          `json:"projects"`
+	Templates     []TaskTemplate     `json:"templates"`
+	Tasks         []Task             `json:"tasks"`
+	Dependencies  []TaskDependency   `json:"dependencies"`
+	Links         []TaskLink         `json:"links"`
+	StatusHistory []TaskStatusChange `json:"statusHistory"`
+}
+
+type ArchiveProfile struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Handle    *string   `json:"handle,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type ArchiveSettings struct {
+	ArchiveAfterDays int `json:"archiveAfterDays"`
+}
+
+// AccountImportResult reports a restored archive. The ID maps take the IDs
+// of the archive to those of the created records.
+type AccountImportResult struct {
+	Projects map[uint]uint `json:"projects"`
+	// CustomFieldsDropped counts the field definitions left out, with their
+	// values, because only admins define custom fields
+	CustomFieldsDropped int           `json:"customFieldsDropped,omitempty"`
+	Templates           int           `json:"templates"`
+	Tasks               map[uint]uint `json:"tasks"`
+	Comments            int           `json:"comments"`
+	ChecklistItems      int           `json:"checklistItems"`
+	Attachments         int           `json:"attachments"`
+	Dependencies        int           `json:"dependencies"`
+	Links               int           `json:"links"`
+}
+
+// RequestAccountExport starts building an archive of the caller's data
+// @Summary Request an account export
+// @Description Builds a versioned JSON archive of the caller's profile, settings, projects, templates and tasks with their comments, checklists, attachment metadata, dependencies, links and status history in the background. Poll the returned export until it is ready, then download it. Earlier exports are discarded, except that while one is still being built it is returned instead of starting another.
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Success 202 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /account/export [post]
+func RequestAccountExport(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	export := AccountExport{UserID: userID, Status: ExportPending}
+	started := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// Each user builds one archive at a time
+		err := tx.Where("user_id = ? AND status = ? AND created_at > ?", userID, ExportPending, time.Now().Add(-accountExportTimeout)).
+			Order("id DESC").First(&export).Error
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&AccountExport{}).Error; err != nil {
+			return err
+		}
+		started = true
+		return tx.Create(&export).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create export", "details": err.Error()})
+		return
+	}
+	if started {
+		go runAccountExport(DB, export)
+	}
+
+	c.Header("Location", "/account/export/"+strconv.FormatUint(uint64(export.ID), 10))
+	c.JSON(http.StatusAccepted, gin.H{"data": export})
+}
+
+// GetAccountExport reports the progress of one of the caller's exports
+// @Summary Get an account export
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Export ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /account/export/{id} [get]
+func GetAccountExport(c *gin.Context) {
+	export, ok := findAccountExport(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": export})
+}
+
+// DownloadAccountExport returns the archive of a ready export
+// @Summary Download an account export
+// @Tags account
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Export ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 409 {object} map[string]interface{}
+// @Router /account/export/{id}/download [get]
+func DownloadAccountExport(c *gin.Context) {
+	export, ok := findAccountExport(c)
+	if !ok {
+		return
+	}
+	if export.Status != ExportReady {
+		c.JSON(http.StatusConflict, gin.H{"error": "Export is not ready", "details": fmt.Sprintf("export is %s", export.Status)})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="account-export-%d.json"`, export.ID))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", export.Archive)
+}
+
+// ImportAccount restores an account archive into the caller's account
+// @Summary Import an account archive
+// @Description Upload an archive from GET /account/export/{id}/download, from this or another instance, as the `file` form field or as the request body. Projects, templates and tasks with their comments, checklists, attachment metadata, dependencies, links and status history are created for the caller with new IDs, and the archived settings replace the caller's. The profile is not changed. Comments by other users of the exporting instance are kept without an author. Every record is validated like the request that creates it, and custom field definitions are only imported for admins. Nothing is imported if any part fails.
+// @Tags account
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file false "Account archive"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /account/import [post]
+func ImportAccount(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	data, err := readImportFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import", "details": err.Error()})
+		return
+	}
+	var archive AccountArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid archive", "details": err.Error()})
+		return
+	}
+	if archive.Version < 1 || archive.Version > AccountArchiveVersion {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid archive", "details": fmt.Sprintf("unsupported archive version %d", archive.Version)})
+		return
+	}
+
+	var result AccountImportResult
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = restoreAccountArchive(tx, userID, c.GetString("user_role") == "admin", archive)
+		return err
+	})
+	if err != nil {
+		var invalid *taskInputError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.message, "details": invalid.err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not import archive", "details": err.Error()})
+		}
+		return
+	}
+	taskIDs := make([]uint, 0, len(result.Tasks))
+	for _, id := range result.Tasks {
+		taskIDs = append(taskIDs, id)
+	}
+	publishCreatedTasks(DB, userID, taskIDs)
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+func findAccountExport(c *gin.Context) (AccountExport, bool) {
+	var export AccountExport
+	userID, _ := currentUserID(c)
+	if err := DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&export).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve export"})
+		}
+		return export, false
+	}
+	return export, true
+}
+
+// runAccountExport builds the archive of an export once a slot is free and
+// records the outcome. A panic fails the export rather than the server.
+func runAccountExport(db *gorm.DB, export AccountExport) {
+	accountExportSlots <- struct{}{}
+	defer func() { <-accountExportSlots }()
+
+	now := time.Now()
+	updates := map[string]interface{}{"completed_at": now}
+	data, err := func() (data []byte, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("export panicked: %v", r)
+			}
+		}()
+		archive, err := buildAccountArchive(db, export.UserID, now)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(archive)
+	}()
+	if err == nil {
+		updates["status"], updates["archive"], updates["size"] = ExportReady, data, len(data)
+	} else {
+		log.Printf("exporting account %d: %v", export.UserID, err)
+		updates["status"], updates["error"] = ExportFailed, err.Error()
+	}
+	if err := db.Model(&AccountExport{}).Where("id = ?", export.ID).Updates(updates).Error; err != nil {
+		log.Printf("saving export %d: %v", export.ID, err)
+	}
+}
+
+// buildAccountArchive reads everything a user owns
+func buildAccountArchive(db *gorm.DB, userID uint, now time.Time) (AccountArchive, error) {
+	archive := AccountArchive{Version: AccountArchiveVersion, ExportedAt: now.UTC()}
+	var user User
+	if err := db.First(&user, userID).Error; err != nil {
+		return archive, err
+	}
+	archive.Profile = ArchiveProfile{ID: user.ID, Name: user.Name, Email: user.Email, Handle: user.Handle, CreatedAt: user.CreatedAt}
+	settings, err := settingsFor(db, userID)
+	if err != nil {
+		return archive, err
+	}
+	archive.Settings = ArchiveSettings{ArchiveAfterDays: settings.ArchiveAfterDays}
+
+	if err := db.Preload("Fields").Where("owner_id = ?", userID).Order("id ASC").Find(&archive.Projects).Error; err != nil {
+		return archive, err
+	}
+	if err := db.Where("user_id = ?", userID).Order("id ASC").Find(&archive.Templates).Error; err != nil {
+		return archive, err
+	}
+	err = db.Preload("Tags").
+		Preload("Checklist", func(tx *gorm.DB) *gorm.DB { return tx.Order("position ASC, id ASC") }).
+		Preload("Attachments", func(tx *gorm.DB) *gorm.DB { return tx.Order("id ASC") }).
+		Preload("Comments", func(tx *gorm.DB) *gorm.DB { return tx.Order("created_at ASC, id ASC") }).
+		Where("user_id = ?", userID).Order("id ASC").Find(&archive.Tasks).Error
+	if err != nil {
+		return archive, err
+	}
+
+	taskIDs := make([]uint, len(archive.Tasks))
+	for i, task := range archive.Tasks {
+		taskIDs[i] = task.ID
+	}
+	archive.Dependencies, archive.Links, archive.StatusHistory = []TaskDependency{}, []TaskLink{}, []TaskStatusChange{}
+	if len(taskIDs) == 0 {
+		return archive, nil
+	}
+	if err := db.Where("task_id IN ? AND blocked_by_id IN ?", taskIDs, taskIDs).Order("id ASC").Find(&archive.Dependencies).Error; err != nil {
+		return archive, err
+	}
+	if err := db.Where("task_id IN ? AND target_id IN ?", taskIDs, taskIDs).Order("id ASC").Find(&archive.Links).Error; err != nil {
+		return archive, err
+	}
+	err = db.Where("task_id IN ?", taskIDs).Order("task_id ASC, changed_at ASC, id ASC").Find(&archive.StatusHistory).Error
+	return archive, err
+}
+
+// restoreAccountArchive creates the records of an archive for a user,
+// checking each like the request that would create it. Custom field
+// definitions are only created for admins. Invalid content returns a
+// *taskInputError.
+func restoreAccountArchive(tx *gorm.DB, userID uint, admin bool, archive AccountArchive) (AccountImportResult, error) {
+	result := AccountImportResult{Projects: map[uint]uint{}, Tasks: map[uint]uint{}}
+	// authorID maps the authors of archived comments; only the archive
+	// owner is known on this side
+	authorID := func(id uint) uint {
+		if id == archive.Profile.ID {
+			return userID
+		}
+		return 0
+	}
+
+	if err := validateArchived("settings", UpdateSettingsRequest{ArchiveAfterDays: &archive.Settings.ArchiveAfterDays}); err != nil {
+		return result, err
+	}
+	settings, err := settingsFor(tx, userID)
+	if err != nil {
+		return result, err
+	}
+	settings.ArchiveAfterDays = archive.Settings.ArchiveAfterDays
+	if err := tx.Save(&settings).Error; err != nil {
+		return result, err
+	}
+
+	for _, archived := range archive.Projects {
+		if err := validateArchived(fmt.Sprintf("project %d", archived.ID), NewProject{Name: archived.Name, Description: archived.Description}); err != nil {
+			return result, err
+		}
+		project := Project{Name: archived.Name, Description: archived.Description, OwnerID: userID}
+		project.CreatedAt, project.UpdatedAt = archived.CreatedAt, archived.UpdatedAt
+		if err := tx.Create(&project).Error; err != nil {
+			return result, err
+		}
+		result.Projects[archived.ID] = project.ID
+		if !admin {
+			result.CustomFieldsDropped += len(archived.Fields)
+			continue
+		}
+		for _, field := range archived.Fields {
+			field.ID, field.ProjectID = 0, &project.ID
+			if err := validateCustomFieldDefinition(tx, field); err != nil {
+				return result, &taskInputError{"Invalid custom field", fmt.Errorf("project %q: %v", archived.Name, err)}
+			}
+			if err := tx.Create(&field).Error; err != nil {
+				return result, err
+			}
+		}
+	}
+
+	for _, template := range archive.Templates {
+		if err := validateArchived(fmt.Sprintf("template %d", template.ID), NewTaskTemplate{Name: template.Name, Description: template.Description, Items: template.Items}); err != nil {
+			return result, err
+		}
+		if err := validateTemplateItems(template.Items); err != nil {
+			return result, &taskInputError{"Invalid template", fmt.Errorf("template %d: %v", template.ID, err)}
+		}
+		template.ID, template.UserID = 0, userID
+		if err := tx.Create(&template).Error; err != nil {
+			return result, err
+		}
+		result.Templates++
+	}
+
+	history := make(map[uint][]TaskStatusChange)
+	for _, change := range archive.StatusHistory {
+		history[change.TaskID] = append(history[change.TaskID], change)
+	}
+	for _, archived := range archive.Tasks {
+		task := Task{
+			Task:        archived.Task,
+			Description: archived.Description,
+			Priority:    archived.Priority,
+			Status:      archived.Status,
+			DueDate:     archived.DueDate,
+			Category:    archived.Category,
+			Completed:   archived.Completed,
+			UserID:      int(userID),
+			CompletedAt: archived.CompletedAt,
+			ArchivedAt:  archived.ArchivedAt,
+			DeferUntil:  archived.DeferUntil,
+			Recurrence:  archived.Recurrence,
+			ExternalID:  archived.ExternalID,
+		}
+		task.CreatedAt, task.UpdatedAt = archived.CreatedAt, archived.UpdatedAt
+		if task.Priority == "" {
+			task.Priority = PriorityMedium
+		}
+		if !task.Priority.Valid() || (task.Status != "" && !task.Status.Valid()) {
+			return result, &taskInputError{"Invalid task", fmt.Errorf("task %d has priority %q and status %q", archived.ID, task.Priority, task.Status)}
+		}
+		if _, err := migratedTask(task.Task, task.Description, task.Category); err != nil {
+			return result, &taskInputError{"Invalid task", fmt.Errorf("task %d: %v", archived.ID, err)}
+		}
+		if task.Recurrence != "" {
+			if err := ical.ValidateRecurrence(task.Recurrence); err != nil {
+				return result, &taskInputError{"Invalid task", fmt.Errorf("task %d: invalid recurrence: %v", archived.ID, err)}
+			}
+		}
+		if archived.ProjectID != nil {
+			if id, ok := result.Projects[*archived.ProjectID]; ok {
+				task.ProjectID = &id
+			}
+		}
+		// Values of fields that were not imported are dropped with them
+		if task.ProjectID != nil && admin {
+			customFields, err := resolveCustomFields(tx, task.ProjectID, nil, archived.CustomFields)
+			if err != nil {
+				return result, &taskInputError{"Invalid custom fields", fmt.Errorf("task %d: %v", archived.ID, err)}
+			}
+			task.CustomFields = customFields
+		}
+		tagNames := make([]string, len(archived.Tags))
+		for i, tag := range archived.Tags {
+			tagNames[i] = tag.Name
+		}
+		if err := createImportedTask(tx, &task, tagNames); err != nil {
+			return result, err
+		}
+		result.Tasks[archived.ID] = task.ID
+
+		// The archived history replaces the entry recorded on creation
+		if changes := history[archived.ID]; len(changes) > 0 {
+			if err := tx.Where("task_id = ?", task.ID).Delete(&TaskStatusChange{}).Error; err != nil {
+				return result, err
+			}
+			for _, change := range changes {
+				change.ID, change.TaskID = 0, task.ID
+				if err := tx.Create(&change).Error; err != nil {
+					return result, err
+				}
+			}
+		}
+		for _, item := range archived.Checklist {
+			if err := validateArchived(fmt.Sprintf("checklist item %d", item.ID), NewChecklistItem{Text: item.Text}); err != nil {
+				return result, err
+			}
+			item.ID, item.TaskID = 0, task.ID
+			if err := tx.Create(&item).Error; err != nil {
+				return result, err
+			}
+			result.ChecklistItems++
+		}
+		for _, attachment := range archived.Attachments {
+			input := NewAttachment{FileName: attachment.FileName, ContentType: attachment.ContentType, Size: attachment.Size, URL: attachment.URL}
+			if err := validateArchived(fmt.Sprintf("attachment %d", attachment.ID), input); err != nil {
+				return result, err
+			}
+			attachment.ID, attachment.TaskID, attachment.DeletedAt = 0, task.ID, gorm.DeletedAt{}
+			if err := tx.Create(&attachment).Error; err != nil {
+				return result, err
+			}
+			result.Attachments++
+		}
+		for _, comment := range archived.Comments {
+			if err := validateArchived(fmt.Sprintf("comment %d", comment.ID), NewComment{Body: comment.Body}); err != nil {
+				return result, err
+			}
+			comment.ID, comment.TaskID, comment.UserID, comment.DeletedAt = 0, task.ID, authorID(comment.UserID), gorm.DeletedAt{}
+			if err := tx.Create(&comment).Error; err != nil {
+				return result, err
+			}
+			result.Comments++
+		}
+	}
+
+	// Parents are set once every task exists, since a subtask may have been
+	// archived before its parent. Parents outside the archive are dropped.
+	for _, archived := range archive.Tasks {
+		if archived.ParentID == nil {
+			continue
+		}
+		if parentID, ok := result.Tasks[*archived.ParentID]; ok {
+			taskID := result.Tasks[archived.ID]
+			cycle, err := isAncestor(tx, parentID, taskID)
+			if err != nil {
+				return result, err
+			}
+			if cycle {
+				return result, &taskInputError{"Invalid task", fmt.Errorf("task %d with parent %d would be its own subtask", archived.ID, *archived.ParentID)}
+			}
+			if err := tx.Model(&Task{}).Where("id = ?", taskID).UpdateColumn("parent_id", parentID).Error; err != nil {
+				return result, err
+			}
+		}
+	}
+	for _, dependency := range archive.Dependencies {
+		taskID, ok := result.Tasks[dependency.TaskID]
+		blockerID, found := result.Tasks[dependency.BlockedByID]
+		if !ok || !found {
+			continue
+		}
+		cycle, err := dependsOn(tx, blockerID, taskID)
+		if err != nil {
+			return result, err
+		}
+		if cycle {
+			return result, &taskInputError{"Invalid dependency", fmt.Errorf("task %d blocked by %d would create a cycle", dependency.TaskID, dependency.BlockedByID)}
+		}
+		restored := TaskDependency{TaskID: taskID, BlockedByID: blockerID, CreatedAt: dependency.CreatedAt}
+		if err := tx.Create(&restored).Error; err != nil {
+			return result, err
+		}
+		result.Dependencies++
+	}
+	for _, link := range archive.Links {
+		taskID, ok := result.Tasks[link.TaskID]
+		targetID, found := result.Tasks[link.TargetID]
+		if !ok || !found {
+			continue
+		}
+		if !link.Type.Valid() || taskID == targetID {
+			return result, &taskInputError{"Invalid link", fmt.Errorf("task %d cannot link to %d as %q", link.TaskID, link.TargetID, link.Type)}
+		}
+		restored := TaskLink{TaskID: taskID, TargetID: targetID, Type: link.Type, CreatedAt: link.CreatedAt}
+		if err := tx.Create(&restored).Error; err != nil {
+			return result, err
+		}
+		result.Links++
+	}
+	return result, nil
+}
+
+// validateArchived checks a record of an archive with the binding of the
+// request that creates it
+func validateArchived(what string, input interface{}) error {
+	if err := binding.Validator.ValidateStruct(input); err != nil {
+		return &taskInputError{"Invalid archive", fmt.Errorf("%s: %v", what, err)}
+	}
+	return nil
+}
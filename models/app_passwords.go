@@ -0,0 +1,228 @@
+package models
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KingLeak95/todo-list-go/pkg/auth"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AppPassword lets a device sign in with HTTP Basic auth, for clients such
+// as CalDAV apps that cannot use bearer tokens. Only a hash is stored, along
+// with the first group of the password, which is not part of the secret and
+// finds the one hash to check.
+type AppPassword struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	UserID       uint       `gorm:"index;index:idx_app_passwords_prefix,priority:1" json:"userId"`
+	Name         string     `gorm:"type:varchar(100)" json:"name"`
+	Prefix       string     `gorm:"type:varchar(8);index:idx_app_passwords_prefix,priority:2" json:"prefix"`
+	PasswordHash string     `json:"-"`
+	LastUsedAt   *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+type NewAppPassword struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+// appPasswordAlphabet avoids characters that are easily confused when
+// typed on a phone
+const appPasswordAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+const (
+	// appPasswordPrefixLength is the length of the lookup prefix, which is
+	// followed by 16 secret characters
+	appPasswordPrefixLength = 4
+	maxAppPasswords         = 20
+)
+
+// GetAppPasswords lists the caller's app passwords
+// @Summary List app passwords
+// @Tags app-passwords
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /app-passwords [get]
+func GetAppPasswords(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	var passwords []AppPassword
+	if err := DB.Where("user_id = ?", userID).Order("id ASC").Find(&passwords).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve app passwords"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": passwords})
+}
+
+// CreateAppPassword generates an app password for the caller. The password
+// is only returned in this response.
+// @Summary Create an app password
+// @Description Generates a password for signing in to CalDAV with your email address. Each user may have a limited number.
+// @Tags app-passwords
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param password body NewAppPassword true "Device name"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /app-passwords [post]
+func CreateAppPassword(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	var input NewAppPassword
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+		return
+	}
+
+	var passwords []AppPassword
+	if err := DB.Select("prefix").Where("user_id = ?", userID).Find(&passwords).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve app passwords"})
+		return
+	}
+	if len(passwords) >= maxAppPasswords {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many app passwords", "details": fmt.Sprintf("at most %d app passwords may exist per user; revoke one first", maxAppPasswords)})
+		return
+	}
+	taken := make(map[string]bool, len(passwords))
+	for _, p := range passwords {
+		taken[p.Prefix] = true
+	}
+
+	password, err := generateAppPassword()
+	for err == nil && taken[appPasswordPrefix(password)] {
+		password, err = generateAppPassword()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate password"})
+		return
+	}
+	hash, err := auth.HashPassword(normalizeAppPassword(password))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash password"})
+		return
+	}
+	record := AppPassword{UserID: userID, Name: input.Name, Prefix: appPasswordPrefix(password), PasswordHash: hash}
+	if err := DB.Create(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create app password", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": gin.H{
+		"id":        record.ID,
+		"name":      record.Name,
+		"prefix":    record.Prefix,
+		"password":  password,
+		"createdAt": record.CreatedAt,
+	}})
+}
+
+// DeleteAppPassword revokes one of the caller's app passwords
+// @Summary Revoke an app password
+// @Tags app-passwords
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "App password ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /app-passwords/{id} [delete]
+func DeleteAppPassword(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	result := DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&AppPassword{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke app password"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "App password not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": c.Param("id")})
+}
+
+// AppPasswordAuth authenticates requests with HTTP Basic auth using the
+// user's email address and one of their app passwords, setting the same
+// context keys as the JWT middleware. The password's prefix selects the
+// single hash it is checked against.
+func AppPasswordAuth(realm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, password, ok := c.Request.BasicAuth()
+		var user User
+		var match AppPassword
+		if ok {
+			err := DB.Where("LOWER(email) = ?", strings.ToLower(email)).First(&user).Error
+			if err == nil {
+				err = DB.Where("user_id = ? AND prefix = ?", user.ID, appPasswordPrefix(password)).First(&match).Error
+			}
+			if err != nil && err != gorm.ErrRecordNotFound {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check credentials"})
+				c.Abort()
+				return
+			}
+			ok = err == nil && auth.CheckPasswordHash(normalizeAppPassword(password), match.PasswordHash)
+		}
+		if !ok {
+			c.Header("WWW-Authenticate", `Basic realm="`+realm+`", charset="UTF-8"`)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+
+		DB.Model(&match).UpdateColumn("last_used_at", time.Now())
+		c.Set("user_id", user.ID)
+		c.Set("user_email", user.Email)
+		c.Set("user_role", user.Role)
+		c.Next()
+	}
+}
+
+// generateAppPassword returns 20 random characters in groups of four, the
+// first of which is the lookup prefix
+func generateAppPassword() (string, error) {
+	var b strings.Builder
+	max := big.NewInt(int64(len(appPasswordAlphabet)))
+	for i := 0; i < appPasswordPrefixLength+16; i++ {
+		if i > 0 && i%4 == 0 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(appPasswordAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// normalizeAppPassword ignores the grouping and case of a typed password
+func normalizeAppPassword(password string) string {
+	password = strings.ReplaceAll(password, "-", "")
+	password = strings.ReplaceAll(password, " ", "")
+	return strings.ToLower(password)
+}
+
+// appPasswordPrefix returns the lookup prefix of a typed password
+func appPasswordPrefix(password string) string {
+	normalized := normalizeAppPassword(password)
+	if len(normalized) < appPasswordPrefixLength {
+		return normalized
+	}
+	return normalized[:appPasswordPrefixLength]
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ArchiveCompletedTasks archives the tasks that were completed longer ago
+// than their owner's ArchiveAfterDays setting and returns how many were
+// archived. Tasks must also be untouched for that long, so a task that was
+// unarchived or edited is not archived again straight away.
+func ArchiveCompletedTasks(db *gorm.DB, now time.Time) (int64, error) {
+	var settings []UserSettings
+	if err := db.Find(&settings).Error; err != nil {
+		return 0, err
+	}
+
+	// Group users by retention so each distinct value costs one update
+	usersByDays := make(map[int][]uint)
+	var configured []uint
+	for _, s := range settings {
+		configured = append(configured, s.UserID)
+		if s.ArchiveAfterDays > 0 {
+			usersByDays[s.ArchiveAfterDays] = append(usersByDays[s.ArchiveAfterDays], s.UserID)
+		}
+	}
+
+	archive := func(days int, scope func(*gorm.DB) *gorm.DB) (int64, error) {
+		cutoff := now.AddDate(0, 0, -days)
+		result := scope(db.Model(&Task{})).
+			Where("status = ? AND archived_at IS NULL", StatusCompleted).
+			Where("COALESCE(completed_at, updated_at) < ? AND updated_at < ?", cutoff, cutoff).
+			UpdateColumn("archived_at", now)
+		return result.RowsAffected, result.Error
+	}
+
+	total, err := archive(DefaultArchiveAfterDays, func(tx *gorm.DB) *gorm.DB {
+		if len(configured) == 0 {
+			return tx
+		}
+		return tx.Where("user_id NOT IN ?", configured)
+	})
+	if err != nil {
+		return total, err
+	}
+	for days, userIDs := range usersByDays {
+		n, err := archive(days, func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("user_id IN ?", userIDs)
+		})
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// StartArchiver runs ArchiveCompletedTasks in the background, immediately
+// and then every ARCHIVE_INTERVAL_MINUTES (default 60)
+func StartArchiver(db *gorm.DB) {
+	interval := time.Duration(getEnvInt("ARCHIVE_INTERVAL_MINUTES", 60)) * time.Minute
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := ArchiveCompletedTasks(db, time.Now()); err != nil {
+				log.Printf("archiving completed tasks: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// ArchiveTask archives a task by hand, regardless of its status
+// @Summary Archive a task
+// @Description Hide a task from listings until it is unarchived or reopened
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id}/archive [post]
+func ArchiveTask(c *gin.Context) {
+	setTaskArchived(c, true)
+}
+
+// UnarchiveTask returns an archived task to the listings
+// @Summary Unarchive a task
+// @Description Completed tasks are archived again once they have been untouched for the owner's retention period
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id}/unarchive [post]
+func UnarchiveTask(c *gin.Context) {
+	setTaskArchived(c, false)
+}
+
+func setTaskArchived(c *gin.Context, archived bool) {
+	task, ok := findTask(c)
+	if !ok {
+		return
+	}
+
+	before := task
+	now := time.Now()
+	if archived {
+		if task.ArchivedAt == nil {
+			task.ArchivedAt = &now
+		}
+	} else {
+		task.ArchivedAt = nil
+	}
+	if err := DB.Save(&task).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update task", "details": err.Error()})
+		return
+	}
+	actorID, _ := currentUserID(c)
+	publishTaskEvent(actorID, before, task)
+	c.JSON(http.StatusOK, gin.H{"data": task})
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Attachment is metadata for a file stored outside the database. Several
+// attachments may reference the same file, e.g. after duplicating a task.
+type Attachment struct {
+	gorm.Model
+	TaskID      uint   `gorm:"index;not null" json:"taskId"`
+	FileName    string `gorm:"type:varchar(255);not null" json:"fileName"`
+	ContentType string `gorm:"type:varchar(255)" json:"contentType"`
+	Size        int64  `json:"size"`
+	URL         string `gorm:"type:text;not null" json:"url"`
+}
+
+type NewAttachment struct {
+	FileName    string `json:"fileName" binding:"required"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size" binding:"min=0"`
+	URL         string `json:"url" binding:"required,url"`
+}
+
+// GetAttachments lists a task's attachments
+func GetAttachments(c *gin.Context) {
+	var attachments []Attachment
+	if err := DB.Where("task_id = ?", c.Param("id")).Order("id ASC").Find(&attachments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve attachments"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": attachments})
+}
+
+// CreateAttachment records an attachment on a task
+func CreateAttachment(c *gin.Context) {
+	var input NewAttachment
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+		return
+	}
+
+	var task Task
+	if err := DB.Where("id = ?", c.Param("id")).First(&task).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve task"})
+		}
+		return
+	}
+
+	attachment := Attachment{
+		TaskID:      task.ID,
+		FileName:    input.FileName,
+		ContentType: input.ContentType,
+		Size:        input.Size,
+		URL:         input.URL,
+	}
+	if err := DB.Create(&attachment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create attachment", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": attachment})
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FlowQuery selects the tasks and days of a burndown report. All TaskQuery
+// filters apply; archived tasks are always included.
+type FlowQuery struct {
+	TaskQuery
+	// From and To are inclusive calendar days (UTC); the default range is
+	// the last 30 days
+	From string `form:"from"`
+	To   string `form:"to"`
+}
+
+// FlowDay is the state of the selected tasks at the end of one day
+type FlowDay struct {
+	Date string `json:"date"`
+	// Open is the number of pending tasks
+	Open     int64            `json:"open"`
+	ByStatus map[string]int64 `json:"byStatus"`
+}
+
+type TaskFlow struct {
+	From string    `json:"from"`
+	To   string    `json:"to"`
+	Days []FlowDay `json:"days"`
+}
+
+// GetTaskFlow reports burndown and cumulative flow data
+// @Summary Burndown and cumulative flow
+// @Description For every day in the range, the number of open tasks and the number of tasks in each status at the end of the day (UTC), reconstructed from the status history. Accepts the same filters as GET /tasks.
+// @Tags stats
+// @Produce json
+// @Param from query string false "First day (YYYY-MM-DD), default 30 days ago"
+// @Param to query string false "Last day (YYYY-MM-DD), default today"
+// @Param userId query int false "Filter by user ID"
+// @Param priority query string false "Filter by priority" Enums(low,medium,high)
+// @Param category query string false "Filter by category"
+// @Param search query string false "Search in task name and description"
+// @Param q query string false "Filter expression"
+// @Success 200 {object} TaskFlow
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /stats/flow [get]
+func GetTaskFlow(c *gin.Context) {
+	var query FlowQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+	from, to, err := parseStatsRange(query.From, query.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+
+	// Archiving and snoozing only hide tasks from listings; they still
+	// count here
+	query.Archived, query.Deferred = true, true
+	tasks, err := applyTaskFilters(tasksWithUrgency(DB, time.Now()), query.TaskQuery)
+	if err != nil {
+		respondFilterError(c, err)
+		return
+	}
+
+	end := to.AddDate(0, 0, 1)
+	var changes []TaskStatusChange
+	err = DB.Where("task_id IN (?)", tasks.Select("id")).
+		Where("changed_at < ?", end).
+		Order("task_id ASC, changed_at ASC, id ASC").
+		Find(&changes).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve status history", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": taskFlow(changes, from, to)})
+}
+
+// taskFlow replays status changes, ordered by task and time, to count the
+// tasks in each status at the end of every day from..to
+func taskFlow(changes []TaskStatusChange, from, to time.Time) TaskFlow {
+	flow := TaskFlow{From: from.Format("2006-01-02"), To: to.Format("2006-01-02")}
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		flow.Days = append(flow.Days, FlowDay{
+			Date: day.Format("2006-01-02"),
+			ByStatus: map[string]int64{
+				string(StatusPending):   0,
+				string(StatusCompleted): 0,
+				string(StatusCancelled): 0,
+			},
+		})
+	}
+
+	replay := func(history []TaskStatusChange) {
+		next := 0
+		for i := range flow.Days {
+			dayEnd := from.AddDate(0, 0, i+1)
+			for next < len(history) && history[next].ChangedAt.Before(dayEnd) {
+				next++
+			}
+			if next == 0 {
+				// The task did not exist yet
+				continue
+			}
+			status := history[next-1].To
+			flow.Days[i].ByStatus[string(status)]++
+			if status == StatusPending {
+				flow.Days[i].Open++
+			}
+		}
+	}
+	for start := 0; start < len(changes); {
+		stop := start
+		for stop < len(changes) && changes[stop].TaskID == changes[start].TaskID {
+			stop++
+		}
+		replay(changes[start:stop])
+		start = stop
+	}
+	return flow
+}
@@ -0,0 +1,735 @@
+package models
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/KingLeak95/todo-list-go/pkg/ical"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// The CalDAV server exposes one calendar collection per user holding their
+// unarchived tasks as VTODO resources named after their UIDs. The principal
+// and the calendar home are the root.
+const (
+	davRoot  = "/dav/"
+	davTasks = "/dav/tasks/"
+)
+
+const (
+	nsDAV            = "DAV:"
+	nsCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	nsCalendarServer = "http://calendarserver.org/ns/"
+)
+
+// CalDAVMethods are the methods served under /dav
+var CalDAVMethods = []string{"OPTIONS", "PROPFIND", "REPORT", "GET", "HEAD", "PUT", "DELETE"}
+
+var davPrefixes = map[string]string{nsDAV: "D", nsCalDAV: "C", nsCalendarServer: "CS"}
+
+// davRequest is the body of a PROPFIND or REPORT request
+type davRequest struct {
+	XMLName xml.Name
+	Prop    *davPropNames `xml:"DAV: prop"`
+	Hrefs   []string      `xml:"DAV: href"`
+	Filter  *davFilter    `xml:"urn:ietf:params:xml:ns:caldav filter"`
+}
+
+type davPropNames struct {
+	Names []struct {
+		XMLName xml.Name
+	} `xml:",any"`
+}
+
+type davFilter struct {
+	CompFilters []davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+type davCompFilter struct {
+	Name         string          `xml:"name,attr"`
+	IsNotDefined *struct{}       `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	CompFilters  []davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	PropFilters  []davPropFilter `xml:"urn:ietf:params:xml:ns:caldav prop-filter"`
+}
+
+type davPropFilter struct {
+	Name         string    `xml:"name,attr"`
+	IsNotDefined *struct{} `xml:"urn:ietf:params:xml:ns:caldav is-not-defined"`
+	TextMatch    *struct {
+		Value  string `xml:",chardata"`
+		Negate string `xml:"negate-condition,attr"`
+	} `xml:"urn:ietf:params:xml:ns:caldav text-match"`
+}
+
+// davResponse is one resource in a multistatus response. Property values
+// are XML, so text must be escaped with davText.
+type davResponse struct {
+	href    string
+	props   map[xml.Name]string
+	missing []xml.Name
+	// status replaces the properties, e.g. for a multiget href not found
+	status int
+}
+
+// CalDAVWellKnown points clients discovering the service at its root
+func CalDAVWellKnown(c *gin.Context) {
+	c.Redirect(http.StatusMovedPermanently, davRoot)
+}
+
+// CalDAV serves the caller's tasks over CalDAV (RFC 4791): PROPFIND and
+// REPORT (calendar-query and calendar-multiget) for discovery and sync,
+// and GET, PUT and DELETE on VTODO resources. Edits go through the same
+// validation as UpdateTask. Time-range filters are not evaluated, so
+// queries return a superset of the matching tasks.
+func CalDAV(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	c.Header("DAV", "1, 3, calendar-access")
+	if c.Request.Method == http.MethodOptions {
+		c.Header("Allow", strings.Join(CalDAVMethods, ", "))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	path := c.Param("path")
+	switch {
+	case path == "/":
+		if c.Request.Method == "PROPFIND" {
+			davPropfindRoot(c, userID)
+			return
+		}
+	case path == "/tasks" || path == "/tasks/":
+		switch c.Request.Method {
+		case "PROPFIND":
+			davPropfindTasks(c, userID)
+			return
+		case "REPORT":
+			davReport(c, userID)
+			return
+		}
+	case strings.HasPrefix(path, "/tasks/") && strings.HasSuffix(path, ".ics") && !strings.Contains(path[len("/tasks/"):], "/"):
+		uid := strings.TrimSuffix(path[len("/tasks/"):], ".ics")
+		switch c.Request.Method {
+		case "PROPFIND":
+			davPropfindTask(c, userID, uid)
+		case http.MethodGet, http.MethodHead:
+			davGetTask(c, userID, uid)
+		case http.MethodPut:
+			davPutTask(c, userID, uid)
+		case http.MethodDelete:
+			davDeleteTask(c, userID, uid)
+		default:
+			c.Status(http.StatusMethodNotAllowed)
+		}
+		return
+	default:
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Status(http.StatusMethodNotAllowed)
+}
+
+func davPropfindRoot(c *gin.Context, userID uint) {
+	req, ok := readDAVRequest(c)
+	if !ok {
+		return
+	}
+	email := c.GetString("user_email")
+	root := map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:                 "<D:collection/><D:principal/>",
+		{Space: nsDAV, Local: "displayname"}:                  davText(email),
+		{Space: nsDAV, Local: "current-user-principal"}:       davHref(davRoot),
+		{Space: nsDAV, Local: "principal-URL"}:                davHref(davRoot),
+		{Space: nsCalDAV, Local: "calendar-home-set"}:         davHref(davRoot),
+		{Space: nsCalDAV, Local: "calendar-user-address-set"}: davHref("mailto:" + email),
+	}
+	responses := []davResponse{req.response(davRoot, root)}
+	if davDepth(c) > 0 {
+		collection, err := davTasksCollection(userID)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		responses = append(responses, req.response(davTasks, collection))
+	}
+	writeMultistatus(c, responses)
+}
+
+func davPropfindTasks(c *gin.Context, userID uint) {
+	req, ok := readDAVRequest(c)
+	if !ok {
+		return
+	}
+	collection, err := davTasksCollection(userID)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	responses := []davResponse{req.response(davTasks, collection)}
+	if davDepth(c) > 0 {
+		var tasks []Task
+		if err := davTaskScope(userID).Order("id ASC").Find(&tasks).Error; err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		for _, task := range tasks {
+			props, err := taskDAVProps(task)
+			if err != nil {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			responses = append(responses, req.response(taskHref(task), props))
+		}
+	}
+	writeMultistatus(c, responses)
+}
+
+func davPropfindTask(c *gin.Context, userID uint, uid string) {
+	req, ok := readDAVRequest(c)
+	if !ok {
+		return
+	}
+	task, ok := davTaskOrStatus(c, userID, uid)
+	if !ok {
+		return
+	}
+	props, err := taskDAVProps(task)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	writeMultistatus(c, []davResponse{req.response(taskHref(task), props)})
+}
+
+// davReport answers calendar-multiget with the tasks at the given hrefs and
+// calendar-query with the tasks matching the filter
+func davReport(c *gin.Context, userID uint) {
+	req, ok := readDAVRequest(c)
+	if !ok {
+		return
+	}
+	responses := []davResponse{}
+	switch req.XMLName {
+	case xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}:
+		for _, href := range req.Hrefs {
+			href = strings.TrimSpace(href)
+			uid, ok := davHrefUID(href)
+			task, err := Task{}, gorm.ErrRecordNotFound
+			if ok {
+				task, err = findDAVTask(userID, uid)
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				responses = append(responses, davResponse{href: href, status: http.StatusNotFound})
+				continue
+			}
+			if err != nil {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			props, err := taskDAVProps(task)
+			if err != nil {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			responses = append(responses, req.response(href, props))
+		}
+	case xml.Name{Space: nsCalDAV, Local: "calendar-query"}:
+		var tasks []Task
+		if err := davTaskScope(userID).Order("id ASC").Find(&tasks).Error; err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		for _, task := range tasks {
+			// The filter starts at the VCALENDAR, so it is matched against
+			// a document holding the calendar
+			cal := ical.NewCalendar(calendarProdID)
+			cal.Components = append(cal.Components, taskTodo(task))
+			document := ical.Component{Components: []ical.Component{cal}}
+			if req.Filter != nil && !davComponentMatches(document, req.Filter.CompFilters) {
+				continue
+			}
+			props, err := taskDAVProps(task)
+			if err != nil {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			responses = append(responses, req.response(taskHref(task), props))
+		}
+	default:
+		writeDAVError(c, http.StatusForbidden, "<D:supported-report/>")
+		return
+	}
+	writeMultistatus(c, responses)
+}
+
+func davGetTask(c *gin.Context, userID uint, uid string) {
+	task, ok := davTaskOrStatus(c, userID, uid)
+	if !ok {
+		return
+	}
+	data, err := taskCalendar(task)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Header("ETag", taskETag(task))
+	c.Header("Last-Modified", task.UpdatedAt.UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", data)
+}
+
+// davPutTask creates or replaces the task at a resource from a calendar
+// holding a single VTODO whose UID is the resource name
+func davPutTask(c *gin.Context, userID uint, uid string) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes))
+	if err != nil {
+		c.String(http.StatusRequestEntityTooLarge, "calendar object is too large")
+		return
+	}
+	roots, err := ical.Decode(bytes.NewReader(body))
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid iCalendar data: %v", err)
+		return
+	}
+	var todos []ical.Component
+	for _, root := range roots {
+		if root.Name != "VCALENDAR" {
+			writeDAVError(c, http.StatusForbidden, "<C:supported-calendar-data/>")
+			return
+		}
+		for _, component := range root.Components {
+			switch component.Name {
+			case "VTODO":
+				todos = append(todos, component)
+			case "VTIMEZONE":
+			default:
+				writeDAVError(c, http.StatusForbidden, "<C:supported-calendar-component/>")
+				return
+			}
+		}
+	}
+	if len(todos) != 1 {
+		writeDAVError(c, http.StatusForbidden, "<C:valid-calendar-object-resource/>")
+		return
+	}
+	if p, ok := todos[0].Get("UID"); !ok || strings.TrimSpace(p.Value) != uid {
+		c.String(http.StatusBadRequest, "UID must match the resource name")
+		return
+	}
+	parsed, tagNames, err := icalTask(todos[0])
+	if err != nil {
+		c.String(http.StatusBadRequest, "invalid VTODO: %v", err)
+		return
+	}
+
+	task, err := findDAVTask(userID, uid)
+	exists := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	etag := ""
+	if exists {
+		etag = taskETag(task)
+	}
+	if davPreconditionFailed(c, etag) {
+		c.Status(http.StatusPreconditionFailed)
+		return
+	}
+
+	status := http.StatusNoContent
+	if !exists {
+		task = parsed
+		task.UserID = int(userID)
+		task.ExternalID = "caldav:" + uid
+		tags, err := findOrCreateTags(DB, tagNames)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		task.Tags = tags
+		if err := DB.Create(&task).Error; err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		notifyTaskChanges(DB, userID, Task{}, task)
+		status = http.StatusCreated
+	} else {
+		// A resource is replaced as a whole, so properties the client
+		// removed are cleared
+		before := task
+		if parsed.DueDate == nil {
+			task.DueDate = nil
+		}
+		task.Recurrence = parsed.Recurrence
+		if tagNames == nil {
+			tagNames = []string{}
+		}
+		input := UpdateTaskRequest{
+			Task:        &parsed.Task,
+			Description: &parsed.Description,
+			Priority:    &parsed.Priority,
+			Category:    &parsed.Category,
+			DueDate:     parsed.DueDate,
+			Status:      &parsed.Status,
+			Tags:        tagNames,
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := updateTask(tx, &task, input); err != nil {
+				return err
+			}
+			// Keep the completion time the client sent rather than now
+			if task.Status != StatusCompleted || parsed.CompletedAt == nil {
+				return nil
+			}
+			task.CompletedAt = parsed.CompletedAt
+			return tx.Model(&task).UpdateColumn("completed_at", *parsed.CompletedAt).Error
+		})
+		var invalid *taskInputError
+		if errors.As(err, &invalid) {
+			c.String(http.StatusBadRequest, "%s", invalid.Error())
+			return
+		}
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		notifyTaskChanges(DB, userID, before, task)
+	}
+
+	// Reload so the ETag matches the precision of the stored timestamp
+	if err := DB.First(&task, task.ID).Error; err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Header("ETag", taskETag(task))
+	c.Status(status)
+}
+
+func davDeleteTask(c *gin.Context, userID uint, uid string) {
+	task, ok := davTaskOrStatus(c, userID, uid)
+	if !ok {
+		return
+	}
+	if davPreconditionFailed(c, taskETag(task)) {
+		c.Status(http.StatusPreconditionFailed)
+		return
+	}
+	if err := DB.Delete(&task).Error; err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	publishTask(EventTaskDeleted, userID, task)
+	c.Status(http.StatusNoContent)
+}
+
+// davTaskScope selects the tasks in a user's calendar collection
+func davTaskScope(userID uint) *gorm.DB {
+	return DB.Preload("Tags").Preload("Parent").Where("user_id = ? AND archived_at IS NULL", userID)
+}
+
+// findDAVTask finds the task a resource name refers to: a task imported or
+// synced with that UID, or a task exported under its ID-based UID
+func findDAVTask(userID uint, uid string) (Task, error) {
+	var task Task
+	err := davTaskScope(userID).Where("external_id IN ?", []string{"caldav:" + uid, "ical:" + uid}).First(&task).Error
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return task, err
+	}
+	var id uint
+	if _, scanErr := fmt.Sscanf(uid, "task-%d@", &id); scanErr != nil || taskUID(id) != uid {
+		return task, err
+	}
+	if err := davTaskScope(userID).First(&task, id).Error; err != nil {
+		return task, err
+	}
+	if task.icalUID() != uid {
+		return Task{}, gorm.ErrRecordNotFound
+	}
+	return task, nil
+}
+
+// davTaskOrStatus finds a task, answering 404 or 500 when it cannot
+func davTaskOrStatus(c *gin.Context, userID uint, uid string) (Task, bool) {
+	task, err := findDAVTask(userID, uid)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Status(http.StatusNotFound)
+		return task, false
+	}
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return task, false
+	}
+	return task, true
+}
+
+// davTasksCollection returns the properties of the tasks collection. Its
+// CTag is built like the feed's ETag, so it changes with any task.
+func davTasksCollection(userID uint) (map[xml.Name]string, error) {
+	count, lastModified, err := taskCollectionVersion(DB, userID, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	ctag := fmt.Sprintf("%d-%x", count, lastModified.UnixNano())
+	return map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:           "<D:collection/><C:calendar/>",
+		{Space: nsDAV, Local: "displayname"}:            "Tasks",
+		{Space: nsDAV, Local: "current-user-principal"}: davHref(davRoot),
+		{Space: nsDAV, Local: "current-user-privilege-set"}: "<D:privilege><D:read/></D:privilege>" +
+			"<D:privilege><D:write/></D:privilege>",
+		{Space: nsDAV, Local: "supported-report-set"}: "<D:supported-report><D:report><C:calendar-query/></D:report></D:supported-report>" +
+			"<D:supported-report><D:report><C:calendar-multiget/></D:report></D:supported-report>",
+		{Space: nsDAV, Local: "getetag"}:                             davText(`"` + ctag + `"`),
+		{Space: nsCalDAV, Local: "supported-calendar-component-set"}: `<C:comp name="VTODO"/>`,
+		{Space: nsCalendarServer, Local: "getctag"}:                  davText(ctag),
+	}, nil
+}
+
+// taskDAVProps returns the properties of a task resource
+func taskDAVProps(task Task) (map[xml.Name]string, error) {
+	data, err := taskCalendar(task)
+	if err != nil {
+		return nil, err
+	}
+	return map[xml.Name]string{
+		{Space: nsDAV, Local: "resourcetype"}:     "",
+		{Space: nsDAV, Local: "getetag"}:          davText(taskETag(task)),
+		{Space: nsDAV, Local: "getcontenttype"}:   "text/calendar; charset=utf-8; component=VTODO",
+		{Space: nsDAV, Local: "getlastmodified"}:  task.UpdatedAt.UTC().Format(http.TimeFormat),
+		{Space: nsCalDAV, Local: "calendar-data"}: davText(string(data)),
+	}, nil
+}
+
+// taskCalendar renders a task as a calendar object resource
+func taskCalendar(task Task) ([]byte, error) {
+	cal := ical.NewCalendar(calendarProdID)
+	cal.Components = append(cal.Components, taskTodo(task))
+	var buf bytes.Buffer
+	err := ical.Encode(&buf, cal)
+	return buf.Bytes(), err
+}
+
+// taskETag changes whenever the task is saved
+func taskETag(task Task) string {
+	return fmt.Sprintf(`"%d-%x"`, task.ID, task.UpdatedAt.UnixNano())
+}
+
+func taskHref(task Task) string {
+	return davTasks + url.PathEscape(task.icalUID()) + ".ics"
+}
+
+// davHrefUID returns the UID named by a task resource href, which may be a
+// path or an absolute URL
+func davHrefUID(href string) (string, bool) {
+	u, err := url.Parse(href)
+	if err != nil || !strings.HasPrefix(u.Path, davTasks) || !strings.HasSuffix(u.Path, ".ics") {
+		return "", false
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(u.Path, davTasks), ".ics")
+	return name, name != "" && !strings.Contains(name, "/")
+}
+
+// davComponentMatches evaluates CalDAV comp-filters against the children
+// of a component. Time ranges are not evaluated and match everything.
+func davComponentMatches(component ical.Component, filters []davCompFilter) bool {
+	for _, filter := range filters {
+		if filter.IsNotDefined != nil {
+			if davHasComponent(component, filter.Name) {
+				return false
+			}
+			continue
+		}
+		matched := false
+		for _, child := range component.Components {
+			if strings.EqualFold(child.Name, filter.Name) && davPropertiesMatch(child, filter.PropFilters) &&
+				davComponentMatches(child, filter.CompFilters) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func davHasComponent(component ical.Component, name string) bool {
+	for _, child := range component.Components {
+		if strings.EqualFold(child.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// davPropertiesMatch evaluates prop-filters, matching text-match values as
+// case-insensitive substrings
+func davPropertiesMatch(component ical.Component, filters []davPropFilter) bool {
+	for _, filter := range filters {
+		p, ok := component.Get(filter.Name)
+		switch {
+		case filter.IsNotDefined != nil:
+			if ok {
+				return false
+			}
+		case !ok:
+			return false
+		case filter.TextMatch != nil:
+			value := strings.ToLower(ical.ParseText(p.Value))
+			contains := strings.Contains(value, strings.ToLower(strings.TrimSpace(filter.TextMatch.Value)))
+			if contains == (filter.TextMatch.Negate == "yes") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// readDAVRequest parses a PROPFIND or REPORT body. An empty body asks for
+// all properties.
+func readDAVRequest(c *gin.Context) (davRequest, bool) {
+	var req davRequest
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, 1<<20))
+	if err != nil {
+		c.Status(http.StatusRequestEntityTooLarge)
+		return req, false
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return req, true
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		c.String(http.StatusBadRequest, "invalid XML: %v", err)
+		return req, false
+	}
+	return req, true
+}
+
+// response picks the requested properties of a resource, reporting unknown
+// ones as missing. Without a prop list, as with allprop, every property
+// except calendar-data is returned.
+func (req davRequest) response(href string, props map[xml.Name]string) davResponse {
+	resp := davResponse{href: href, props: make(map[xml.Name]string)}
+	if req.Prop == nil {
+		for name, value := range props {
+			if name.Local != "calendar-data" {
+				resp.props[name] = value
+			}
+		}
+		return resp
+	}
+	for _, p := range req.Prop.Names {
+		if value, ok := props[p.XMLName]; ok {
+			resp.props[p.XMLName] = value
+		} else {
+			resp.missing = append(resp.missing, p.XMLName)
+		}
+	}
+	return resp
+}
+
+// davDepth reads the Depth header, treating infinity, the PROPFIND
+// default, as 1
+func davDepth(c *gin.Context) int {
+	if c.GetHeader("Depth") == "0" {
+		return 0
+	}
+	return 1
+}
+
+// davPreconditionFailed checks If-Match and If-None-Match against the ETag
+// of a resource, which is empty when the resource does not exist
+func davPreconditionFailed(c *gin.Context, etag string) bool {
+	if match := c.GetHeader("If-Match"); match != "" {
+		if etag == "" || (strings.TrimSpace(match) != "*" && !davETagListed(match, etag)) {
+			return true
+		}
+	}
+	if match := c.GetHeader("If-None-Match"); match != "" && etag != "" {
+		if strings.TrimSpace(match) == "*" || davETagListed(match, etag) {
+			return true
+		}
+	}
+	return false
+}
+
+func davETagListed(list, etag string) bool {
+	for _, candidate := range strings.Split(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeMultistatus(c *gin.Context, responses []davResponse) {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<D:multistatus xmlns:D="DAV:" xmlns:C="` + nsCalDAV + `" xmlns:CS="` + nsCalendarServer + `">`)
+	for _, r := range responses {
+		b.WriteString("<D:response>" + davHref(r.href))
+		if r.status != 0 {
+			b.WriteString(davStatus(r.status))
+		}
+		if len(r.props) > 0 {
+			b.WriteString("<D:propstat><D:prop>")
+			for name, value := range r.props {
+				b.WriteString(davElement(name, value))
+			}
+			b.WriteString("</D:prop>" + davStatus(http.StatusOK) + "</D:propstat>")
+		}
+		if len(r.missing) > 0 {
+			b.WriteString("<D:propstat><D:prop>")
+			for _, name := range r.missing {
+				b.WriteString(davElement(name, ""))
+			}
+			b.WriteString("</D:prop>" + davStatus(http.StatusNotFound) + "</D:propstat>")
+		}
+		b.WriteString("</D:response>")
+	}
+	b.WriteString("</D:multistatus>")
+	c.Data(http.StatusMultiStatus, "application/xml; charset=utf-8", []byte(b.String()))
+}
+
+// writeDAVError answers with a WebDAV precondition element
+func writeDAVError(c *gin.Context, status int, condition string) {
+	body := xml.Header + `<D:error xmlns:D="DAV:" xmlns:C="` + nsCalDAV + `">` + condition + `</D:error>`
+	c.Data(status, "application/xml; charset=utf-8", []byte(body))
+}
+
+// davElement renders a property, declaring namespaces that have no prefix
+// on the element itself
+func davElement(name xml.Name, inner string) string {
+	tag, attrs := name.Local, ` xmlns="`+davText(name.Space)+`"`
+	if prefix, ok := davPrefixes[name.Space]; ok {
+		tag, attrs = prefix+":"+name.Local, ""
+	}
+	if inner == "" {
+		return "<" + tag + attrs + "/>"
+	}
+	return "<" + tag + attrs + ">" + inner + "</" + tag + ">"
+}
+
+func davHref(href string) string {
+	return "<D:href>" + davText(href) + "</D:href>"
+}
+
+func davStatus(status int) string {
+	return fmt.Sprintf("<D:status>HTTP/1.1 %d %s</D:status>", status, http.StatusText(status))
+}
+
+func davText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
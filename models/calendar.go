@@ -0,0 +1,311 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KingLeak95/todo-list-go/pkg/ical"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// calendarProdID identifies the API in generated iCalendar data
+const calendarProdID = "-//todo-list-go//Tasks//EN"
+
+// calendarUIDDomain qualifies the UIDs of exported tasks
+const calendarUIDDomain = "todo-list-go"
+
+// CalendarToken grants read access to a user's iCalendar feed. Only a hash
+// of the token is stored; the token itself is shown once, when issued.
+type CalendarToken struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex" json:"userId"`
+	TokenHash string    `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreateCalendarToken issues a feed token for the caller, revoking any
+// previous one
+// @Summary Issue a calendar feed URL
+// @Description Returns a secret URL serving the caller's tasks as an iCalendar feed. Issuing a new URL revokes the old one.
+// @Tags calendar
+// @Produce json
+// @Security BearerAuth
+// @Success 201 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /calendar/token [post]
+func CreateCalendarToken(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+	token := hex.EncodeToString(secret)
+
+	record := CalendarToken{UserID: userID, TokenHash: hashCalendarToken(token)}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&CalendarToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create token", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": gin.H{
+		"token":     token,
+		"url":       "/calendar/" + token + "/tasks.ics",
+		"createdAt": record.CreatedAt,
+	}})
+}
+
+// RevokeCalendarToken disables the caller's feed URL
+// @Summary Revoke the calendar feed URL
+// @Tags calendar
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /calendar/token [delete]
+func RevokeCalendarToken(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	result := DB.Where("user_id = ?", userID).Delete(&CalendarToken{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not revoke token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No calendar token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": "revoked"})
+}
+
+// GetCalendarFeed serves a user's unarchived tasks as VTODOs. With
+// events=true, tasks due at a specific time are also served as VEVENTs so
+// they show up in calendar views. Responses carry an ETag and
+// Last-Modified, and conditional requests are answered with 304.
+// @Summary iCalendar feed
+// @Description Public URL authenticated by its secret token
+// @Tags calendar
+// @Produce text/calendar
+// @Param token path string true "Feed token"
+// @Param events query bool false "Also emit VEVENTs for tasks due at a specific time"
+// @Success 200 {string} string "iCalendar data"
+// @Success 304 {string} string "Not modified"
+// @Failure 404 {object} map[string]interface{}
+// @Router /calendar/{token}/tasks.ics [get]
+func GetCalendarFeed(c *gin.Context) {
+	var record CalendarToken
+	if err := DB.Where("token_hash = ?", hashCalendarToken(c.Param("token"))).First(&record).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Calendar not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve calendar"})
+		}
+		return
+	}
+	events, _ := strconv.ParseBool(c.Query("events"))
+
+	// The validators come from cheap aggregate queries, so unchanged feeds
+	// are answered without loading any tasks
+	count, lastModified, err := taskCollectionVersion(DB, record.UserID, record.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve tasks"})
+		return
+	}
+	etag := fmt.Sprintf(`"%d-%x-%t"`, count, lastModified.UnixNano(), events)
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "private, max-age=0, must-revalidate")
+	if match := c.GetHeader("If-None-Match"); match != "" {
+		if match == etag || match == "*" {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	} else if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil && !lastModified.Truncate(time.Second).After(since) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	var tasks []Task
+	if err := DB.Preload("Tags").Preload("Parent").Where("user_id = ? AND archived_at IS NULL", record.UserID).Order("id ASC").Find(&tasks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve tasks"})
+		return
+	}
+	cal := ical.NewCalendar(calendarProdID)
+	cal.Add("X-WR-CALNAME", "Tasks")
+	cal.Add("X-PUBLISHED-TTL", "PT15M")
+	for _, task := range tasks {
+		cal.Components = append(cal.Components, taskTodo(task))
+		if events && hasDueTime(task) {
+			cal.Components = append(cal.Components, taskEvent(task))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ical.Encode(&buf, cal); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not render calendar"})
+		return
+	}
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", buf.Bytes())
+}
+
+func hashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// taskCollectionVersion returns the number of a user's unarchived tasks and
+// the last time any of their tasks changed, was deleted or was archived, but
+// no earlier than since. Together they change whenever the collection does.
+func taskCollectionVersion(db *gorm.DB, userID uint, since time.Time) (int64, time.Time, error) {
+	scope := func() *gorm.DB { return db.Unscoped().Model(&Task{}).Where("user_id = ?", userID) }
+	var count int64
+	if err := scope().Where("deleted_at IS NULL AND archived_at IS NULL").Count(&count).Error; err != nil {
+		return 0, since, err
+	}
+	lastModified := since
+	for _, column := range []string{"updated_at", "deleted_at", "archived_at"} {
+		var latest []time.Time
+		if err := scope().Where(column+" IS NOT NULL").Order(column+" DESC").Limit(1).Pluck(column, &latest).Error; err != nil {
+			return 0, since, err
+		}
+		if len(latest) > 0 && latest[0].After(lastModified) {
+			lastModified = latest[0]
+		}
+	}
+	return count, lastModified, nil
+}
+
+// taskUID is the stable iCalendar UID of a task
+func taskUID(id uint) string {
+	return fmt.Sprintf("task-%d@%s", id, calendarUIDDomain)
+}
+
+// icalUID is the UID a task is exported with: the UID of the item it was
+// imported or synced from, if any, so clients recognise their own items
+func (t Task) icalUID() string {
+	for _, prefix := range []string{"ical:", "caldav:"} {
+		if strings.HasPrefix(t.ExternalID, prefix) {
+			return strings.TrimPrefix(t.ExternalID, prefix)
+		}
+	}
+	return taskUID(t.ID)
+}
+
+// hasDueTime reports whether a task is due at a specific time rather than
+// on a day, which is stored as UTC midnight
+func hasDueTime(task Task) bool {
+	if task.DueDate == nil {
+		return false
+	}
+	due := task.DueDate.UTC()
+	return due.Hour() != 0 || due.Minute() != 0 || due.Second() != 0
+}
+
+// icalPriorities maps priorities onto the RFC 5545 scale, where 1 is the
+// highest and 9 the lowest
+var icalPriorities = map[TaskPriority]string{
+	PriorityHigh:   "1",
+	PriorityMedium: "5",
+	PriorityLow:    "9",
+}
+
+var icalTodoStatuses = map[TaskStatus]string{
+	StatusPending:   "NEEDS-ACTION",
+	StatusCompleted: "COMPLETED",
+	StatusCancelled: "CANCELLED",
+}
+
+// taskTodo renders a task as a VTODO. The category comes first in
+// CATEGORIES, followed by the task's tags. The task's Parent must be loaded
+// for RELATED-TO.
+func taskTodo(task Task) ical.Component {
+	todo := ical.Component{Name: "VTODO"}
+	todo.Add("UID", task.icalUID())
+	todo.Add("DTSTAMP", ical.DateTime(task.UpdatedAt))
+	todo.Add("CREATED", ical.DateTime(task.CreatedAt))
+	todo.Add("LAST-MODIFIED", ical.DateTime(task.UpdatedAt))
+	todo.Add("SUMMARY", ical.Text(task.Task))
+	if task.Description != "" {
+		todo.Add("DESCRIPTION", ical.Text(task.Description))
+	}
+	if priority, ok := icalPriorities[task.Priority]; ok {
+		todo.Add("PRIORITY", priority)
+	}
+	if status, ok := icalTodoStatuses[task.Status]; ok {
+		todo.Add("STATUS", status)
+	}
+	var categories []string
+	if task.Category != "" {
+		categories = append(categories, task.Category)
+	}
+	for _, tag := range task.Tags {
+		categories = append(categories, tag.Name)
+	}
+	if len(categories) > 0 {
+		todo.Add("CATEGORIES", ical.TextList(categories))
+	}
+	if task.DueDate != nil {
+		if hasDueTime(task) {
+			todo.Add("DUE", ical.DateTime(*task.DueDate))
+		} else {
+			todo.AddWithParams("DUE", map[string]string{"VALUE": "DATE"}, ical.Date(task.DueDate.UTC()))
+		}
+	}
+	if task.Status == StatusCompleted {
+		completedAt := task.UpdatedAt
+		if task.CompletedAt != nil {
+			completedAt = *task.CompletedAt
+		}
+		todo.Add("COMPLETED", ical.DateTime(completedAt))
+		todo.Add("PERCENT-COMPLETE", "100")
+	}
+	if task.Recurrence != "" {
+		todo.Add("RRULE", task.Recurrence)
+	}
+	if task.Parent != nil {
+		todo.Add("RELATED-TO", task.Parent.icalUID())
+	}
+	return todo
+}
+
+// taskEvent renders the due time of a task as a zero-length VEVENT that
+// does not block free/busy time
+func taskEvent(task Task) ical.Component {
+	event := ical.Component{Name: "VEVENT"}
+	event.Add("UID", fmt.Sprintf("task-%d-due@%s", task.ID, calendarUIDDomain))
+	event.Add("DTSTAMP", ical.DateTime(task.UpdatedAt))
+	event.Add("DTSTART", ical.DateTime(*task.DueDate))
+	event.Add("SUMMARY", ical.Text(task.Task))
+	if task.Description != "" {
+		event.Add("DESCRIPTION", ical.Text(task.Description))
+	}
+	event.Add("TRANSP", "TRANSPARENT")
+	if task.Status == StatusCancelled {
+		event.Add("STATUS", "CANCELLED")
+	} else {
+		event.Add("STATUS", "CONFIRMED")
+	}
+	event.Add("RELATED-TO", task.icalUID())
+	return event
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/KingLeak95/todo-list-go/pkg/ical"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ImportICal creates tasks for the caller from the VTODOs of an iCalendar
+// file. Items are deduplicated by UID, so importing the same file again only
+// adds the new items.
+// @Summary Import tasks from iCalendar
+// @Description Upload a .ics file as the `file` form field or as the request body. VTODO components become tasks; other components and already imported UIDs are reported as skipped, and unreadable VTODOs as invalid.
+// @Tags import
+// @Accept multipart/form-data
+// @Accept text/calendar
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file false "iCalendar file"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /import/ical [post]
+func ImportICal(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	data, err := readImportFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import", "details": err.Error()})
+		return
+	}
+	roots, err := ical.Decode(bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid iCalendar data", "details": err.Error()})
+		return
+	}
+
+	var items []ical.Component
+	for _, root := range roots {
+		components := []ical.Component{root}
+		if root.Name == "VCALENDAR" {
+			components = root.Components
+		}
+		for _, component := range components {
+			if component.Name != "VTIMEZONE" {
+				items = append(items, component)
+			}
+		}
+	}
+
+	result := newImportResult()
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		seen := make(map[string]bool)
+		for index, item := range items {
+			uid, summary := "", ""
+			if p, ok := item.Get("UID"); ok {
+				uid = strings.TrimSpace(p.Value)
+			}
+			if p, ok := item.Get("SUMMARY"); ok {
+				summary = ical.ParseText(p.Value)
+			}
+			if item.Name != "VTODO" {
+				result.skip(index, uid, summary, fmt.Sprintf("%s components are not imported", item.Name))
+				continue
+			}
+
+			task, tagNames, err := icalTask(item)
+			if err != nil {
+				result.invalid(index, uid, summary, err)
+				continue
+			}
+			task.UserID = int(userID)
+			if uid != "" {
+				task.ExternalID = "ical:" + uid
+				if seen[uid] {
+					result.skip(index, uid, summary, "duplicate UID in this file")
+					continue
+				}
+				seen[uid] = true
+				exists, err := importedTaskExists(tx, userID, task.ExternalID)
+				if err != nil {
+					return err
+				}
+				if exists {
+					result.skip(index, uid, summary, "already imported")
+					continue
+				}
+			}
+
+			if err := createImportedTask(tx, &task, tagNames); err != nil {
+				return err
+			}
+			result.Imported++
+			result.TaskIDs = append(result.TaskIDs, task.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not import tasks", "details": err.Error()})
+		return
+	}
+	publishCreatedTasks(DB, userID, result.TaskIDs)
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// icalTask reads a VTODO into a task and the names of its tags. The first
+// of the CATEGORIES becomes the category and the rest become tags, as in
+// the feed.
+func icalTask(todo ical.Component) (Task, []string, error) {
+	var task Task
+	if p, ok := todo.Get("SUMMARY"); ok {
+		task.Task = strings.TrimSpace(ical.ParseText(p.Value))
+	}
+	if task.Task == "" {
+		return task, nil, fmt.Errorf("missing SUMMARY")
+	}
+	if utf8.RuneCountInString(task.Task) > 255 {
+		return task, nil, fmt.Errorf("SUMMARY is longer than 255 characters")
+	}
+	if uid, ok := todo.Get("UID"); ok && len(uid.Value) > 500 {
+		return task, nil, fmt.Errorf("UID is longer than 500 characters")
+	}
+	if p, ok := todo.Get("DESCRIPTION"); ok {
+		task.Description = ical.ParseText(p.Value)
+	}
+
+	task.Priority = PriorityMedium
+	if p, ok := todo.Get("PRIORITY"); ok {
+		priority, err := strconv.Atoi(strings.TrimSpace(p.Value))
+		if err != nil || priority < 0 || priority > 9 {
+			return task, nil, fmt.Errorf("invalid PRIORITY %q", p.Value)
+		}
+		switch {
+		case priority >= 1 && priority <= 4:
+			task.Priority = PriorityHigh
+		case priority >= 6:
+			task.Priority = PriorityLow
+		}
+	}
+
+	if p, ok := todo.Get("DUE"); ok {
+		due, _, err := ical.ParseTime(p)
+		if err != nil {
+			return task, nil, fmt.Errorf("invalid DUE %q", p.Value)
+		}
+		due = due.UTC()
+		task.DueDate = &due
+	}
+
+	var tagNames []string
+	for _, p := range todo.Properties {
+		if p.Name != "CATEGORIES" {
+			continue
+		}
+		for _, name := range ical.ParseTextList(p.Value) {
+			if task.Category == "" {
+				task.Category = name
+			} else {
+				tagNames = append(tagNames, name)
+			}
+		}
+	}
+	if utf8.RuneCountInString(task.Category) > 100 {
+		return task, nil, fmt.Errorf("category %q is longer than 100 characters", task.Category)
+	}
+	for _, name := range tagNames {
+		if utf8.RuneCountInString(strings.TrimSpace(name)) > 100 {
+			return task, nil, fmt.Errorf("tag %q is longer than 100 characters", name)
+		}
+	}
+
+	if p, ok := todo.Get("RRULE"); ok {
+		rule := strings.TrimSpace(p.Value)
+		if err := ical.ValidateRecurrence(rule); err != nil {
+			return task, nil, fmt.Errorf("invalid RRULE: %v", err)
+		}
+		if utf8.RuneCountInString(rule) > 255 {
+			return task, nil, fmt.Errorf("RRULE is longer than 255 characters")
+		}
+		task.Recurrence = rule
+	}
+
+	status := StatusPending
+	if p, ok := todo.Get("STATUS"); ok {
+		switch strings.ToUpper(strings.TrimSpace(p.Value)) {
+		case "COMPLETED":
+			status = StatusCompleted
+		case "CANCELLED":
+			status = StatusCancelled
+		}
+	}
+	now := time.Now()
+	task.setStatus(status, now)
+	if p, ok := todo.Get("COMPLETED"); ok && status == StatusCompleted {
+		completedAt, _, err := ical.ParseTime(p)
+		if err != nil {
+			return task, nil, fmt.Errorf("invalid COMPLETED %q", p.Value)
+		}
+		completedAt = completedAt.UTC()
+		task.CompletedAt = &completedAt
+	}
+	return task, tagNames, nil
+}
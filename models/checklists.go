@@ -0,0 +1,105 @@
+package models
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ChecklistItem struct {
+	gorm.Model
+	TaskID   uint   `gorm:"index;not null" json:"taskId"`
+	Text     string `gorm:"type:varchar(500);not null" json:"text"`
+	Done     bool   `json:"done"`
+	Position int    `json:"position"`
+}
+
+type NewChecklistItem struct {
+	Text     string `json:"text" binding:"required"`
+	Done     bool   `json:"done"`
+	Position *int   `json:"position,omitempty"`
+}
+
+type UpdateChecklistItemRequest struct {
+	Text     *string `json:"text,omitempty"`
+	Done     *bool   `json:"done,omitempty"`
+	Position *int    `json:"position,omitempty"`
+}
+
+// GetChecklist lists a task's checklist items in order
+func GetChecklist(c *gin.Context) {
+	var items []ChecklistItem
+	if err := DB.Where("task_id = ?", c.Param("id")).Order("position ASC, id ASC").Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve checklist"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": items})
+}
+
+// CreateChecklistItem appends an item to a task's checklist
+func CreateChecklistItem(c *gin.Context) {
+	var input NewChecklistItem
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+		return
+	}
+
+	var task Task
+	if err := DB.Where("id = ?", c.Param("id")).First(&task).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve task"})
+		}
+		return
+	}
+
+	item := ChecklistItem{TaskID: task.ID, Text: input.Text, Done: input.Done}
+	if input.Position != nil {
+		item.Position = *input.Position
+	} else {
+		var count int64
+		DB.Model(&ChecklistItem{}).Where("task_id = ?", task.ID).Count(&count)
+		item.Position = int(count)
+	}
+	if err := DB.Create(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create checklist item", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": item})
+}
+
+// UpdateChecklistItem edits or ticks off a checklist item
+func UpdateChecklistItem(c *gin.Context) {
+	var input UpdateChecklistItemRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+		return
+	}
+
+	var item ChecklistItem
+	if err := DB.Where("id = ? AND task_id = ?", c.Param("itemId"), c.Param("id")).First(&item).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Checklist item not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve checklist item"})
+		}
+		return
+	}
+
+	if input.Text != nil {
+		item.Text = *input.Text
+	}
+	if input.Done != nil {
+		item.Done = *input.Done
+	}
+	if input.Position != nil {
+		item.Position = *input.Position
+	}
+	if err := DB.Save(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update checklist item", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": item})
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type Comment struct {
+	gorm.Model
+	TaskID uint   `gorm:"index;not null" json:"taskId"`
+	UserID uint   `gorm:"index" json:"userId"`
+	Body   string `gorm:"type:text;not null" json:"body"`
+}
+
+type NewComment struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// CreateComment adds a comment to a task
+// @Summary Comment on a task
+// @Description Add a comment to a task as the authenticated user
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param comment body NewComment true "Comment data"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /tasks/{id}/comments [post]
+func CreateComment(c *gin.Context) {
+	var input NewComment
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+		return
+	}
+
+	var task Task
+	if err := DB.Where("id = ?", c.Param("id")).First(&task).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve task"})
+		}
+		return
+	}
+
+	userID, _ := currentUserID(c)
+	comment := Comment{
+		TaskID: task.ID,
+		UserID: userID,
+		Body:   input.Body,
+	}
+	if err := DB.Create(&comment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create comment", "details": err.Error()})
+		return
+	}
+	notifyMentions(DB, userID, task, comment.Body)
+
+	c.JSON(http.StatusCreated, gin.H{"data": comment})
+}
+
+// GetTaskComments lists the comments on a task, oldest first
+// @Summary List task comments
+// @Tags comments
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /tasks/{id}/comments [get]
+func GetTaskComments(c *gin.Context) {
+	var comments []Comment
+	if err := DB.Where("task_id = ?", c.Param("id")).Order("created_at ASC").Find(&comments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve comments"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": comments})
+}
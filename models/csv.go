@@ -0,0 +1,332 @@
+package models
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+// taskCSVColumns are the columns of an export, in order
+var taskCSVColumns = []string{"id", "task", "description", "priority", "status", "category", "dueDate", "tags", "userId", "projectId", "createdAt", "completedAt"}
+
+// taskCSVFields are the task fields an import can fill. Other columns are
+// reported as ignored.
+var taskCSVFields = map[string]bool{
+	"task": true, "description": true, "priority": true, "status": true, "category": true,
+	"dueDate": true, "tags": true, "userId": true, "projectId": true,
+}
+
+// CSVRowError is a problem with one row of a CSV import
+type CSVRowError struct {
+	// Line is the line of the row in the file, counting the header as 1
+	Line   int    `json:"line"`
+	Column string `json:"column,omitempty"`
+	Error  string `json:"error"`
+}
+
+// CSVImportResult reports a CSV import. Nothing is imported when any row
+// is invalid, or on a dry run.
+type CSVImportResult struct {
+	DryRun         bool          `json:"dryRun"`
+	Rows           int           `json:"rows"`
+	Imported       int           `json:"imported"`
+	TaskIDs        []uint        `json:"taskIds"`
+	IgnoredColumns []string      `json:"ignoredColumns"`
+	Errors         []CSVRowError `json:"errors"`
+}
+
+// ExportTasksCSV streams the tasks matching the listing filters as CSV
+// @Summary Export tasks as CSV
+// @Description Accepts the filters and sort options of GET /tasks; pagination is ignored and every matching task is exported. Tags are separated by commas within their cell and times are RFC 3339. Text cells that a spreadsheet would run as a formula are prefixed with an apostrophe.
+// @Tags import
+// @Produce text/csv
+// @Security BearerAuth
+// @Param userId query int false "Filter by user ID"
+// @Param priority query string false "Filter by priority" Enums(low,medium,high)
+// @Param status query string false "Filter by status" Enums(pending,completed,cancelled)
+// @Param category query string false "Filter by category"
+// @Param projectId query int false "Filter by project ID"
+// @Param search query string false "Search in task name and description"
+// @Param archived query bool false "Include archived tasks"
+// @Param deferred query bool false "Include snoozed tasks whose defer time has not passed"
+// @Param q query string false "Filter expression"
+// @Param sort query string false "Comma-separated sort fields, '-' prefix for descending"
+// @Success 200 {string} string "CSV data"
+// @Failure 400 {object} map[string]interface{}
+// @Router /tasks/export.csv [get]
+func ExportTasksCSV(c *gin.Context) {
+	w := csv.NewWriter(c.Writer)
+	streamTaskExport(c, "text/csv; charset=utf-8", "tasks.csv", func(tasks []Task, first bool) error {
+		if first {
+			w.Write(taskCSVColumns)
+		}
+		for i := range tasks {
+			w.Write(taskCSVRecord(tasks[i]))
+		}
+		w.Flush()
+		return w.Error()
+	})
+}
+
+// ImportTasksCSV creates tasks from the rows of a CSV file
+// @Summary Import tasks from CSV
+// @Description Upload a CSV file with a header row as the `file` form field or as the request body. Columns named like the task fields (task, description, priority, status, category, dueDate, tags, userId, projectId) are read; `mapping` maps other headers onto those fields. Cells quoted against formula injection by the export (a leading apostrophe before =, +, -, @, tab or CR) are read without the quote. Rows are validated like POST /tasks and imported in one transaction: if any row is invalid, nothing is imported and every error is reported.
+// @Tags import
+// @Accept multipart/form-data
+// @Accept text/csv
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file false "CSV file"
+// @Param mapping query string false "JSON object mapping CSV headers to task fields, e.g. {\"Title\":\"task\",\"Due\":\"dueDate\"}"
+// @Param dryRun query bool false "Validate the rows without importing them"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /tasks/import.csv [post]
+func ImportTasksCSV(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.Query("dryRun"))
+	data, err := readImportFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import", "details": err.Error()})
+		return
+	}
+	mapping := map[string]string{}
+	if raw := c.Query("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping", "details": err.Error()})
+			return
+		}
+	}
+	for header, field := range mapping {
+		if !taskCSVFields[field] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping", "details": fmt.Sprintf("column %q is mapped to unknown field %q", header, field)})
+			return
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid CSV", "details": err.Error()})
+		return
+	}
+	result := CSVImportResult{DryRun: dryRun, TaskIDs: []uint{}, IgnoredColumns: []string{}, Errors: []CSVRowError{}}
+	fields := make([]string, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if field, ok := mapping[name]; ok {
+			fields[i] = field
+		} else if taskCSVFields[name] {
+			fields[i] = name
+		} else {
+			result.IgnoredColumns = append(result.IgnoredColumns, name)
+		}
+	}
+
+	var created []Task
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) {
+					result.Errors = append(result.Errors, CSVRowError{Line: parseErr.Line, Error: parseErr.Err.Error()})
+					return errImportRollback
+				}
+				return err
+			}
+			line, _ := reader.FieldPos(0)
+			result.Rows++
+
+			values := make(map[string]string)
+			for i, value := range record {
+				if i < len(fields) && fields[i] != "" {
+					values[fields[i]] = csvUnescape(strings.TrimSpace(value))
+				}
+			}
+			task, rowErr, err := csvTask(tx, values, userID)
+			if err != nil {
+				return err
+			}
+			if rowErr != nil {
+				rowErr.Line = line
+				result.Errors = append(result.Errors, *rowErr)
+				continue
+			}
+			if err := tx.Create(&task).Error; err != nil {
+				return err
+			}
+			created = append(created, task)
+		}
+		if dryRun || len(result.Errors) > 0 {
+			return errImportRollback
+		}
+		return nil
+	})
+	if err != nil && err != errImportRollback {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not import tasks", "details": err.Error()})
+		return
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{"data": result})
+		return
+	}
+	if len(result.Errors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid rows",
+			"details": fmt.Sprintf("%d of %d rows are invalid, so nothing was imported", len(result.Errors), result.Rows),
+			"data":    result,
+		})
+		return
+	}
+	for _, task := range created {
+		notifyTaskChanges(DB, userID, Task{}, task)
+		result.TaskIDs = append(result.TaskIDs, task.ID)
+	}
+	result.Imported = len(created)
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// csvTask builds a task from the values of a row, validating them like
+// CreateTask. Tasks are assigned to the importing user unless the row has
+// a userId.
+func csvTask(db *gorm.DB, values map[string]string, userID uint) (Task, *CSVRowError, error) {
+	input := NewTask{
+		Task:        values["task"],
+		Description: values["description"],
+		Priority:    TaskPriority(values["priority"]),
+		Category:    values["category"],
+		UserID:      int(userID),
+	}
+	if value := values["dueDate"]; value != "" {
+		due, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return Task{}, &CSVRowError{Column: "dueDate", Error: fmt.Sprintf("invalid time %q, expected RFC 3339", value)}, nil
+		}
+		input.DueDate = &due
+	}
+	if value := values["userId"]; value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return Task{}, &CSVRowError{Column: "userId", Error: fmt.Sprintf("invalid user ID %q", value)}, nil
+		}
+		input.UserID = id
+	}
+	if value := values["projectId"]; value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return Task{}, &CSVRowError{Column: "projectId", Error: fmt.Sprintf("invalid project ID %q", value)}, nil
+		}
+		projectID := uint(id)
+		input.ProjectID = &projectID
+	}
+	if value := values["tags"]; value != "" {
+		input.Tags = strings.Split(value, ",")
+	}
+	if err := binding.Validator.ValidateStruct(&input); err != nil {
+		return Task{}, &CSVRowError{Error: err.Error()}, nil
+	}
+
+	task, err := newTask(db, input)
+	var invalid *taskInputError
+	if errors.As(err, &invalid) {
+		return Task{}, &CSVRowError{Error: invalid.Error()}, nil
+	}
+	if err != nil {
+		return Task{}, nil, err
+	}
+	if value := values["status"]; value != "" {
+		status := TaskStatus(value)
+		if !status.Valid() {
+			return Task{}, &CSVRowError{Column: "status", Error: fmt.Sprintf("unknown status %q", value)}, nil
+		}
+		task.setStatus(status, time.Now())
+	}
+	return task, nil, nil
+}
+
+// taskCSVRecord renders a task as a row of taskCSVColumns
+func taskCSVRecord(task Task) []string {
+	tags := make([]string, len(task.Tags))
+	for i, tag := range task.Tags {
+		tags[i] = tag.Name
+	}
+	projectID := ""
+	if task.ProjectID != nil {
+		projectID = strconv.FormatUint(uint64(*task.ProjectID), 10)
+	}
+	return []string{
+		strconv.FormatUint(uint64(task.ID), 10),
+		csvEscape(task.Task),
+		csvEscape(task.Description),
+		string(task.Priority),
+		string(task.Status),
+		csvEscape(task.Category),
+		csvTime(task.DueDate),
+		csvEscape(strings.Join(tags, ", ")),
+		strconv.Itoa(task.UserID),
+		projectID,
+		csvTime(&task.CreatedAt),
+		csvTime(task.CompletedAt),
+	}
+}
+
+// csvFormula reports whether a spreadsheet would run a cell as a formula,
+// or whether it is one escaped with a quote
+func csvFormula(value string) bool {
+	if value == "" {
+		return false
+	}
+	switch value[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return true
+	case '\'':
+		return csvFormula(value[1:])
+	}
+	return false
+}
+
+// csvEscape quotes text that a spreadsheet would run as a formula with a
+// leading apostrophe, which it shows as text
+func csvEscape(value string) string {
+	if csvFormula(value) {
+		return "'" + value
+	}
+	return value
+}
+
+// csvUnescape removes the quote csvEscape adds
+func csvUnescape(value string) string {
+	if strings.HasPrefix(value, "'") && csvFormula(value[1:]) {
+		return value[1:]
+	}
+	return value
+}
+
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
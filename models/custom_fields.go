@@ -0,0 +1,524 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/KingLeak95/todo-list-go/pkg/filter"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CustomFieldType is the kind of value a custom field holds
+type CustomFieldType string
+
+const (
+	FieldText        CustomFieldType = "text"
+	FieldNumber      CustomFieldType = "number"
+	FieldDate        CustomFieldType = "date"
+	FieldSelect      CustomFieldType = "select"
+	FieldMultiSelect CustomFieldType = "multiselect"
+	FieldCheckbox    CustomFieldType = "checkbox"
+)
+
+// Valid reports whether t is a known field type
+func (t CustomFieldType) Valid() bool {
+	switch t {
+	case FieldText, FieldNumber, FieldDate, FieldSelect, FieldMultiSelect, FieldCheckbox:
+		return true
+	}
+	return false
+}
+
+// customFieldKeyPattern restricts keys so they can be embedded in JSON paths
+var customFieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// CustomFieldDefinition declares a typed field for the tasks of a project,
+// or for every task when it has no project. Tasks reference it as cf.<key>
+// in filters and sorts, so a key has the same type in every project that
+// uses it.
+type CustomFieldDefinition struct {
+	ID uint `gorm:"primarykey" json:"id"`
+	// ProjectID is nil for workspace fields
+	ProjectID *uint           `gorm:"uniqueIndex:idx_project_field_key" json:"projectId"`
+	Key       string          `gorm:"type:varchar(64);uniqueIndex:idx_project_field_key;index" json:"key"`
+	Name      string          `gorm:"type:varchar(255)" json:"name"`
+	Type      CustomFieldType `gorm:"type:varchar(20)" json:"type"`
+	// Options lists the choices of select and multiselect fields
+	Options   []string  `gorm:"type:text;serializer:json" json:"options,omitempty"`
+	Required  bool      `json:"required"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type NewCustomField struct {
+	Key      string          `json:"key" binding:"required"`
+	Name     string          `json:"name" binding:"required"`
+	Type     CustomFieldType `json:"type" binding:"required" enums:"text,number,date,select,multiselect,checkbox"`
+	Options  []string        `json:"options"`
+	Required bool            `json:"required"`
+}
+
+// CustomFieldValues holds a task's custom field values keyed by field key.
+// Dates are stored as YYYY-MM-DD and multiselect values as string lists.
+type CustomFieldValues map[string]interface{}
+
+// CreateCustomField adds a custom field definition to a project
+// @Summary Define a custom field
+// @Description Admins only. Keys are lower-case identifiers and keep one type across projects.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Param field body NewCustomField true "Field definition"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /projects/{id}/fields [post]
+func CreateCustomField(c *gin.Context) {
+	project, ok := findProject(c, DB)
+	if !ok {
+		return
+	}
+	createCustomField(c, &project.ID)
+}
+
+// GetWorkspaceFields lists the custom fields that apply to every task
+// @Summary List workspace custom fields
+// @Tags projects
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /fields [get]
+func GetWorkspaceFields(c *gin.Context) {
+	var fields []CustomFieldDefinition
+	if err := DB.Where("project_id IS NULL").Order("id ASC").Find(&fields).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve custom fields"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": fields})
+}
+
+// CreateWorkspaceField adds a custom field definition that applies to every
+// task, with or without a project
+// @Summary Define a workspace custom field
+// @Description Admins only. The key cannot also be defined by a project.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param field body NewCustomField true "Field definition"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /fields [post]
+func CreateWorkspaceField(c *gin.Context) {
+	createCustomField(c, nil)
+}
+
+// createCustomField binds and stores a definition for the project, or for
+// the workspace when projectID is nil
+func createCustomField(c *gin.Context, projectID *uint) {
+	var input NewCustomField
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+		return
+	}
+	definition := CustomFieldDefinition{
+		ProjectID: projectID,
+		Key:       input.Key,
+		Name:      input.Name,
+		Type:      input.Type,
+		Options:   input.Options,
+		Required:  input.Required,
+	}
+	if err := validateCustomFieldDefinition(DB, definition); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid custom field", "details": err.Error()})
+		return
+	}
+
+	if err := DB.Create(&definition).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create custom field", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": definition})
+}
+
+// DeleteCustomField removes a custom field definition. Values already stored
+// on tasks are dropped the next time their custom fields are updated.
+// @Summary Delete a custom field
+// @Description Admins only
+// @Tags projects
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Param fieldId path int true "Field ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /projects/{id}/fields/{fieldId} [delete]
+func DeleteCustomField(c *gin.Context) {
+	result := DB.Where("id = ? AND project_id = ?", c.Param("fieldId"), c.Param("id")).Delete(&CustomFieldDefinition{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete custom field"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Custom field not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": c.Param("fieldId")})
+}
+
+// DeleteWorkspaceField removes a workspace custom field definition
+// @Summary Delete a workspace custom field
+// @Description Admins only
+// @Tags projects
+// @Produce json
+// @Security BearerAuth
+// @Param fieldId path int true "Field ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /fields/{fieldId} [delete]
+func DeleteWorkspaceField(c *gin.Context) {
+	result := DB.Where("id = ? AND project_id IS NULL", c.Param("fieldId")).Delete(&CustomFieldDefinition{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete custom field"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Custom field not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": c.Param("fieldId")})
+}
+
+// validateCustomFieldDefinition checks a new definition, including that its
+// key is not used with another type elsewhere, nor by both the workspace and
+// a project
+func validateCustomFieldDefinition(db *gorm.DB, d CustomFieldDefinition) error {
+	if !customFieldKeyPattern.MatchString(d.Key) {
+		return fmt.Errorf("key %q must start with a lower-case letter and contain only a-z, 0-9 and _", d.Key)
+	}
+	if !d.Type.Valid() {
+		return fmt.Errorf("invalid type %q", d.Type)
+	}
+	hasOptions := d.Type == FieldSelect || d.Type == FieldMultiSelect
+	if hasOptions && len(d.Options) == 0 {
+		return fmt.Errorf("%s fields need options", d.Type)
+	}
+	if !hasOptions && len(d.Options) > 0 {
+		return fmt.Errorf("%s fields cannot have options", d.Type)
+	}
+
+	var existing []CustomFieldDefinition
+	if err := db.Where("key = ?", d.Key).Find(&existing).Error; err != nil {
+		return err
+	}
+	for _, other := range existing {
+		switch {
+		case other.ProjectID == nil && d.ProjectID == nil:
+			return fmt.Errorf("the workspace already has a field %q", d.Key)
+		case other.ProjectID == nil:
+			return fmt.Errorf("%q is already a workspace field", d.Key)
+		case d.ProjectID == nil:
+			return fmt.Errorf("key %q is already used by a project", d.Key)
+		case *other.ProjectID == *d.ProjectID:
+			return fmt.Errorf("the project already has a field %q", d.Key)
+		}
+		if other.Type != d.Type {
+			return fmt.Errorf("key %q is already used as a %s field", d.Key, other.Type)
+		}
+	}
+	return nil
+}
+
+// normalize validates a value for the field and returns its stored form
+func (d CustomFieldDefinition) normalize(value interface{}) (interface{}, error) {
+	switch d.Type {
+	case FieldText:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case FieldNumber:
+		if n, ok := value.(float64); ok {
+			return n, nil
+		}
+	case FieldCheckbox:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case FieldDate:
+		if s, ok := value.(string); ok {
+			t, err := parseDateParam(s)
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %v", d.Key, err)
+			}
+			return t.Format("2006-01-02"), nil
+		}
+	case FieldSelect:
+		if s, ok := value.(string); ok {
+			return d.option(s)
+		}
+	case FieldMultiSelect:
+		if items, ok := value.([]interface{}); ok {
+			selected := make(map[string]bool)
+			for _, item := range items {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("field %q expects a list of options", d.Key)
+				}
+				option, err := d.option(s)
+				if err != nil {
+					return nil, err
+				}
+				selected[option] = true
+			}
+			// Keep the definition's order so equal selections compare equal
+			values := []string{}
+			for _, option := range d.Options {
+				if selected[option] {
+					values = append(values, option)
+				}
+			}
+			return values, nil
+		}
+	}
+	return nil, fmt.Errorf("field %q expects a %s value", d.Key, d.Type)
+}
+
+// option matches a value against the field's options, ignoring case
+func (d CustomFieldDefinition) option(value string) (string, error) {
+	for _, option := range d.Options {
+		if strings.EqualFold(option, value) {
+			return option, nil
+		}
+	}
+	return "", fmt.Errorf("field %q: invalid option %q, expected one of %s", d.Key, value, strings.Join(d.Options, ", "))
+}
+
+// resolveCustomFields validates a patch of custom field values against the
+// workspace's definitions and the project's, and merges it into current. A
+// null value clears a field; values of fields no longer defined are dropped.
+func resolveCustomFields(db *gorm.DB, projectID *uint, current CustomFieldValues, patch map[string]interface{}) (CustomFieldValues, error) {
+	query := db.Where("project_id IS NULL")
+	if projectID != nil {
+		var project Project
+		if err := db.Select("id").First(&project, *projectID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, fmt.Errorf("project %d not found", *projectID)
+			}
+			return nil, err
+		}
+		query = db.Where("project_id IS NULL OR project_id = ?", project.ID)
+	}
+	var fields []CustomFieldDefinition
+	if err := query.Find(&fields).Error; err != nil {
+		return nil, err
+	}
+	definitions := make(map[string]CustomFieldDefinition, len(fields))
+	for _, d := range fields {
+		definitions[d.Key] = d
+	}
+
+	values := CustomFieldValues{}
+	for key, value := range current {
+		if _, ok := definitions[key]; ok {
+			values[key] = value
+		}
+	}
+	for key, value := range patch {
+		d, ok := definitions[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown custom field %q", key)
+		}
+		if value == nil {
+			delete(values, key)
+			continue
+		}
+		normalized, err := d.normalize(value)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = normalized
+	}
+	for _, key := range sortedKeys(definitions) {
+		if _, ok := values[key]; !ok && definitions[key].Required {
+			return nil, fmt.Errorf("custom field %q is required", key)
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return values, nil
+}
+
+// workspaceCustomFields keeps the values of workspace fields, which stay
+// with a task when it changes project
+func workspaceCustomFields(db *gorm.DB, values CustomFieldValues) (CustomFieldValues, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	var keys []string
+	if err := db.Model(&CustomFieldDefinition{}).Where("project_id IS NULL").Pluck("key", &keys).Error; err != nil {
+		return nil, err
+	}
+	kept := CustomFieldValues{}
+	for _, key := range keys {
+		if value, ok := values[key]; ok {
+			kept[key] = value
+		}
+	}
+	return kept, nil
+}
+
+// lookupCustomField resolves a key used in a filter or sort to its type and
+// the options of every project defining it
+func lookupCustomField(db *gorm.DB, key string) (CustomFieldDefinition, bool) {
+	if !customFieldKeyPattern.MatchString(key) {
+		return CustomFieldDefinition{}, false
+	}
+	var definitions []CustomFieldDefinition
+	if err := db.Where("key = ?", key).Order("id ASC").Find(&definitions).Error; err != nil || len(definitions) == 0 {
+		return CustomFieldDefinition{}, false
+	}
+	merged := definitions[0]
+	seen := make(map[string]bool)
+	merged.Options = nil
+	for _, d := range definitions {
+		for _, option := range d.Options {
+			if !seen[option] {
+				seen[option] = true
+				merged.Options = append(merged.Options, option)
+			}
+		}
+	}
+	return merged, true
+}
+
+// customFieldName extracts the key from a `cf.<key>` reference
+func customFieldName(name string) (string, bool) {
+	if len(name) > 3 && strings.EqualFold(name[:3], "cf.") {
+		return strings.ToLower(name[3:]), true
+	}
+	return "", false
+}
+
+// valueExpr selects the field's value from a task row as SQL suited to its
+// type. Values of another JSON type, left behind by a deleted definition of
+// the same key, read as NULL rather than failing the cast. Keys are
+// validated, so they can be embedded in the JSON path.
+func (d CustomFieldDefinition) valueExpr(db *gorm.DB) string {
+	if db.Dialector.Name() == "postgres" {
+		value := "(CAST(tasks.custom_fields AS JSONB) -> '" + d.Key + "')"
+		raw := "(CAST(tasks.custom_fields AS JSONB) ->> '" + d.Key + "')"
+		switch d.Type {
+		case FieldNumber:
+			return "(CASE WHEN jsonb_typeof(" + value + ") = 'number' THEN CAST(" + raw + " AS DOUBLE PRECISION) END)"
+		case FieldCheckbox:
+			return "(CASE WHEN jsonb_typeof(" + value + ") = 'boolean' THEN CAST(" + raw + " AS BOOLEAN) END)"
+		}
+		return raw
+	}
+	path := "tasks.custom_fields, '$." + d.Key + "'"
+	raw := "json_extract(" + path + ")"
+	switch d.Type {
+	case FieldNumber:
+		return "(CASE WHEN json_type(" + path + ") IN ('integer', 'real') THEN CAST(" + raw + " AS REAL) END)"
+	case FieldCheckbox:
+		return "(CASE WHEN json_type(" + path + ") IN ('true', 'false') THEN " + raw + " END)"
+	}
+	return raw
+}
+
+// containsExpr tests whether a multiselect field includes the value bound to
+// its placeholder
+func (d CustomFieldDefinition) containsExpr(db *gorm.DB) string {
+	if db.Dialector.Name() == "postgres" {
+		return "(CAST(tasks.custom_fields AS JSONB) -> '" + d.Key + "') @> jsonb_build_array(CAST(? AS TEXT))"
+	}
+	return "EXISTS (SELECT 1 FROM json_each(tasks.custom_fields, '$." + d.Key + "') WHERE json_each.value = ?)"
+}
+
+// filterField describes the field to the filter language
+func (d CustomFieldDefinition) filterField(db *gorm.DB) filter.Field {
+	switch d.Type {
+	case FieldNumber:
+		return filter.Field{Column: d.valueExpr(db), Type: filter.Number}
+	case FieldDate:
+		return filter.Field{Column: d.valueExpr(db), Type: filter.Day}
+	case FieldCheckbox:
+		return filter.Field{Column: d.valueExpr(db), Type: filter.Bool}
+	case FieldSelect:
+		return filter.Field{Column: d.valueExpr(db), Type: filter.String, Values: d.Options}
+	case FieldMultiSelect:
+		return filter.Field{Column: d.containsExpr(db), Type: filter.List, Values: d.Options}
+	}
+	return filter.Field{Column: d.valueExpr(db), Type: filter.Text}
+}
+
+// sortKey describes the field as a sort key; multiselect fields cannot be
+// sorted
+func (d CustomFieldDefinition) sortKey(db *gorm.DB) (taskSortKey, bool) {
+	key := d.Key
+	raw := func(t *Task) interface{} {
+		if t.CustomFields == nil {
+			return nil
+		}
+		return t.CustomFields[key]
+	}
+	switch d.Type {
+	case FieldMultiSelect:
+		return taskSortKey{}, false
+	case FieldCheckbox:
+		// Unset checkboxes sort as unchecked
+		return taskSortKey{
+			expr: "(CASE WHEN " + d.valueExpr(db) + " THEN 1 ELSE 0 END)",
+			kind: sortKeyNumber,
+			value: func(t *Task) interface{} {
+				if checked, _ := raw(t).(bool); checked {
+					return 1
+				}
+				return 0
+			},
+		}, true
+	case FieldNumber:
+		number := func(t *Task) interface{} {
+			if n, ok := raw(t).(float64); ok {
+				return n
+			}
+			return nil
+		}
+		return taskSortKey{expr: d.valueExpr(db), kind: sortKeyNumber, nullable: true, value: number}, true
+	}
+	return taskSortKey{expr: d.valueExpr(db), kind: sortKeyString, nullable: true, value: raw}, true
+}
+
+// taskFilterSchema resolves the built-in task filter fields and custom
+// fields referenced as cf.<key>
+type taskFilterSchema struct {
+	db *gorm.DB
+}
+
+// Lookup implements filter.Schema
+func (s taskFilterSchema) Lookup(name string) (filter.Field, bool) {
+	if field, ok := taskFilterFields.Lookup(name); ok {
+		return field, true
+	}
+	key, ok := customFieldName(name)
+	if !ok {
+		return filter.Field{}, false
+	}
+	definition, ok := lookupCustomField(s.db, key)
+	if !ok {
+		return filter.Field{}, false
+	}
+	return definition.filterField(s.db), true
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TaskDependency records that a task cannot start until another is done. A
+// task is blocked while any of its blockers is still pending.
+type TaskDependency struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	TaskID      uint      `gorm:"uniqueIndex:idx_task_dependency" json:"taskId"`
+	BlockedByID uint      `gorm:"uniqueIndex:idx_task_dependency;index" json:"blockedById"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type NewTaskDependency struct {
+	BlockedByID uint `json:"blockedById" binding:"required"`
+}
+
+// blockedCondition is true for tasks with a pending blocker
+const blockedCondition = `EXISTS (SELECT 1 FROM task_dependencies dep
+	JOIN tasks blocker ON blocker.id = dep.blocked_by_id
+	WHERE dep.task_id = tasks.id AND blocker.status = 'pending' AND blocker.deleted_at IS NULL)`
+
+// GetTaskDependencies lists the tasks blocking a task
+// @Summary List a task's blockers
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id}/dependencies [get]
+func GetTaskDependencies(c *gin.Context) {
+	task, ok := findTask(c)
+	if !ok {
+		return
+	}
+	var blockers []Task
+	err := DB.Where("id IN (?)", DB.Model(&TaskDependency{}).Select("blocked_by_id").Where("task_id = ?", task.ID)).
+		Order("id ASC").Find(&blockers).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve dependencies"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": blockers})
+}
+
+// AddTaskDependency marks a task as blocked by another
+// @Summary Add a blocker to a task
+// @Description Dependencies that would form a cycle are rejected
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param dependency body NewTaskDependency true "Blocking task"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id}/dependencies [post]
+func AddTaskDependency(c *gin.Context) {
+	task, ok := findTask(c)
+	if !ok {
+		return
+	}
+	var input NewTaskDependency
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+		return
+	}
+
+	var blocker Task
+	if err := DB.First(&blocker, input.BlockedByID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Blocking task not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve task"})
+		}
+		return
+	}
+	cycle, err := dependsOn(DB, blocker.ID, task.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check dependencies", "details": err.Error()})
+		return
+	}
+	if cycle {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Dependency would create a cycle"})
+		return
+	}
+
+	dependency := TaskDependency{TaskID: task.ID, BlockedByID: blocker.ID}
+	if err := DB.Where(dependency).FirstOrCreate(&dependency).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not add dependency", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": dependency})
+}
+
+// RemoveTaskDependency unblocks a task from one of its blockers
+// @Summary Remove a blocker from a task
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param blockerId path int true "Blocking task ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id}/dependencies/{blockerId} [delete]
+func RemoveTaskDependency(c *gin.Context) {
+	blockerID, err := strconv.ParseUint(c.Param("blockerId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid blocker ID"})
+		return
+	}
+	result := DB.Where("task_id = ? AND blocked_by_id = ?", c.Param("id"), blockerID).Delete(&TaskDependency{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not remove dependency"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dependency not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": c.Param("blockerId")})
+}
+
+// dependsOn reports whether task id is blocked, directly or transitively, by
+// target
+func dependsOn(db *gorm.DB, id, target uint) (bool, error) {
+	seen := map[uint]bool{id: true}
+	frontier := []uint{id}
+	for len(frontier) > 0 {
+		if seen[target] {
+			return true, nil
+		}
+		var next []uint
+		if err := db.Model(&TaskDependency{}).Where("task_id IN ?", frontier).Pluck("blocked_by_id", &next).Error; err != nil {
+			return false, err
+		}
+		frontier = frontier[:0]
+		for _, blockerID := range next {
+			if !seen[blockerID] {
+				seen[blockerID] = true
+				frontier = append(frontier, blockerID)
+			}
+		}
+	}
+	return seen[target], nil
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DuplicateTaskRequest selects what is copied when duplicating a task.
+// Copy flags default to true when omitted.
+type DuplicateTaskRequest struct {
+	Task        *string `json:"task,omitempty"`
+	Description *bool   `json:"description,omitempty"`
+	Category    *bool   `json:"category,omitempty"`
+	Tags        *bool   `json:"tags,omitempty"`
+	Checklist   *bool   `json:"checklist,omitempty"`
+	Attachments *bool   `json:"attachments,omitempty"`
+	// Subtasks duplicates the whole subtree below the task
+	Subtasks bool `json:"subtasks"`
+	// DueDateOffsetDays copies due dates shifted by this many days; due
+	// dates are dropped when it is omitted
+	DueDateOffsetDays *int `json:"dueDateOffsetDays,omitempty"`
+}
+
+func (r DuplicateTaskRequest) copies(flag *bool) bool {
+	return flag == nil || *flag
+}
+
+// DuplicateTask clones a task, and optionally its subtree
+// @Summary Duplicate a task
+// @Description Copy a task with the selected data. The clone is always pending; attachments are copied by reference.
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param options body DuplicateTaskRequest false "What to copy"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /tasks/{id}/duplicate [post]
+func DuplicateTask(c *gin.Context) {
+	var input DuplicateTaskRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+			return
+		}
+	}
+
+	var original Task
+	if err := DB.Where("id = ?", c.Param("id")).First(&original).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve task"})
+		}
+		return
+	}
+
+	var clone Task
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		clone, err = duplicateTask(tx, original.ID, original.ParentID, input, map[uint]bool{})
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not duplicate task", "details": err.Error()})
+		return
+	}
+	actorID, _ := currentUserID(c)
+	var publish func(task Task)
+	publish = func(task Task) {
+		notifyTaskChanges(DB, actorID, Task{}, task)
+		for _, subtask := range task.Subtasks {
+			publish(subtask)
+		}
+	}
+	publish(clone)
+
+	c.JSON(http.StatusCreated, gin.H{"data": clone})
+}
+
+// duplicateTask copies a single task below parentID and, when requested,
+// recurses into its subtasks. seen holds the tasks copied so far, which is
+// empty for the root and stops a cycle of parents from recursing forever.
+// The returned task has its copied relations set.
+func duplicateTask(tx *gorm.DB, id uint, parentID *uint, input DuplicateTaskRequest, seen map[uint]bool) (Task, error) {
+	if seen[id] {
+		return Task{}, fmt.Errorf("task %d is its own subtask", id)
+	}
+	root := len(seen) == 0
+	seen[id] = true
+
+	var original Task
+	err := tx.Preload("Tags").
+		Preload("Checklist", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC, id ASC") }).
+		Preload("Attachments", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }).
+		First(&original, id).Error
+	if err != nil {
+		return Task{}, err
+	}
+
+	clone := Task{
+		Task:         original.Task,
+		Priority:     original.Priority,
+		Status:       StatusPending,
+		UserID:       original.UserID,
+		ParentID:     parentID,
+		ProjectID:    original.ProjectID,
+		CustomFields: original.CustomFields,
+		Recurrence:   original.Recurrence,
+	}
+	if root && input.Task != nil {
+		clone.Task = *input.Task
+	}
+	if input.copies(input.Description) {
+		clone.Description = original.Description
+	}
+	if input.copies(input.Category) {
+		clone.Category = original.Category
+	}
+	if input.copies(input.Tags) {
+		clone.Tags = original.Tags
+	}
+	if input.DueDateOffsetDays != nil && original.DueDate != nil {
+		due := original.DueDate.AddDate(0, 0, *input.DueDateOffsetDays)
+		clone.DueDate = &due
+	}
+	if input.copies(input.Checklist) {
+		for _, item := range original.Checklist {
+			clone.Checklist = append(clone.Checklist, ChecklistItem{Text: item.Text, Position: item.Position})
+		}
+	}
+	if input.copies(input.Attachments) {
+		for _, attachment := range original.Attachments {
+			clone.Attachments = append(clone.Attachments, Attachment{
+				FileName:    attachment.FileName,
+				ContentType: attachment.ContentType,
+				Size:        attachment.Size,
+				URL:         attachment.URL,
+			})
+		}
+	}
+
+	if err := tx.Create(&clone).Error; err != nil {
+		return Task{}, err
+	}
+
+	if input.Subtasks {
+		var childIDs []uint
+		if err := tx.Model(&Task{}).Where("parent_id = ?", original.ID).Order("id ASC").Pluck("id", &childIDs).Error; err != nil {
+			return Task{}, err
+		}
+		for _, childID := range childIDs {
+			child, err := duplicateTask(tx, childID, &clone.ID, input, seen)
+			if err != nil {
+				return Task{}, err
+			}
+			clone.Subtasks = append(clone.Subtasks, child)
+		}
+	}
+
+	return clone, nil
+}
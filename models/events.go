@@ -0,0 +1,199 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/KingLeak95/todo-list-go/pkg/events"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Task event types
+const (
+	EventTaskCreated   = "task.created"
+	EventTaskUpdated   = "task.updated"
+	EventTaskCompleted = "task.completed"
+	EventTaskDeleted   = "task.deleted"
+)
+
+// eventSubscriberBuffer is how many events a stream may fall behind before
+// it is closed, to be resumed by the client
+const eventSubscriberBuffer = 64
+
+// taskEvents carries task changes to event streams, replaying the last
+// EVENT_BUFFER_SIZE (default 1000) to clients that resume
+var taskEvents = events.NewBroker(getEnvInt("EVENT_BUFFER_SIZE", 1000))
+
+// TaskEvent is the data of a task event. Task is the task after the change,
+// or as it was when deleted.
+type TaskEvent struct {
+	ID      uint64    `json:"id"`
+	Type    string    `json:"type"`
+	TaskID  uint      `json:"taskId"`
+	ActorID uint      `json:"actorId,omitempty"`
+	At      time.Time `json:"at"`
+	Task    Task      `json:"task"`
+}
+
+// eventStreams counts the open event streams of each user
+var eventStreams = newConnectionCounter()
+
+// connectionCounter counts the long-lived connections of each user
+type connectionCounter struct {
+	mu     sync.Mutex
+	byUser map[uint]int
+}
+
+func newConnectionCounter() *connectionCounter {
+	return &connectionCounter{byUser: make(map[uint]int)}
+}
+
+// open counts a new connection unless the user already has max
+func (c *connectionCounter) open(userID uint, max int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byUser[userID] >= max {
+		return false
+	}
+	c.byUser[userID]++
+	return true
+}
+
+func (c *connectionCounter) close(userID uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byUser[userID]--; c.byUser[userID] <= 0 {
+		delete(c.byUser, userID)
+	}
+}
+
+// publishTaskEvent publishes a change saved by actorID. before is the zero
+// Task for a new task.
+func publishTaskEvent(actorID uint, before, after Task) {
+	eventType := EventTaskUpdated
+	switch {
+	case before.ID == 0:
+		eventType = EventTaskCreated
+	case after.Status == StatusCompleted && before.Status != StatusCompleted:
+		eventType = EventTaskCompleted
+	}
+	publishTask(eventType, actorID, after)
+}
+
+func publishTask(eventType string, actorID uint, task Task) {
+	task.User, task.Project = nil, nil
+	taskEvents.Publish(eventType, TaskEvent{Type: eventType, TaskID: task.ID, ActorID: actorID, At: time.Now().UTC(), Task: task})
+}
+
+// publishCreatedTasks publishes the tasks an import created, once its
+// transaction has committed
+func publishCreatedTasks(db *gorm.DB, actorID uint, taskIDs []uint) {
+	if len(taskIDs) == 0 {
+		return
+	}
+	var tasks []Task
+	if err := db.Preload("Tags").Where("id IN ?", taskIDs).Order("id ASC").Find(&tasks).Error; err != nil {
+		return
+	}
+	for _, task := range tasks {
+		publishTask(EventTaskCreated, actorID, task)
+	}
+}
+
+// StreamEvents pushes task changes to the caller as server-sent events
+// @Summary Stream task events
+// @Description A text/event-stream of task.created, task.updated, task.completed and task.deleted events for the tasks GET /tasks lists, optionally narrowed to one assignee with `userId`. Each event's data is a JSON object with the task as changed. Clients that reconnect with a Last-Event-ID header (or `lastEventId`) get the events they missed from a bounded buffer; when that is not possible a `reset` event tells them to reload. Comment heartbeats keep the connection open. Each user may have a few streams open at once.
+// @Tags events
+// @Produce text/event-stream
+// @Security BearerAuth
+// @Param userId query int false "Only tasks assigned to this user"
+// @Param lastEventId query string false "Resume after this event, for clients that cannot send Last-Event-ID"
+// @Success 200 {string} string "Event stream"
+// @Failure 401 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /events [get]
+func StreamEvents(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	var assignee *int
+	if value := c.Query("userId"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": fmt.Sprintf("invalid user ID %q", value)})
+			return
+		}
+		assignee = &id
+	}
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+
+	if max := getEnvInt("EVENT_STREAMS_PER_USER", 5); !eventStreams.open(userID, max) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many event streams", "details": fmt.Sprintf("at most %d streams may be open per user", max)})
+		return
+	}
+	defer eventStreams.close(userID)
+
+	after, err := strconv.ParseUint(lastEventID, 10, 64)
+	sub, replay, complete := taskEvents.Subscribe(eventSubscriberBuffer, lastEventID != "", after)
+	defer sub.Close()
+	if err != nil && lastEventID != "" {
+		complete = false
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Keep proxies such as nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	send := func(event events.Event) {
+		data, ok := event.Data.(TaskEvent)
+		if !ok || (assignee != nil && data.Task.UserID != *assignee) {
+			return
+		}
+		data.ID = event.ID
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, payload)
+	}
+	for _, event := range replay {
+		send(event)
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(time.Duration(getEnvInt("EVENT_HEARTBEAT_SECONDS", 25)) * time.Second)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// The stream fell behind; the client resumes from its last event
+				return
+			}
+			send(event)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		w.Flush()
+	}
+}
@@ -0,0 +1,330 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxImportBytes caps the size of an uploaded import file
+const maxImportBytes = 10 << 20
+
+// exportBatchSize is the number of tasks read per query while an export
+// streams
+const exportBatchSize = 500
+
+// errImportRollback discards the transaction of a dry run or a failed import
+var errImportRollback = errors.New("rollback")
+
+// ImportIssue describes an item an import skipped or rejected
+type ImportIssue struct {
+	// Index is the position of the item in the file, counting from 0
+	Index   int    `json:"index"`
+	UID     string `json:"uid,omitempty"`
+	Summary string `json:"summary,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// ImportResult reports what an import created and which items it left out:
+// skipped items were recognised but not imported, for example because they
+// were imported before, and invalid items could not be read.
+type ImportResult struct {
+	Imported int           `json:"imported"`
+	TaskIDs  []uint        `json:"taskIds"`
+	Skipped  []ImportIssue `json:"skipped"`
+	Invalid  []ImportIssue `json:"invalid"`
+}
+
+func newImportResult() ImportResult {
+	return ImportResult{TaskIDs: []uint{}, Skipped: []ImportIssue{}, Invalid: []ImportIssue{}}
+}
+
+func (r *ImportResult) skip(index int, uid, summary, reason string) {
+	r.Skipped = append(r.Skipped, ImportIssue{Index: index, UID: uid, Summary: summary, Reason: reason})
+}
+
+func (r *ImportResult) invalid(index int, uid, summary string, err error) {
+	r.Invalid = append(r.Invalid, ImportIssue{Index: index, UID: uid, Summary: summary, Reason: err.Error()})
+}
+
+// readImportFile reads an import from the multipart `file` field, or from
+// the raw request body when the request is not a multipart form
+func readImportFile(c *gin.Context) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	var r io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("expected the import in a `file` field: %v", err)
+		}
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, fmt.Errorf("import is larger than %d MB", maxImportBytes>>20)
+		}
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("import is empty")
+	}
+	return data, nil
+}
+
+// importedTaskExists reports whether the user already has a task imported
+// from the item with this external ID
+func importedTaskExists(db *gorm.DB, userID uint, externalID string) (bool, error) {
+	var count int64
+	err := db.Model(&Task{}).Where("user_id = ? AND external_id = ?", userID, externalID).Count(&count).Error
+	return count > 0, err
+}
+
+// createImportedTask saves an imported task with its tags, and has the
+// importing user watch it
+func createImportedTask(db *gorm.DB, task *Task, tagNames []string) error {
+	if len(tagNames) > 0 {
+		tags, err := findOrCreateTags(db, tagNames)
+		if err != nil {
+			return err
+		}
+		task.Tags = tags
+	}
+	if err := db.Create(task).Error; err != nil {
+		return err
+	}
+	return watchTask(db, task.ID, uint(task.UserID))
+}
+
+// isAncestor reports whether ancestor is the task id or one of its parents,
+// in which case making ancestor a subtask of id would create a cycle
+func isAncestor(db *gorm.DB, id, ancestor uint) (bool, error) {
+	seen := make(map[uint]bool)
+	for current := id; !seen[current]; {
+		if current == ancestor {
+			return true, nil
+		}
+		seen[current] = true
+		var parents []uint
+		if err := db.Model(&Task{}).Where("id = ? AND parent_id IS NOT NULL", current).Pluck("parent_id", &parents).Error; err != nil {
+			return false, err
+		}
+		if len(parents) == 0 {
+			return false, nil
+		}
+		current = parents[0]
+	}
+	return false, nil
+}
+
+// streamTaskExport writes the tasks matching the listing filters and sort
+// in the query string as a download. Tasks are read in batches with keyset
+// pagination and each batch is written and flushed before the next is
+// read, so exports are not held in memory. write is called at least once,
+// with first set on the first batch.
+func streamTaskExport(c *gin.Context, contentType, filename string, write func(tasks []Task, first bool) error) {
+	var query TaskQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+	queryBuilder, err := applyTaskFilters(tasksWithUrgency(DB, time.Now()), query)
+	if err != nil {
+		respondFilterError(c, err)
+		return
+	}
+	order, err := taskSortFromQuery(DB, query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+	queryBuilder = queryBuilder.Session(&gorm.Session{})
+
+	nextBatch := func(last *Task) ([]Task, error) {
+		batch := queryBuilder.Preload("Tags")
+		if last != nil {
+			values, err := order.decodeCursor(order.encodeCursor(last))
+			if err != nil {
+				return nil, err
+			}
+			condition, args := order.keysetCondition(values, false)
+			batch = batch.Where(condition, args...)
+		}
+		var tasks []Task
+		err := batch.Order(order.orderClause(false)).Limit(exportBatchSize).Find(&tasks).Error
+		return tasks, err
+	}
+	tasks, err := nextBatch(nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve tasks", "details": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+	for first := true; ; first = false {
+		if err := write(tasks, first); err != nil {
+			log.Printf("export %s: %v", filename, err)
+			return
+		}
+		c.Writer.Flush()
+		if len(tasks) < exportBatchSize {
+			return
+		}
+		// The status is already sent, so a failure just ends the export early
+		if tasks, err = nextBatch(&tasks[len(tasks)-1]); err != nil {
+			log.Printf("export %s: %v", filename, err)
+			return
+		}
+	}
+}
+
+// MigrationReport reports an import from another app. Unmapped counts, by
+// dotted path, the records whose fields carry data that has no counterpart
+// here and was left out.
+type MigrationReport struct {
+	ImportResult
+	DryRun         bool           `json:"dryRun"`
+	Projects       int            `json:"projects"`
+	Comments       int            `json:"comments"`
+	ChecklistItems int            `json:"checklistItems"`
+	Attachments    int            `json:"attachments"`
+	Unmapped       map[string]int `json:"unmapped"`
+}
+
+// runMigration runs an import from another app in one transaction, which is
+// rolled back on a dry run, and responds with its report
+func runMigration(c *gin.Context, unmapped map[string]int, migrate func(tx *gorm.DB, userID uint, report *MigrationReport) error) {
+	userID, _ := currentUserID(c)
+	dryRun, _ := strconv.ParseBool(c.Query("dryRun"))
+	report := MigrationReport{ImportResult: newImportResult(), DryRun: dryRun, Unmapped: unmapped}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := migrate(tx, userID, &report); err != nil {
+			return err
+		}
+		if dryRun {
+			return errImportRollback
+		}
+		return nil
+	})
+	if err != nil && err != errImportRollback {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not import tasks", "details": err.Error()})
+		return
+	}
+	if dryRun {
+		// The IDs belong to the discarded transaction
+		report.TaskIDs = []uint{}
+	}
+	publishCreatedTasks(DB, userID, report.TaskIDs)
+	c.JSON(http.StatusOK, gin.H{"data": report})
+}
+
+// unmappedFields counts the fields of a decoded JSON document that carry
+// data but are not in mapped. Paths are dotted, without array indices, and
+// objects are descended into when a mapped path lies below them.
+func unmappedFields(unmapped map[string]int, mapped map[string]bool, path string, value interface{}) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if mapped[childPath] || emptyJSON(child) {
+				continue
+			}
+			if mappedBelow(mapped, childPath) {
+				unmappedFields(unmapped, mapped, childPath, child)
+			} else {
+				unmapped[childPath]++
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			unmappedFields(unmapped, mapped, path, item)
+		}
+	default:
+		if !emptyJSON(value) {
+			unmapped[path]++
+		}
+	}
+}
+
+func mappedBelow(mapped map[string]bool, path string) bool {
+	for field := range mapped {
+		if strings.HasPrefix(field, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// emptyJSON reports whether a decoded JSON value carries no data
+func emptyJSON(value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !value
+	case float64:
+		return value == 0
+	case string:
+		return value == ""
+	case []interface{}:
+		return len(value) == 0
+	case map[string]interface{}:
+		return len(value) == 0
+	}
+	return false
+}
+
+// findOrCreateProject returns the user's project with the name, creating it
+// when there is none, so that repeated imports reuse their projects
+func findOrCreateProject(db *gorm.DB, userID uint, name, description string, report *MigrationReport) (Project, error) {
+	project := Project{Name: name, Description: description, OwnerID: userID}
+	result := db.Where("owner_id = ? AND name = ?", userID, name).FirstOrCreate(&project)
+	if result.RowsAffected > 0 {
+		report.Projects++
+	}
+	return project, result.Error
+}
+
+// migratedTask builds a pending task from another app or a template,
+// checking its fields against the column sizes
+func migratedTask(name, description, category string) (Task, error) {
+	task := Task{Task: strings.TrimSpace(name), Description: description, Category: category, Priority: PriorityMedium}
+	if task.Task == "" {
+		return task, fmt.Errorf("task has no name")
+	}
+	if utf8.RuneCountInString(task.Task) > 255 {
+		return task, fmt.Errorf("task is longer than 255 characters")
+	}
+	if utf8.RuneCountInString(task.Category) > 100 {
+		return task, fmt.Errorf("category %q is longer than 100 characters", task.Category)
+	}
+	return task, nil
+}
+
+// truncateRunes shortens s to at most n characters
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
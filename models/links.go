@@ -0,0 +1,228 @@
+package models
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TaskLinkType is the relation a link records, read from the linking task
+type TaskLinkType string
+
+const (
+	LinkDuplicates TaskLinkType = "duplicates"
+	LinkRelates    TaskLinkType = "relates"
+	LinkFollows    TaskLinkType = "follows"
+)
+
+// inverseLinkTypes names each relation as seen from the linked task
+var inverseLinkTypes = map[TaskLinkType]TaskLinkType{
+	LinkDuplicates: "duplicatedBy",
+	LinkRelates:    LinkRelates,
+	LinkFollows:    "followedBy",
+}
+
+func (t TaskLinkType) Valid() bool {
+	_, ok := inverseLinkTypes[t]
+	return ok
+}
+
+// TaskLink relates two tasks. Links are stored once and shown from both
+// ends, with the inverse relation on the target.
+type TaskLink struct {
+	ID        uint         `gorm:"primarykey" json:"id"`
+	TaskID    uint         `gorm:"uniqueIndex:idx_task_link" json:"taskId"`
+	TargetID  uint         `gorm:"uniqueIndex:idx_task_link;index" json:"targetId"`
+	Type      TaskLinkType `gorm:"type:varchar(20);uniqueIndex:idx_task_link" json:"type"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+type NewTaskLink struct {
+	Type     TaskLinkType `json:"type" binding:"required" enums:"duplicates,relates,follows"`
+	TargetID uint         `json:"targetId" binding:"required"`
+	// Cancel marks a duplicate as cancelled
+	Cancel bool `json:"cancel"`
+}
+
+// TaskLinkView is a link as seen from one of its tasks
+type TaskLinkView struct {
+	ID     uint         `json:"id"`
+	Type   TaskLinkType `json:"type"`
+	TaskID uint         `json:"taskId"`
+	Task   string       `json:"task"`
+	Status TaskStatus   `json:"status"`
+}
+
+// GetTaskLinks lists the links of a task in both directions
+// @Summary List a task's links
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id}/links [get]
+func GetTaskLinks(c *gin.Context) {
+	task, ok := findTask(c)
+	if !ok {
+		return
+	}
+	links, err := taskLinks(DB, task.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve links", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": links})
+}
+
+// LinkTask relates a task to another
+// @Summary Link two tasks
+// @Description Types are duplicates, relates and follows. A task duplicates at most one canonical task, and with cancel set it is cancelled.
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param link body NewTaskLink true "Link"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id}/links [post]
+func LinkTask(c *gin.Context) {
+	task, ok := findTask(c)
+	if !ok {
+		return
+	}
+	var input NewTaskLink
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+		return
+	}
+	if !input.Type.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link type", "details": "expected duplicates, relates or follows"})
+		return
+	}
+	if input.Cancel && input.Type != LinkDuplicates {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only duplicates can be cancelled"})
+		return
+	}
+	if input.TargetID == task.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A task cannot link to itself"})
+		return
+	}
+
+	var target Task
+	if err := DB.First(&target, input.TargetID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Linked task not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve task"})
+		}
+		return
+	}
+
+	// Relates is symmetric, and the other relations cannot point both ways
+	var existing int64
+	conflicts := DB.Model(&TaskLink{}).Where("task_id = ? AND target_id = ? AND type = ?", target.ID, task.ID, input.Type)
+	if input.Type == LinkDuplicates {
+		conflicts = conflicts.Or("task_id = ? AND target_id <> ? AND type = ?", task.ID, target.ID, LinkDuplicates)
+	}
+	if err := conflicts.Count(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check links", "details": err.Error()})
+		return
+	}
+	if existing > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Conflicting link", "details": "the tasks are already linked the other way, or the task already duplicates another"})
+		return
+	}
+
+	before := task
+	link := TaskLink{TaskID: task.ID, TargetID: target.ID, Type: input.Type}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(link).FirstOrCreate(&link).Error; err != nil {
+			return err
+		}
+		if input.Cancel && task.Status != StatusCancelled {
+			task.setStatus(StatusCancelled, time.Now())
+			return tx.Save(&task).Error
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not link tasks", "details": err.Error()})
+		return
+	}
+	actorID, _ := currentUserID(c)
+	notifyTaskChanges(DB, actorID, before, task)
+	c.JSON(http.StatusCreated, gin.H{"data": link})
+}
+
+// UnlinkTask removes a link from either of its tasks
+// @Summary Unlink two tasks
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param linkId path int true "Link ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id}/links/{linkId} [delete]
+func UnlinkTask(c *gin.Context) {
+	linkID, err := strconv.ParseUint(c.Param("linkId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID"})
+		return
+	}
+	result := DB.Where("id = ? AND (task_id = ? OR target_id = ?)", linkID, c.Param("id"), c.Param("id")).Delete(&TaskLink{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not remove link"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": c.Param("linkId")})
+}
+
+// taskLinks loads the links of a task from both ends, skipping deleted tasks
+func taskLinks(db *gorm.DB, taskID uint) ([]TaskLinkView, error) {
+	var links []TaskLink
+	if err := db.Where("task_id = ? OR target_id = ?", taskID, taskID).Order("id ASC").Find(&links).Error; err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	otherIDs := make([]uint, 0, len(links))
+	for _, link := range links {
+		if link.TaskID == taskID {
+			otherIDs = append(otherIDs, link.TargetID)
+		} else {
+			otherIDs = append(otherIDs, link.TaskID)
+		}
+	}
+	var others []Task
+	if err := db.Select("id", "name", "status").Where("id IN ?", otherIDs).Find(&others).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]Task, len(others))
+	for _, other := range others {
+		byID[other.ID] = other
+	}
+
+	views := make([]TaskLinkView, 0, len(links))
+	for i, link := range links {
+		other, ok := byID[otherIDs[i]]
+		if !ok {
+			continue
+		}
+		linkType := link.Type
+		if link.TaskID != taskID {
+			linkType = inverseLinkTypes[link.Type]
+		}
+		views = append(views, TaskLinkView{ID: link.ID, Type: linkType, TaskID: other.ID, Task: other.Task, Status: other.Status})
+	}
+	return views, nil
+}
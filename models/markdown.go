@@ -0,0 +1,392 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	// markdownItemPattern matches GFM task list items: a bullet or number,
+	// a checkbox and the item text
+	markdownItemPattern    = regexp.MustCompile(`^(\s*)(?:[-*+]|\d+[.)])\s+\[([ xX])\]\s+(.*?)\s*$`)
+	markdownHeadingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)[\s#]*$`)
+)
+
+// markdownItem is a task list item read from a document
+type markdownItem struct {
+	line   int
+	indent int
+	// parent is the index of the enclosing item, or -1
+	parent      int
+	text        string
+	checked     bool
+	category    string
+	description []string
+}
+
+// ExportTasksMarkdown renders the tasks matching the listing filters as a
+// Markdown task list
+// @Summary Export tasks as Markdown
+// @Description Accepts the filters and sort options of GET /tasks; pagination is ignored. Tasks are grouped under their category as headings, subtasks are nested under their parents (including subtasks outside the filters), and priority, due date and tags follow each item as !priority, due: and #tag hints. Descriptions are indented under their item.
+// @Tags import
+// @Produce text/markdown
+// @Security BearerAuth
+// @Param title query string false "Document heading" default(Tasks)
+// @Param q query string false "Filter expression"
+// @Param sort query string false "Comma-separated sort fields, '-' prefix for descending"
+// @Success 200 {string} string "Markdown document"
+// @Failure 400 {object} map[string]interface{}
+// @Router /tasks/export.md [get]
+func ExportTasksMarkdown(c *gin.Context) {
+	var query TaskQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+	queryBuilder, err := applyTaskFilters(tasksWithUrgency(DB, time.Now()), query)
+	if err != nil {
+		respondFilterError(c, err)
+		return
+	}
+	order, err := taskSortFromQuery(DB, query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+	var tasks []Task
+	if err := queryBuilder.Preload("Tags").Order(order.orderClause(false)).Find(&tasks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve tasks", "details": err.Error()})
+		return
+	}
+	if tasks, err = appendSubtasks(DB, tasks, query.Archived); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve subtasks", "details": err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	writeTaskMarkdown(&buf, c.DefaultQuery("title", "Tasks"), tasks)
+	c.Header("Content-Disposition", `attachment; filename="tasks.md"`)
+	c.Data(http.StatusOK, "text/markdown; charset=utf-8", buf.Bytes())
+}
+
+// ImportTasksMarkdown creates tasks for the caller from the task lists of a
+// Markdown document
+// @Summary Import tasks from Markdown
+// @Description Upload a Markdown document as the `file` form field or as the request body. Every `- [ ] item` becomes a task (`[x]` a completed one, `[x] ~~item~~` a cancelled one) and nested items become subtasks. `!high`, `!medium` and `!low`, `due:2024-06-01` and `#tag` hints in an item are read, `##` headings set the category of the items below them, and indented text under an item becomes its description. Other content is ignored.
+// @Tags import
+// @Accept multipart/form-data
+// @Accept text/markdown
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file false "Markdown document"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /tasks/import.md [post]
+func ImportTasksMarkdown(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	data, err := readImportFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import", "details": err.Error()})
+		return
+	}
+	items, err := parseMarkdownItems(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Markdown", "details": err.Error()})
+		return
+	}
+
+	result := newImportResult()
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		// Items are created in document order, so parents exist before
+		// their subtasks
+		ids := make([]uint, len(items))
+		for i, item := range items {
+			// Issues are indexed by line, counting from 0 like other imports
+			index := item.line - 1
+			task, tagNames, err := markdownTask(item)
+			if err == nil && item.parent >= 0 {
+				if ids[item.parent] == 0 {
+					err = fmt.Errorf("parent item is invalid")
+				} else {
+					task.ParentID = &ids[item.parent]
+				}
+			}
+			if err != nil {
+				result.invalid(index, "", item.text, err)
+				continue
+			}
+			task.UserID = int(userID)
+			if err := createImportedTask(tx, &task, tagNames); err != nil {
+				return err
+			}
+			ids[i] = task.ID
+			result.Imported++
+			result.TaskIDs = append(result.TaskIDs, task.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not import tasks", "details": err.Error()})
+		return
+	}
+	publishCreatedTasks(DB, userID, result.TaskIDs)
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// appendSubtasks adds the descendants of the tasks that are not already
+// among them
+func appendSubtasks(db *gorm.DB, tasks []Task, archived bool) ([]Task, error) {
+	seen := make(map[uint]bool, len(tasks))
+	var frontier []uint
+	for _, task := range tasks {
+		seen[task.ID] = true
+		frontier = append(frontier, task.ID)
+	}
+	for len(frontier) > 0 {
+		query := db.Preload("Tags").Where("parent_id IN ?", frontier).Order("id ASC")
+		if !archived {
+			query = query.Where("archived_at IS NULL")
+		}
+		var children []Task
+		if err := query.Find(&children).Error; err != nil {
+			return nil, err
+		}
+		frontier = nil
+		for _, child := range children {
+			if !seen[child.ID] {
+				seen[child.ID] = true
+				tasks = append(tasks, child)
+				frontier = append(frontier, child.ID)
+			}
+		}
+	}
+	return tasks, nil
+}
+
+// writeTaskMarkdown renders tasks as a document. Tasks whose parent is
+// listed are nested under it; the others are grouped by category, with
+// uncategorised tasks first so that importing the document does not put
+// them under a heading.
+func writeTaskMarkdown(buf *bytes.Buffer, title string, tasks []Task) {
+	listed := make(map[uint]bool, len(tasks))
+	for _, task := range tasks {
+		listed[task.ID] = true
+	}
+	subtasks := make(map[uint][]Task)
+	groups := map[string][]Task{"": nil}
+	categories := []string{""}
+	for _, task := range tasks {
+		if task.ParentID != nil && listed[*task.ParentID] {
+			subtasks[*task.ParentID] = append(subtasks[*task.ParentID], task)
+			continue
+		}
+		if _, ok := groups[task.Category]; !ok {
+			categories = append(categories, task.Category)
+		}
+		groups[task.Category] = append(groups[task.Category], task)
+	}
+
+	fmt.Fprintf(buf, "# %s\n", markdownLine(title))
+	for _, category := range categories {
+		if len(groups[category]) == 0 {
+			continue
+		}
+		buf.WriteString("\n")
+		if category != "" {
+			fmt.Fprintf(buf, "## %s\n\n", markdownLine(category))
+		}
+		for _, task := range groups[category] {
+			writeMarkdownItem(buf, task, subtasks, 0)
+		}
+	}
+}
+
+func writeMarkdownItem(buf *bytes.Buffer, task Task, subtasks map[uint][]Task, depth int) {
+	indent := strings.Repeat("  ", depth)
+	checkbox := " "
+	if task.Status != StatusPending {
+		checkbox = "x"
+	}
+	name := markdownLine(task.Task)
+	if task.Status == StatusCancelled {
+		name = "~~" + name + "~~"
+	}
+	words := []string{name}
+	if task.Priority != PriorityMedium && task.Priority != "" {
+		words = append(words, "!"+string(task.Priority))
+	}
+	if task.DueDate != nil {
+		if hasDueTime(task) {
+			words = append(words, "due:"+task.DueDate.UTC().Format(time.RFC3339))
+		} else {
+			words = append(words, "due:"+task.DueDate.UTC().Format("2006-01-02"))
+		}
+	}
+	for _, tag := range task.Tags {
+		words = append(words, "#"+strings.Join(strings.Fields(tag.Name), "-"))
+	}
+	fmt.Fprintf(buf, "%s- [%s] %s\n", indent, checkbox, strings.Join(words, " "))
+	for _, line := range strings.Split(task.Description, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			fmt.Fprintf(buf, "%s  %s\n", indent, line)
+		}
+	}
+	for _, subtask := range subtasks[task.ID] {
+		writeMarkdownItem(buf, subtask, subtasks, depth+1)
+	}
+}
+
+// markdownLine keeps text on a single line
+func markdownLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// parseMarkdownItems reads the task list items of a document with their
+// nesting, the category of the heading above them and the indented text
+// under them
+func parseMarkdownItems(data []byte) ([]markdownItem, error) {
+	var items []markdownItem
+	var open []int // indices of the items enclosing the current line
+	last, category := -1, ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if number == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if match := markdownHeadingPattern.FindStringSubmatch(line); match != nil {
+			// Headings end lists; below the title they name the category
+			open, last = nil, -1
+			if len(match[1]) > 1 {
+				category = match[2]
+			}
+			continue
+		}
+		match := markdownItemPattern.FindStringSubmatch(line)
+		if match == nil {
+			if last >= 0 && markdownIndent(line) > items[last].indent {
+				items[last].description = append(items[last].description, strings.TrimSpace(line))
+			} else {
+				last = -1
+			}
+			continue
+		}
+
+		item := markdownItem{
+			line:     number,
+			indent:   markdownIndent(match[1]),
+			parent:   -1,
+			text:     match[3],
+			checked:  match[2] != " ",
+			category: category,
+		}
+		for len(open) > 0 && items[open[len(open)-1]].indent >= item.indent {
+			open = open[:len(open)-1]
+		}
+		if len(open) > 0 {
+			item.parent = open[len(open)-1]
+		}
+		items = append(items, item)
+		last = len(items) - 1
+		open = append(open, last)
+	}
+	if err := scanner.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			err = fmt.Errorf("a line is longer than 1 MB")
+		}
+		return nil, err
+	}
+	return items, nil
+}
+
+// markdownIndent measures leading whitespace, counting tabs as four columns
+func markdownIndent(line string) int {
+	width := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			width++
+		case '\t':
+			width += 4
+		default:
+			return width
+		}
+	}
+	return width
+}
+
+// markdownTask reads an item into a task and the names of its tags,
+// removing the hints from its name
+func markdownTask(item markdownItem) (Task, []string, error) {
+	task := Task{Priority: PriorityMedium, Category: item.category, Description: strings.Join(item.description, "\n")}
+	var name, tagNames []string
+	for _, word := range strings.Fields(item.text) {
+		lower := strings.ToLower(word)
+		switch {
+		case strings.HasPrefix(lower, "!") && TaskPriority(lower[1:]).Valid():
+			task.Priority = TaskPriority(lower[1:])
+		case strings.HasPrefix(lower, "due:"):
+			due, err := parseMarkdownDue(word[len("due:"):])
+			if err != nil {
+				return task, nil, err
+			}
+			task.DueDate = &due
+		case len(word) > 1 && word[0] == '#' && unicode.IsLetter([]rune(word[1:])[0]):
+			tagNames = append(tagNames, word[1:])
+		default:
+			name = append(name, word)
+		}
+	}
+
+	status := StatusPending
+	task.Task = strings.Join(name, " ")
+	if item.checked {
+		status = StatusCompleted
+		if len(task.Task) > 4 && strings.HasPrefix(task.Task, "~~") && strings.HasSuffix(task.Task, "~~") {
+			task.Task = strings.TrimSpace(task.Task[2 : len(task.Task)-2])
+			status = StatusCancelled
+		}
+	}
+	if task.Task == "" {
+		return task, nil, fmt.Errorf("item has no name besides its hints")
+	}
+	if utf8.RuneCountInString(task.Task) > 255 {
+		return task, nil, fmt.Errorf("item is longer than 255 characters")
+	}
+	if utf8.RuneCountInString(task.Category) > 100 {
+		return task, nil, fmt.Errorf("heading %q is longer than 100 characters", task.Category)
+	}
+	task.setStatus(status, time.Now())
+	return task, tagNames, nil
+}
+
+// parseMarkdownDue reads a due: hint, a date or an RFC 3339 time
+func parseMarkdownDue(value string) (time.Time, error) {
+	if due, err := time.Parse("2006-01-02", value); err == nil {
+		return due, nil
+	}
+	due, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return due, fmt.Errorf("invalid due date %q, expected YYYY-MM-DD", value)
+	}
+	return due.UTC(), nil
+}
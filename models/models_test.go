@@ -1,8 +1,17 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/KingLeak95/todo-list-go/pkg/todotxt"
+	"github.com/gin-gonic/gin"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -17,7 +26,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	if err := db.Exec("PRAGMA foreign_keys = ON").Error; err != nil {
 		t.Fatalf("failed to enable foreign keys: %v", err)
 	}
-	if err := db.AutoMigrate(&User{}, &Task{}); err != nil {
+	if err := Migrate(db); err != nil {
 		t.Fatalf("auto migrate failed: %v", err)
 	}
 	return db
@@ -87,3 +96,215 @@ func TestCascadeDeleteUserDeletesTasks(t *testing.T) {
 		t.Fatalf("expected 0 tasks after cascade delete, got %d", count)
 	}
 }
+
+func TestTaskStatusHistory(t *testing.T) {
+	db := setupTestDB(t)
+
+	u := User{Name: "Dana", Email: "dana@example.com"}
+	if err := db.Create(&u).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	task := Task{Task: "Track me", UserID: int(u.ID), Status: StatusPending}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("failed to create task: %v", err)
+	}
+	task.setStatus(StatusCompleted, time.Now())
+	if err := db.Save(&task).Error; err != nil {
+		t.Fatalf("failed to complete task: %v", err)
+	}
+	task.Task = "Renamed"
+	if err := db.Save(&task).Error; err != nil {
+		t.Fatalf("failed to rename task: %v", err)
+	}
+
+	var history []TaskStatusChange
+	db.Where("task_id = ?", task.ID).Order("id ASC").Find(&history)
+	if len(history) != 2 || history[0].From != "" || history[1].From != StatusPending || history[1].To != StatusCompleted {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	if task.CompletedAt == nil || !task.Completed {
+		t.Fatalf("expected completion to be recorded, got %+v", task)
+	}
+
+	// Tasks from before the history existed get an approximate one
+	db.Where("1 = 1").Delete(&TaskStatusChange{})
+	if err := backfillStatusHistory(db); err != nil {
+		t.Fatalf("backfill failed: %v", err)
+	}
+	if err := backfillStatusHistory(db); err != nil {
+		t.Fatalf("second backfill failed: %v", err)
+	}
+	history = nil
+	db.Where("task_id = ?", task.ID).Order("changed_at ASC").Find(&history)
+	if len(history) != 2 || history[0].To != StatusPending || history[1].To != StatusCompleted {
+		t.Fatalf("unexpected backfilled history: %+v", history)
+	}
+}
+
+func TestSnoozePresets(t *testing.T) {
+	// A Wednesday afternoon
+	now := time.Date(2024, 6, 5, 15, 30, 0, 0, time.UTC)
+	expected := map[string]time.Time{
+		"laterToday": time.Date(2024, 6, 5, 18, 30, 0, 0, time.UTC),
+		"tomorrow":   time.Date(2024, 6, 6, 9, 0, 0, 0, time.UTC),
+		"nextWeek":   time.Date(2024, 6, 10, 9, 0, 0, 0, time.UTC),
+	}
+	for preset, want := range expected {
+		got, err := snoozePreset(preset, now)
+		if err != nil || !got.Equal(want) {
+			t.Fatalf("%s: expected %v, got %v (%v)", preset, want, got, err)
+		}
+	}
+	monday := time.Date(2024, 6, 10, 8, 0, 0, 0, time.UTC)
+	if got, _ := snoozePreset("nextWeek", monday); !got.Equal(time.Date(2024, 6, 17, 9, 0, 0, 0, time.UTC)) {
+		t.Fatalf("nextWeek from a Monday should skip a week, got %v", got)
+	}
+}
+
+func TestMentions(t *testing.T) {
+	text := "@Alice can you check with @bob.smith@example.com? Mail ops@example.com, not @carol."
+	got := fmt.Sprint(mentions(text))
+	if got != "[alice bob.smith@example.com carol]" {
+		t.Fatalf("unexpected mentions: %s", got)
+	}
+}
+
+func TestAccountExportJobs(t *testing.T) {
+	db := setupTestDB(t)
+	u := User{Name: "Exporter", Email: "exporter@example.com"}
+	if err := db.Create(&u).Error; err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	// A panic while building the archive fails the export
+	db.Callback().Query().Before("gorm:query").Register("test:panic", func(tx *gorm.DB) {
+		if tx.Statement.Table == "users" {
+			panic("boom")
+		}
+	})
+	export := AccountExport{UserID: u.ID, Status: ExportPending}
+	db.Create(&export)
+	runAccountExport(db, export)
+	db.Callback().Query().Remove("test:panic")
+	db.First(&export, export.ID)
+	if export.Status != ExportFailed || !strings.Contains(export.Error, "boom") {
+		t.Fatalf("expected a failed export, got %+v", export)
+	}
+
+	// While an export is pending, requesting another returns it
+	saved := DB
+	DB = db
+	defer func() { DB = saved }()
+	for i := 0; i < cap(accountExportSlots); i++ {
+		accountExportSlots <- struct{}{}
+	}
+	request := func() AccountExport {
+		t.Helper()
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/account/export", nil)
+		c.Set("user_id", u.ID)
+		RequestAccountExport(c)
+		var resp struct {
+			Data AccountExport `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusAccepted {
+			t.Fatalf("export expected 202, got %d, body=%s", w.Code, w.Body.String())
+		}
+		return resp.Data
+	}
+	first, second := request(), request()
+	if first.ID == export.ID || second.ID != first.ID {
+		t.Fatalf("expected the pending export %d to be reused, got %d", first.ID, second.ID)
+	}
+	var count int64
+	db.Model(&AccountExport{}).Where("user_id = ?", u.ID).Count(&count)
+	for i := 0; i < cap(accountExportSlots); i++ {
+		<-accountExportSlots
+	}
+	if count != 1 {
+		t.Fatalf("expected one export, got %d", count)
+	}
+}
+
+func TestTodoTxtRoundTripKeepsName(t *testing.T) {
+	due := time.Date(2024, 6, 5, 0, 0, 0, 0, time.UTC)
+	task := Task{
+		Task:     `Email @bob about +launch due:soon or t:x in C:\temp`,
+		Priority: PriorityHigh,
+		Status:   StatusPending,
+		Category: "Ops",
+		DueDate:  &due,
+		Tags:     []Tag{{Name: "work"}},
+	}
+	task.CreatedAt = due
+
+	line, err := todotxt.Parse(taskTodoTxt(task).String())
+	if err != nil {
+		t.Fatalf("failed to parse exported line: %v", err)
+	}
+	imported, tagNames, err := todoTxtTask(line)
+	if err != nil {
+		t.Fatalf("failed to import exported line %q: %v", line.Text, err)
+	}
+	if imported.Task != task.Task || imported.Category != "Ops" || imported.Priority != PriorityHigh ||
+		imported.DueDate == nil || !imported.DueDate.Equal(due) || len(tagNames) != 1 || tagNames[0] != "work" {
+		t.Fatalf("round trip changed the task: %+v %v from %q", imported, tagNames, line.Text)
+	}
+}
+
+func TestTaskFiltersUseSession(t *testing.T) {
+	db := setupTestDB(t)
+	u := User{Name: "Filterer", Email: "filterer@example.com"}
+	db.Create(&u)
+
+	// The definition only exists inside the transaction, so looking it up
+	// anywhere else fails
+	err := db.Transaction(func(tx *gorm.DB) error {
+		project := Project{Name: "Estimates", OwnerID: u.ID}
+		tx.Create(&project)
+		tx.Create(&CustomFieldDefinition{ProjectID: &project.ID, Key: "points", Name: "Points", Type: FieldNumber})
+		for _, points := range []float64{2, 5} {
+			values, err := resolveCustomFields(tx, &project.ID, nil, map[string]interface{}{"points": points})
+			if err != nil {
+				return err
+			}
+			tx.Create(&Task{Task: fmt.Sprintf("%g points", points), UserID: int(u.ID), ProjectID: &project.ID, CustomFields: values})
+		}
+
+		filtered, err := applyTaskFilters(tx.Model(&Task{}), TaskQuery{Filter: "cf.points>3"})
+		if err != nil {
+			return err
+		}
+		var tasks []Task
+		if err := filtered.Find(&tasks).Error; err != nil {
+			return err
+		}
+		if len(tasks) != 1 || tasks[0].Task != "5 points" {
+			t.Fatalf("unexpected filtered tasks: %+v", tasks)
+		}
+		order, err := taskSortFromQuery(tx, TaskQuery{Sort: "-cf.points"})
+		if err != nil {
+			return err
+		}
+		if err := tx.Order(order.orderClause(false)).Find(&tasks).Error; err != nil {
+			return err
+		}
+		if len(tasks) != 2 || tasks[0].Task != "5 points" {
+			t.Fatalf("unexpected sorted tasks: %+v", tasks)
+		}
+		return errors.New("rollback")
+	})
+	if err == nil || err.Error() != "rollback" {
+		t.Fatalf("filtering in a transaction failed: %v", err)
+	}
+}
+
+func TestUrgencyWeightsFromEnv(t *testing.T) {
+	for value, want := range map[string]float64{"2.5": 2.5, "NaN": 1, "Inf": 1, "-inf": 1, "heavy": 1} {
+		t.Setenv("URGENCY_WEIGHT_TEST", value)
+		if got := getEnvFloat("URGENCY_WEIGHT_TEST", 1); got != want {
+			t.Fatalf("%q: expected %g, got %g", value, want, got)
+		}
+	}
+}
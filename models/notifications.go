@@ -0,0 +1,379 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type NotificationType string
+
+const (
+	NotificationAssigned      NotificationType = "assigned"
+	NotificationStatusChanged NotificationType = "statusChanged"
+	NotificationMentioned     NotificationType = "mentioned"
+	NotificationDueSoon       NotificationType = "dueSoon"
+)
+
+// Notification is an entry in a user's in-app inbox
+type Notification struct {
+	ID        uint             `gorm:"primarykey" json:"id"`
+	UserID    uint             `gorm:"index:idx_notification_user" json:"userId"`
+	TaskID    *uint            `gorm:"index" json:"taskId,omitempty"`
+	ActorID   *uint            `json:"actorId,omitempty"`
+	Type      NotificationType `gorm:"type:varchar(20)" json:"type"`
+	Message   string           `gorm:"type:text" json:"message"`
+	ReadAt    *time.Time       `gorm:"index:idx_notification_user" json:"readAt,omitempty"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+type NotificationQuery struct {
+	Unread bool `form:"unread"`
+	Page   int  `form:"page,default=1"`
+	Limit  int  `form:"limit,default=20"`
+}
+
+// mentionPattern matches @email and @handle mentions not preceded by a word
+// character, so email addresses in text are not taken as mentions
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.%+-]+@[\w-]+(?:\.[\w-]+)*\.[A-Za-z]{2,}|\w+)`)
+
+// GetNotifications lists the caller's notifications, newest first
+// @Summary List notifications
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Param unread query bool false "Only unread notifications"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /notifications [get]
+func GetNotifications(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	var query NotificationQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.Limit <= 0 || query.Limit > 100 {
+		query.Limit = 20
+	}
+
+	scope := DB.Model(&Notification{}).Where("user_id = ?", userID)
+	unread, err := unreadNotifications(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not count notifications"})
+		return
+	}
+	if query.Unread {
+		scope = scope.Where("read_at IS NULL")
+	}
+	var total int64
+	if err := scope.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not count notifications"})
+		return
+	}
+	var notifications []Notification
+	err = scope.Order("created_at DESC, id DESC").Offset((query.Page - 1) * query.Limit).Limit(query.Limit).Find(&notifications).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        notifications,
+		"unreadCount": unread,
+		"pagination": gin.H{
+			"page":       query.Page,
+			"limit":      query.Limit,
+			"total":      total,
+			"totalPages": (total + int64(query.Limit) - 1) / int64(query.Limit),
+		},
+	})
+}
+
+// GetUnreadNotificationCount returns the number of unread notifications
+// @Summary Count unread notifications
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /notifications/unread-count [get]
+func GetUnreadNotificationCount(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	unread, err := unreadNotifications(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not count notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"unreadCount": unread}})
+}
+
+// MarkNotificationRead marks one of the caller's notifications as read
+// @Summary Mark a notification as read
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Notification ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /notifications/{id}/read [post]
+func MarkNotificationRead(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	var notification Notification
+	if err := DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&notification).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve notification"})
+		}
+		return
+	}
+	if notification.ReadAt == nil {
+		now := time.Now()
+		notification.ReadAt = &now
+		if err := DB.Save(&notification).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update notification"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": notification})
+}
+
+// MarkAllNotificationsRead marks all of the caller's notifications as read
+// @Summary Mark all notifications as read
+// @Tags notifications
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /notifications/read-all [post]
+func MarkAllNotificationsRead(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	result := DB.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Update("read_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"marked": result.RowsAffected}})
+}
+
+func unreadNotifications(db *gorm.DB, userID uint) (int64, error) {
+	var unread int64
+	err := db.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unread).Error
+	return unread, err
+}
+
+// notify writes a notification for each recipient other than the actor
+func notify(db *gorm.DB, recipients []uint, actorID uint, task Task, kind NotificationType, message string) error {
+	var notifications []Notification
+	seen := make(map[uint]bool)
+	for _, userID := range recipients {
+		if userID == 0 || userID == actorID || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		n := Notification{UserID: userID, TaskID: &task.ID, Type: kind, Message: message}
+		if actorID != 0 {
+			n.ActorID = &actorID
+		}
+		notifications = append(notifications, n)
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+	return db.Create(&notifications).Error
+}
+
+// notifyTaskChanges watches and notifies for a task saved by actorID (0 when
+// anonymous), and publishes the change to event streams. before is the zero
+// Task for a new task. Failures are logged rather than failing the request
+// that made the change.
+func notifyTaskChanges(db *gorm.DB, actorID uint, before, after Task) {
+	publishTaskEvent(actorID, before, after)
+	if err := taskChangeNotifications(db, actorID, before, after); err != nil {
+		log.Printf("notifying changes to task %d: %v", after.ID, err)
+	}
+}
+
+func taskChangeNotifications(db *gorm.DB, actorID uint, before, after Task) error {
+	actor := actorName(db, actorID)
+	if before.ID == 0 && actorID != 0 {
+		if err := watchTask(db, after.ID, actorID); err != nil {
+			return err
+		}
+	}
+	if assignee := uint(after.UserID); assignee != 0 && after.UserID != before.UserID {
+		if err := watchTask(db, after.ID, assignee); err != nil {
+			return err
+		}
+		message := fmt.Sprintf("%s assigned you %q", actor, after.Task)
+		if err := notify(db, []uint{assignee}, actorID, after, NotificationAssigned, message); err != nil {
+			return err
+		}
+	}
+	if before.ID != 0 && after.Status != before.Status {
+		watchers, err := taskWatchers(db, after.ID)
+		if err != nil {
+			return err
+		}
+		message := fmt.Sprintf("%s changed %q to %s", actor, after.Task, after.Status)
+		if err := notify(db, watchers, actorID, after, NotificationStatusChanged, message); err != nil {
+			return err
+		}
+	}
+
+	mentioned, err := mentionedUsers(db, after.Description, before.Description)
+	if err != nil {
+		return err
+	}
+	return notify(db, mentioned, actorID, after, NotificationMentioned, fmt.Sprintf("%s mentioned you on %q", actor, after.Task))
+}
+
+// notifyMentions notifies the users mentioned in a comment
+func notifyMentions(db *gorm.DB, actorID uint, task Task, text string) {
+	mentioned, err := mentionedUsers(db, text, "")
+	if err == nil {
+		message := fmt.Sprintf("%s mentioned you in a comment on %q", actorName(db, actorID), task.Task)
+		err = notify(db, mentioned, actorID, task, NotificationMentioned, message)
+	}
+	if err != nil {
+		log.Printf("notifying mentions on task %d: %v", task.ID, err)
+	}
+}
+
+// actorName names the user behind a change in notification messages
+func actorName(db *gorm.DB, actorID uint) string {
+	var user User
+	if actorID == 0 || db.Select("name").First(&user, actorID).Error != nil {
+		return "Someone"
+	}
+	return user.Name
+}
+
+// mentions extracts the lower-cased emails and handles mentioned in text
+func mentions(text string) []string {
+	var names []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		names = append(names, strings.ToLower(match[1]))
+	}
+	return names
+}
+
+// mentionedUsers resolves the mentions in text that are not already in
+// previous to user IDs
+func mentionedUsers(db *gorm.DB, text, previous string) ([]uint, error) {
+	known := make(map[string]bool)
+	for _, name := range mentions(previous) {
+		known[name] = true
+	}
+	var emails, handles []string
+	for _, name := range mentions(text) {
+		if known[name] {
+			continue
+		}
+		known[name] = true
+		if strings.Contains(name, "@") {
+			emails = append(emails, name)
+		} else {
+			handles = append(handles, name)
+		}
+	}
+	if len(emails) == 0 && len(handles) == 0 {
+		return nil, nil
+	}
+
+	var userIDs []uint
+	err := db.Model(&User{}).Where("LOWER(email) IN ? OR handle IN ?", emails, handles).
+		Order("id ASC").Pluck("id", &userIDs).Error
+	return userIDs, err
+}
+
+// NotifyDueSoon notifies the watchers of pending tasks falling due within
+// the next DUE_SOON_HOURS (default 24), once per task and watcher in that
+// window, and returns how many notifications were written
+func NotifyDueSoon(db *gorm.DB, now time.Time) (int64, error) {
+	window := time.Duration(getEnvInt("DUE_SOON_HOURS", 24)) * time.Hour
+	var tasks []Task
+	err := db.Where("status = ? AND archived_at IS NULL AND due_date > ? AND due_date <= ?", StatusPending, now, now.Add(window)).
+		Find(&tasks).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, task := range tasks {
+		watchers, err := taskWatchers(db, task.ID)
+		if err != nil {
+			return total, err
+		}
+		var notified []uint
+		err = db.Model(&Notification{}).Where("task_id = ? AND type = ? AND created_at > ?", task.ID, NotificationDueSoon, now.Add(-window)).
+			Pluck("user_id", &notified).Error
+		if err != nil {
+			return total, err
+		}
+		skip := make(map[uint]bool, len(notified))
+		for _, userID := range notified {
+			skip[userID] = true
+		}
+		var recipients []uint
+		for _, userID := range watchers {
+			if !skip[userID] {
+				recipients = append(recipients, userID)
+			}
+		}
+		message := fmt.Sprintf("%q is due %s", task.Task, task.DueDate.UTC().Format("2006-01-02 15:04 UTC"))
+		if err := notify(db, recipients, 0, task, NotificationDueSoon, message); err != nil {
+			return total, err
+		}
+		total += int64(len(recipients))
+	}
+	return total, nil
+}
+
+// StartNotifier runs NotifyDueSoon in the background, immediately and then
+// every NOTIFY_INTERVAL_MINUTES (default 15)
+func StartNotifier(db *gorm.DB) {
+	interval := time.Duration(getEnvInt("NOTIFY_INTERVAL_MINUTES", 15)) * time.Minute
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := NotifyDueSoon(db, time.Now()); err != nil {
+				log.Printf("notifying due tasks: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// sortKeyKind describes how a sort key's cursor value is encoded
+type sortKeyKind int
+
+const (
+	sortKeyString sortKeyKind = iota
+	sortKeyTime
+	sortKeyNumber
+)
+
+// taskSortKey describes a column tasks can be ordered and paged by
+type taskSortKey struct {
+	// expr is trusted SQL selecting the sort value
+	expr     string
+	kind     sortKeyKind
+	nullable bool
+	// value extracts the sort value from a loaded task
+	value func(t *Task) interface{}
+}
+
+// sortTerm is one key of an ORDER BY with its direction
+type sortTerm struct {
+	name string
+	key  taskSortKey
+	desc bool
+}
+
+// taskSort is an ordering of tasks; ties are always broken by id so that
+// every row has a unique position for keyset pagination
+type taskSort []sortTerm
+
+// signature identifies the ordering a cursor was issued for
+func (s taskSort) signature() string {
+	parts := make([]string, len(s))
+	for i, term := range s {
+		if term.desc {
+			parts[i] = "-" + term.name
+		} else {
+			parts[i] = term.name
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// terms returns the sort terms with the id tiebreaker appended
+func (s taskSort) terms() []sortTerm {
+	terms := append([]sortTerm{}, s...)
+	for _, term := range s {
+		if term.name == "id" {
+			return terms
+		}
+	}
+	desc := false
+	if len(s) > 0 {
+		desc = s[len(s)-1].desc
+	}
+	return append(terms, sortTerm{name: "id", key: taskSortKeys["id"], desc: desc})
+}
+
+// orderClause renders the ORDER BY; nulls always sort last in the forward
+// direction. backward reverses the whole ordering for `before` cursors.
+func (s taskSort) orderClause(backward bool) string {
+	var parts []string
+	for _, term := range s.terms() {
+		desc := term.desc != backward
+		if term.key.nullable {
+			if backward {
+				parts = append(parts, "("+term.key.expr+" IS NULL) DESC")
+			} else {
+				parts = append(parts, "("+term.key.expr+" IS NULL) ASC")
+			}
+		}
+		if desc {
+			parts = append(parts, term.key.expr+" DESC")
+		} else {
+			parts = append(parts, term.key.expr+" ASC")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// taskCursor is the decoded form of an opaque pagination token
+type taskCursor struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor builds the token positioned at the given task
+func (s taskSort) encodeCursor(task *Task) string {
+	cursor := taskCursor{Sort: s.signature()}
+	for _, term := range s.terms() {
+		raw, _ := json.Marshal(term.key.value(task))
+		cursor.Values = append(cursor.Values, raw)
+	}
+	payload, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+// decodeCursor parses a token, checking it was issued for this ordering
+func (s taskSort) decodeCursor(token string) ([]interface{}, error) {
+	payload, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var cursor taskCursor
+	if err := json.Unmarshal(payload, &cursor); err != nil {
+		return nil, errInvalidCursor
+	}
+	terms := s.terms()
+	if cursor.Sort != s.signature() || len(cursor.Values) != len(terms) {
+		return nil, fmt.Errorf("%w: cursor was issued for a different sort order", errInvalidCursor)
+	}
+
+	values := make([]interface{}, len(terms))
+	for i, term := range terms {
+		raw := cursor.Values[i]
+		if string(raw) == "null" {
+			if !term.key.nullable {
+				return nil, errInvalidCursor
+			}
+			continue
+		}
+		var err error
+		switch term.key.kind {
+		case sortKeyTime:
+			var t time.Time
+			err = json.Unmarshal(raw, &t)
+			values[i] = t
+		case sortKeyNumber:
+			var n json.Number
+			if err = json.Unmarshal(raw, &n); err == nil {
+				if integer, intErr := n.Int64(); intErr == nil {
+					values[i] = integer
+				} else {
+					values[i], err = n.Float64()
+				}
+			}
+		default:
+			var str string
+			err = json.Unmarshal(raw, &str)
+			values[i] = str
+		}
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+	}
+	return values, nil
+}
+
+// keysetCondition returns a WHERE condition selecting the rows strictly
+// after (or, when backward, strictly before) the cursor position
+func (s taskSort) keysetCondition(values []interface{}, backward bool) (string, []interface{}) {
+	var alternatives []string
+	var args []interface{}
+	var equalities []string
+	var equalityArgs []interface{}
+
+	for i, term := range s.terms() {
+		expr := term.key.expr
+		value := values[i]
+		cmp := ">"
+		if term.desc != backward {
+			cmp = "<"
+		}
+
+		// Strictly beyond the cursor on this key
+		var beyond string
+		var beyondArgs []interface{}
+		switch {
+		case value == nil && !backward:
+			// Nulls sort last, so nothing follows a null on this key
+			beyond = ""
+		case value == nil && backward:
+			beyond = expr + " IS NOT NULL"
+		case term.key.nullable && !backward:
+			beyond = "(" + expr + " " + cmp + " ? OR " + expr + " IS NULL)"
+			beyondArgs = []interface{}{value}
+		default:
+			beyond = expr + " " + cmp + " ?"
+			beyondArgs = []interface{}{value}
+		}
+
+		if beyond != "" {
+			conditions := append(append([]string{}, equalities...), beyond)
+			alternatives = append(alternatives, "("+strings.Join(conditions, " AND ")+")")
+			args = append(args, equalityArgs...)
+			args = append(args, beyondArgs...)
+		}
+
+		if value == nil {
+			equalities = append(equalities, expr+" IS NULL")
+		} else {
+			equalities = append(equalities, expr+" = ?")
+			equalityArgs = append(equalityArgs, value)
+		}
+	}
+
+	if len(alternatives) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Project groups tasks and defines the custom fields they carry
+type Project struct {
+	gorm.Model
+	Name        string                  `gorm:"type:varchar(255);not null" json:"name"`
+	Description string                  `gorm:"type:text" json:"description"`
+	OwnerID     uint                    `gorm:"index" json:"ownerId"`
+	Fields      []CustomFieldDefinition `gorm:"foreignKey:ProjectID" json:"fields,omitempty"`
+}
+
+type NewProject struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// CreateProject creates a project owned by the caller
+// @Summary Create a project
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param project body NewProject true "Project data"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /projects [post]
+func CreateProject(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var input NewProject
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+		return
+	}
+
+	project := Project{Name: input.Name, Description: input.Description, OwnerID: userID}
+	if err := DB.Create(&project).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create project", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": project})
+}
+
+// GetProjects lists all projects
+// @Summary List projects
+// @Tags projects
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Router /projects [get]
+func GetProjects(c *gin.Context) {
+	var projects []Project
+	if err := DB.Order("name ASC").Find(&projects).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve projects"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": projects})
+}
+
+// GetProjectByID retrieves a project with its custom field definitions
+// @Summary Get a project
+// @Tags projects
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /projects/{id} [get]
+func GetProjectByID(c *gin.Context) {
+	project, ok := findProject(c, DB.Preload("Fields", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") }))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": project})
+}
+
+// findProject loads the project in the path, writing the error response if
+// it does not exist
+func findProject(c *gin.Context, db *gorm.DB) (Project, bool) {
+	var project Project
+	if err := db.Where("id = ?", c.Param("id")).First(&project).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve project"})
+		}
+		return project, false
+	}
+	return project, true
+}
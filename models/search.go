@@ -0,0 +1,444 @@
+package models
+
+import (
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/KingLeak95/todo-list-go/pkg/filter"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// searchBackend identifies how full-text queries are executed
+type searchBackend int
+
+const (
+	// searchLike is the portable fallback using LIKE and in-process ranking
+	searchLike searchBackend = iota
+	// searchPostgres uses tsvector columns with GIN indexes and ts_rank
+	searchPostgres
+	// searchFTS5 uses SQLite FTS5 virtual tables and bm25
+	searchFTS5
+)
+
+// Matches are delimited with private-use runes while snippets are built,
+// and turned into <mark> tags once the text around them is HTML-escaped
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+)
+
+var snippetMarkup = strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>")
+
+// snippetHTML escapes a snippet built with highlight markers and marks its
+// matches up with <mark> tags
+func snippetHTML(snippet string) string {
+	return snippetMarkup.Replace(html.EscapeString(snippet))
+}
+
+// SearchHit is a single ranked search result
+type SearchHit struct {
+	Type      string  `json:"type"`
+	TaskID    uint    `json:"taskId"`
+	CommentID *uint   `json:"commentId,omitempty"`
+	Title     string  `json:"title"`
+	Snippet   string  `json:"snippet"`
+	Rank      float64 `json:"rank" gorm:"column:score"`
+}
+
+type SearchQuery struct {
+	Query string `form:"q" binding:"required"`
+	Limit int    `form:"limit,default=20"`
+}
+
+// setupSearch creates the full-text search structures for the database in use.
+// SQLite builds without the FTS5 module silently fall back to LIKE matching.
+func setupSearch(db *gorm.DB) error {
+	var statements []string
+	switch db.Dialector.Name() {
+	case "postgres":
+		statements = []string{
+			`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+				setweight(to_tsvector('english', coalesce(description, '')), 'B')) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_tasks_search_vector ON tasks USING GIN (search_vector)`,
+			`ALTER TABLE comments ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+				to_tsvector('english', coalesce(body, ''))) STORED`,
+			`CREATE INDEX IF NOT EXISTS idx_comments_search_vector ON comments USING GIN (search_vector)`,
+		}
+	case "sqlite":
+		var fts5 int
+		if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5).Error; err != nil {
+			return err
+		}
+		if fts5 == 0 {
+			return nil
+		}
+		statements = []string{
+			`CREATE VIRTUAL TABLE IF NOT EXISTS tasks_fts USING fts5(name, description, content='tasks', content_rowid='id')`,
+			`CREATE TRIGGER IF NOT EXISTS tasks_fts_ai AFTER INSERT ON tasks BEGIN
+				INSERT INTO tasks_fts(rowid, name, description) VALUES (new.id, new.name, new.description);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS tasks_fts_ad AFTER DELETE ON tasks BEGIN
+				INSERT INTO tasks_fts(tasks_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS tasks_fts_au AFTER UPDATE ON tasks BEGIN
+				INSERT INTO tasks_fts(tasks_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+				INSERT INTO tasks_fts(rowid, name, description) VALUES (new.id, new.name, new.description);
+			END`,
+			`CREATE VIRTUAL TABLE IF NOT EXISTS comments_fts USING fts5(body, content='comments', content_rowid='id')`,
+			`CREATE TRIGGER IF NOT EXISTS comments_fts_ai AFTER INSERT ON comments BEGIN
+				INSERT INTO comments_fts(rowid, body) VALUES (new.id, new.body);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS comments_fts_ad AFTER DELETE ON comments BEGIN
+				INSERT INTO comments_fts(comments_fts, rowid, body) VALUES ('delete', old.id, old.body);
+			END`,
+			`CREATE TRIGGER IF NOT EXISTS comments_fts_au AFTER UPDATE ON comments BEGIN
+				INSERT INTO comments_fts(comments_fts, rowid, body) VALUES ('delete', old.id, old.body);
+				INSERT INTO comments_fts(rowid, body) VALUES (new.id, new.body);
+			END`,
+			// Migrations may rebuild the content tables, so resync the indexes
+			`INSERT INTO tasks_fts(tasks_fts) VALUES ('rebuild')`,
+			`INSERT INTO comments_fts(comments_fts) VALUES ('rebuild')`,
+		}
+	}
+
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// searchBackendFor reports which search implementation the database supports
+func searchBackendFor(db *gorm.DB) searchBackend {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return searchPostgres
+	case "sqlite":
+		if db.Session(&gorm.Session{NewDB: true}).Migrator().HasTable("tasks_fts") {
+			return searchFTS5
+		}
+	}
+	return searchLike
+}
+
+// searchTerms splits user input into lower-cased words
+func searchTerms(input string) []string {
+	return strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// fts5Query turns free text into a safe FTS5 MATCH expression where every
+// word must match as a prefix
+func fts5Query(input string) string {
+	terms := searchTerms(input)
+	for i, term := range terms {
+		terms[i] = `"` + term + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+// taskSearchCondition returns a self-contained WHERE condition matching
+// tasks whose name or description match the search text
+func taskSearchCondition(db *gorm.DB, input string) (string, []interface{}) {
+	switch searchBackendFor(db) {
+	case searchPostgres:
+		return "(tasks.search_vector @@ websearch_to_tsquery('english', ?))", []interface{}{input}
+	case searchFTS5:
+		query := fts5Query(input)
+		if query == "" {
+			return "(1 = 0)", nil
+		}
+		return "(tasks.id IN (SELECT rowid FROM tasks_fts WHERE tasks_fts MATCH ?))", []interface{}{query}
+	}
+	pattern := "%" + filter.EscapeLike(strings.ToLower(input)) + "%"
+	return `(LOWER(tasks.name) LIKE ? ESCAPE '\' OR LOWER(tasks.description) LIKE ? ESCAPE '\')`, []interface{}{pattern, pattern}
+}
+
+// Search performs ranked full-text search over tasks and comments
+// @Summary Full-text search
+// @Description Search task names, descriptions and comments. Results are ranked by relevance and include snippets as escaped HTML with the matches in <mark> tags.
+// @Tags search
+// @Produce json
+// @Security BearerAuth
+// @Param q query string true "Search text"
+// @Param limit query int false "Maximum number of results" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /search [get]
+func Search(c *gin.Context) {
+	var query SearchQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+	if query.Limit <= 0 {
+		query.Limit = 20
+	}
+	if query.Limit > 100 {
+		query.Limit = 100
+	}
+
+	var hits []SearchHit
+	var err error
+	switch searchBackendFor(DB) {
+	case searchPostgres:
+		hits, err = searchPostgresHits(DB, query.Query, query.Limit)
+	case searchFTS5:
+		hits, err = searchFTS5Hits(DB, query.Query, query.Limit)
+	default:
+		hits, err = searchLikeHits(DB, query.Query, query.Limit)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not search", "details": err.Error()})
+		return
+	}
+	for i := range hits {
+		hits[i].Snippet = snippetHTML(hits[i].Snippet)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Rank > hits[j].Rank })
+	if len(hits) > query.Limit {
+		hits = hits[:query.Limit]
+	}
+	if hits == nil {
+		hits = []SearchHit{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": hits})
+}
+
+func searchPostgresHits(db *gorm.DB, input string, limit int) ([]SearchHit, error) {
+	const headline = "'StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MinWords=5, MaxWords=20, MaxFragments=2'"
+
+	var taskHits []SearchHit
+	err := db.Raw(`
+		SELECT 'task' AS type, tasks.id AS task_id, tasks.name AS title,
+			ts_rank(tasks.search_vector, query) AS score,
+			ts_headline('english', coalesce(tasks.name, '') || ' - ' || coalesce(tasks.description, ''), query, `+headline+`) AS snippet
+		FROM tasks CROSS JOIN websearch_to_tsquery('english', ?) AS query
+		WHERE tasks.search_vector @@ query AND tasks.deleted_at IS NULL
+		ORDER BY score DESC
+		LIMIT ?`, input, limit).Scan(&taskHits).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var commentHits []SearchHit
+	err = db.Raw(`
+		SELECT 'comment' AS type, comments.task_id, comments.id AS comment_id, tasks.name AS title,
+			ts_rank(comments.search_vector, query) AS score,
+			ts_headline('english', comments.body, query, `+headline+`) AS snippet
+		FROM comments
+		JOIN tasks ON tasks.id = comments.task_id AND tasks.deleted_at IS NULL
+		CROSS JOIN websearch_to_tsquery('english', ?) AS query
+		WHERE comments.search_vector @@ query AND comments.deleted_at IS NULL
+		ORDER BY score DESC
+		LIMIT ?`, input, limit).Scan(&commentHits).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return append(taskHits, commentHits...), nil
+}
+
+func searchFTS5Hits(db *gorm.DB, input string, limit int) ([]SearchHit, error) {
+	match := fts5Query(input)
+	if match == "" {
+		return nil, nil
+	}
+
+	// bm25 is lower for better matches; names weigh twice as much as descriptions
+	var taskHits []SearchHit
+	err := db.Raw(`
+		SELECT 'task' AS type, tasks.id AS task_id, tasks.name AS title,
+			-bm25(tasks_fts, 2.0, 1.0) AS score,
+			snippet(tasks_fts, -1, ?, ?, '…', 16) AS snippet
+		FROM tasks_fts JOIN tasks ON tasks.id = tasks_fts.rowid
+		WHERE tasks_fts MATCH ? AND tasks.deleted_at IS NULL
+		ORDER BY score DESC
+		LIMIT ?`, highlightStart, highlightStop, match, limit).Scan(&taskHits).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var commentHits []SearchHit
+	err = db.Raw(`
+		SELECT 'comment' AS type, comments.task_id, comments.id AS comment_id, tasks.name AS title,
+			-bm25(comments_fts) AS score,
+			snippet(comments_fts, 0, ?, ?, '…', 16) AS snippet
+		FROM comments_fts
+		JOIN comments ON comments.id = comments_fts.rowid
+		JOIN tasks ON tasks.id = comments.task_id AND tasks.deleted_at IS NULL
+		WHERE comments_fts MATCH ? AND comments.deleted_at IS NULL
+		ORDER BY score DESC
+		LIMIT ?`, highlightStart, highlightStop, match, limit).Scan(&commentHits).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return append(taskHits, commentHits...), nil
+}
+
+// searchLikeHits is the fallback for databases without full-text support.
+// Ranking counts term occurrences, weighting task names double.
+func searchLikeHits(db *gorm.DB, input string, limit int) ([]SearchHit, error) {
+	terms := searchTerms(input)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	taskQuery := db.Model(&Task{})
+	commentQuery := db.Model(&Comment{}).Joins("JOIN tasks ON tasks.id = comments.task_id AND tasks.deleted_at IS NULL")
+	for _, term := range terms {
+		pattern := "%" + filter.EscapeLike(term) + "%"
+		taskQuery = taskQuery.Where(`(LOWER(tasks.name) LIKE ? ESCAPE '\' OR LOWER(tasks.description) LIKE ? ESCAPE '\')`, pattern, pattern)
+		commentQuery = commentQuery.Where(`LOWER(comments.body) LIKE ? ESCAPE '\'`, pattern)
+	}
+
+	var tasks []Task
+	if err := taskQuery.Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	var comments []Comment
+	if err := commentQuery.Find(&comments).Error; err != nil {
+		return nil, err
+	}
+
+	hits := make([]SearchHit, 0, len(tasks)+len(comments))
+	for _, task := range tasks {
+		text := task.Task
+		if task.Description != "" {
+			text += " - " + task.Description
+		}
+		hits = append(hits, SearchHit{
+			Type:    "task",
+			TaskID:  task.ID,
+			Title:   task.Task,
+			Snippet: highlightSnippet(text, terms),
+			Rank:    float64(2*countTerms(task.Task, terms) + countTerms(task.Description, terms)),
+		})
+	}
+	if len(comments) > 0 {
+		titles := make(map[uint]string)
+		var taskIDs []uint
+		for _, comment := range comments {
+			taskIDs = append(taskIDs, comment.TaskID)
+		}
+		var commentTasks []Task
+		if err := db.Select("id", "name").Where("id IN ?", taskIDs).Find(&commentTasks).Error; err != nil {
+			return nil, err
+		}
+		for _, task := range commentTasks {
+			titles[task.ID] = task.Task
+		}
+		for _, comment := range comments {
+			commentID := comment.ID
+			hits = append(hits, SearchHit{
+				Type:      "comment",
+				TaskID:    comment.TaskID,
+				CommentID: &commentID,
+				Title:     titles[comment.TaskID],
+				Snippet:   highlightSnippet(comment.Body, terms),
+				Rank:      float64(countTerms(comment.Body, terms)),
+			})
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].Rank > hits[j].Rank })
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+// countTerms counts case-insensitive occurrences of all terms in text
+func countTerms(text string, terms []string) int {
+	lower := strings.ToLower(text)
+	count := 0
+	for _, term := range terms {
+		count += strings.Count(lower, term)
+	}
+	return count
+}
+
+// highlightSnippet returns a window of text around the first match with all
+// term occurrences wrapped in highlight markers
+func highlightSnippet(text string, terms []string) string {
+	const radius = 60
+
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// Case folding changed the length; fall back to matching the original text
+		lower = runes
+	}
+
+	first := -1
+	for _, term := range terms {
+		if idx := indexRunes(lower, []rune(term), 0); idx >= 0 && (first < 0 || idx < first) {
+			first = idx
+		}
+	}
+	start, end := 0, len(runes)
+	if first > radius {
+		start = first - radius
+	}
+	if end-start > 2*radius {
+		end = start + 2*radius
+	}
+
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+	for i := start; i < end; {
+		matched := 0
+		for _, term := range terms {
+			termRunes := []rune(term)
+			if len(termRunes) > matched && i+len(termRunes) <= end && indexRunes(lower[i:i+len(termRunes)], termRunes, 0) == 0 {
+				matched = len(termRunes)
+			}
+		}
+		if matched > 0 {
+			sb.WriteString(highlightStart)
+			sb.WriteString(string(runes[i : i+matched]))
+			sb.WriteString(highlightStop)
+			i += matched
+			continue
+		}
+		sb.WriteRune(runes[i])
+		i++
+	}
+	if end < len(runes) {
+		sb.WriteString("…")
+	}
+	return sb.String()
+}
+
+// indexRunes returns the index of needle in haystack at or after from, or -1
+func indexRunes(haystack, needle []rune, from int) int {
+	if len(needle) == 0 {
+		return -1
+	}
+	for i := from; i+len(needle) <= len(haystack); i++ {
+		match := true
+		for j := range needle {
+			if haystack[i+j] != needle[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
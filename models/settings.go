@@ -0,0 +1,97 @@
+package models
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DefaultArchiveAfterDays applies to users without their own setting
+const DefaultArchiveAfterDays = 30
+
+// UserSettings holds per-user preferences
+type UserSettings struct {
+	gorm.Model
+	UserID uint `gorm:"uniqueIndex" json:"userId"`
+	// ArchiveAfterDays archives completed tasks this many days after
+	// completion; 0 disables automatic archiving
+	ArchiveAfterDays int `json:"archiveAfterDays"`
+}
+
+type UpdateSettingsRequest struct {
+	ArchiveAfterDays *int `json:"archiveAfterDays,omitempty" binding:"omitempty,min=0,max=3650"`
+}
+
+// settingsFor returns the user's settings, falling back to the defaults
+// when none have been stored
+func settingsFor(db *gorm.DB, userID uint) (UserSettings, error) {
+	settings := UserSettings{UserID: userID, ArchiveAfterDays: DefaultArchiveAfterDays}
+	err := db.Where("user_id = ?", userID).First(&settings).Error
+	if err == gorm.ErrRecordNotFound {
+		return settings, nil
+	}
+	return settings, err
+}
+
+// GetSettings retrieves the caller's settings
+// @Summary Get user settings
+// @Tags settings
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /settings [get]
+func GetSettings(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	settings, err := settingsFor(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve settings"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": settings})
+}
+
+// UpdateSettings changes the caller's settings
+// @Summary Update user settings
+// @Tags settings
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param settings body UpdateSettingsRequest true "Settings to change"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /settings [put]
+func UpdateSettings(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var input UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+		return
+	}
+
+	settings, err := settingsFor(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve settings"})
+		return
+	}
+	if input.ArchiveAfterDays != nil {
+		settings.ArchiveAfterDays = *input.ArchiveAfterDays
+	}
+	if err := DB.Save(&settings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update settings", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": settings})
+}
@@ -11,11 +11,11 @@ import (
 var DB *gorm.DB
 
 type connection struct {
-	host     string 
-	dbname   string 
+	host     string
+	dbname   string
 	user     string
 	password string
-	port     int  
+	port     int
 }
 
 func NewDBConnection() *connection {
@@ -41,7 +41,7 @@ func ConnectDatabase() {
 		panic("Failed to connect to database!")
 	}
 
-	err = database.AutoMigrate(&User{}, &Task{})
+	err = Migrate(database)
 	if err != nil {
 		return
 	}
@@ -49,6 +49,18 @@ func ConnectDatabase() {
 	DB = database
 }
 
+// Migrate creates or updates the schema for all models, including the
+// database-specific full-text search structures
+func Migrate(db *gorm.DB) error {
+	if err := db.AutoMigrate(&User{}, &Task{}, &Comment{}, &Tag{}, &TaskTemplate{}, &ChecklistItem{}, &Attachment{}, &UserSettings{}, &TaskStatusChange{}, &TaskDependency{}, &Project{}, &CustomFieldDefinition{}, &TaskLink{}, &TaskWatcher{}, &Notification{}, &CalendarToken{}, &AppPassword{}, &AccountExport{}); err != nil {
+		return err
+	}
+	if err := backfillStatusHistory(db); err != nil {
+		return err
+	}
+	return setupSearch(db)
+}
+
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// snoozeHour is the local hour at which tasks snoozed to a later day resurface
+const snoozeHour = 9
+
+// SnoozeRequest sets the defer time either from a preset or explicitly
+type SnoozeRequest struct {
+	// Preset is one of laterToday, tomorrow or nextWeek
+	Preset string `json:"preset,omitempty" enums:"laterToday,tomorrow,nextWeek"`
+	// Until is a date (YYYY-MM-DD) or RFC 3339 timestamp
+	Until string `json:"until,omitempty"`
+}
+
+// snoozePreset resolves a preset relative to now: three hours later, 9:00
+// tomorrow, or 9:00 next Monday
+func snoozePreset(preset string, now time.Time) (time.Time, error) {
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch preset {
+	case "laterToday":
+		return now.Add(3 * time.Hour), nil
+	case "tomorrow":
+		return startOfDay.AddDate(0, 0, 1).Add(snoozeHour * time.Hour), nil
+	case "nextWeek":
+		days := (8 - int(now.Weekday())) % 7
+		if days == 0 {
+			days = 7
+		}
+		return startOfDay.AddDate(0, 0, days).Add(snoozeHour * time.Hour), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown preset %q, expected laterToday, tomorrow or nextWeek", preset)
+}
+
+// SnoozeTask hides a pending task until its defer time
+// @Summary Snooze a task
+// @Description Hide a task from listings until a preset or explicit time, after which it resurfaces in the inbox
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param snooze body SnoozeRequest true "Preset or time"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id}/snooze [post]
+func SnoozeTask(c *gin.Context) {
+	var input SnoozeRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+		return
+	}
+	if (input.Preset == "") == (input.Until == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": "exactly one of preset and until is required"})
+		return
+	}
+
+	now := time.Now()
+	var until time.Time
+	var err error
+	if input.Preset != "" {
+		until, err = snoozePreset(input.Preset, now)
+	} else {
+		until, err = parseDateParam(input.Until)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid snooze time", "details": err.Error()})
+		return
+	}
+	if !until.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid snooze time", "details": "the snooze time must be in the future"})
+		return
+	}
+
+	task, ok := findTask(c)
+	if !ok {
+		return
+	}
+	if task.Status != StatusPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only pending tasks can be snoozed"})
+		return
+	}
+	before := task
+	task.DeferUntil = &until
+	if err := DB.Save(&task).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not snooze task", "details": err.Error()})
+		return
+	}
+	actorID, _ := currentUserID(c)
+	publishTaskEvent(actorID, before, task)
+	c.JSON(http.StatusOK, gin.H{"data": task})
+}
+
+// UnsnoozeTask clears a task's defer time, returning a snoozed task to the
+// listings or dismissing a resurfaced one from the inbox
+// @Summary Unsnooze a task
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id}/unsnooze [post]
+func UnsnoozeTask(c *gin.Context) {
+	task, ok := findTask(c)
+	if !ok {
+		return
+	}
+	before := task
+	task.DeferUntil = nil
+	if err := DB.Save(&task).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not unsnooze task", "details": err.Error()})
+		return
+	}
+	actorID, _ := currentUserID(c)
+	publishTaskEvent(actorID, before, task)
+	c.JSON(http.StatusOK, gin.H{"data": task})
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// priorityRank orders priorities semantically rather than alphabetically
+const priorityRank = "(CASE priority WHEN 'high' THEN 3 WHEN 'medium' THEN 2 WHEN 'low' THEN 1 ELSE 0 END)"
+
+// maxSortTerms bounds the number of keys in a sort expression
+const maxSortTerms = 5
+
+// taskSortKeys lists the fields tasks can be sorted by, keyed by API name.
+// Only these expressions ever reach ORDER BY.
+var taskSortKeys = map[string]taskSortKey{
+	"id":        {expr: "id", kind: sortKeyNumber, value: func(t *Task) interface{} { return t.ID }},
+	"createdAt": {expr: "created_at", kind: sortKeyTime, value: func(t *Task) interface{} { return t.CreatedAt }},
+	"updatedAt": {expr: "updated_at", kind: sortKeyTime, value: func(t *Task) interface{} { return t.UpdatedAt }},
+	"dueDate": {expr: "due_date", kind: sortKeyTime, nullable: true, value: func(t *Task) interface{} {
+		if t.DueDate == nil {
+			return nil
+		}
+		return *t.DueDate
+	}},
+	"deferUntil": {expr: "defer_until", kind: sortKeyTime, nullable: true, value: func(t *Task) interface{} {
+		if t.DeferUntil == nil {
+			return nil
+		}
+		return *t.DeferUntil
+	}},
+	"task":     {expr: "name", kind: sortKeyString, value: func(t *Task) interface{} { return t.Task }},
+	"priority": {expr: priorityRank, kind: sortKeyNumber, value: func(t *Task) interface{} { return priorityValue(t.Priority) }},
+	"status":   {expr: "status", kind: sortKeyString, value: func(t *Task) interface{} { return string(t.Status) }},
+	"category": {expr: "category", kind: sortKeyString, value: func(t *Task) interface{} { return t.Category }},
+	// urgency is computed by tasksWithUrgency
+	"urgency": {expr: "urgency", kind: sortKeyNumber, value: func(t *Task) interface{} {
+		if t.Urgency == nil {
+			return 0.0
+		}
+		return *t.Urgency
+	}},
+}
+
+// taskSortAliases maps normalised alternative spellings to API names
+var taskSortAliases = map[string]string{
+	"name": "task",
+}
+
+// priorityValue mirrors priorityRank for loaded tasks
+func priorityValue(p TaskPriority) int {
+	switch p {
+	case PriorityHigh:
+		return 3
+	case PriorityMedium:
+		return 2
+	case PriorityLow:
+		return 1
+	}
+	return 0
+}
+
+// lookupTaskSortKey resolves a field name in camelCase or snake_case, or a
+// custom field as cf.<key> defined in the db session
+func lookupTaskSortKey(db *gorm.DB, name string) (string, taskSortKey, bool) {
+	if key, ok := customFieldName(name); ok {
+		definition, ok := lookupCustomField(db, key)
+		if !ok {
+			return "", taskSortKey{}, false
+		}
+		sortKey, ok := definition.sortKey(db)
+		return "cf." + key, sortKey, ok
+	}
+	normalised := strings.ToLower(strings.ReplaceAll(name, "_", ""))
+	if alias, ok := taskSortAliases[normalised]; ok {
+		normalised = alias
+	}
+	for apiName, key := range taskSortKeys {
+		if strings.ToLower(apiName) == normalised {
+			return apiName, key, true
+		}
+	}
+	return "", taskSortKey{}, false
+}
+
+// parseTaskSort parses a sort expression such as `-priority,dueDate,created_at`,
+// where a leading '-' sorts that key in descending order
+func parseTaskSort(db *gorm.DB, spec string) (taskSort, error) {
+	var order taskSort
+	seen := make(map[string]bool)
+	for _, item := range splitList(spec) {
+		desc := false
+		switch item[0] {
+		case '-':
+			desc, item = true, item[1:]
+		case '+':
+			item = item[1:]
+		}
+		name, key, ok := lookupTaskSortKey(db, item)
+		if !ok {
+			return nil, fmt.Errorf("cannot sort by %q, expected one of %s or a custom field as cf.<key>", item, strings.Join(sortedKeys(taskSortKeys), ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate sort field %q", item)
+		}
+		seen[name] = true
+		order = append(order, sortTerm{name: name, key: key, desc: desc})
+	}
+	if len(order) > maxSortTerms {
+		return nil, fmt.Errorf("at most %d sort fields are allowed", maxSortTerms)
+	}
+	return order, nil
+}
+
+// taskSortFromQuery builds the ordering for a listing from `sort`, falling
+// back to the legacy single-field `sortBy`/`sortOrder` parameters
+func taskSortFromQuery(db *gorm.DB, query TaskQuery) (taskSort, error) {
+	if query.Sort != "" {
+		return parseTaskSort(db, query.Sort)
+	}
+	sortBy := query.SortBy
+	if sortBy == "" {
+		sortBy = "created_at"
+	}
+	if query.SortOrder != "asc" {
+		sortBy = "-" + sortBy
+	}
+	return parseTaskSort(db, sortBy)
+}
@@ -0,0 +1,307 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+)
+
+type StatsQuery struct {
+	// From and To are inclusive calendar days (UTC); the default range is
+	// the last 30 days
+	From string `form:"from"`
+	To   string `form:"to"`
+	// UserID selects another user's statistics; admins only
+	UserID *uint `form:"userId"`
+}
+
+// DailyStats counts the tasks created and completed on one day
+type DailyStats struct {
+	Date      string `json:"date"`
+	Created   int64  `json:"created"`
+	Completed int64  `json:"completed"`
+}
+
+type OverdueStats struct {
+	// Open tasks whose due date has passed
+	Open int64 `json:"open"`
+	// CompletedLate tasks were completed in the range after their due date
+	CompletedLate int64 `json:"completedLate"`
+}
+
+// TaskStats summarises a user's tasks over a date range
+type TaskStats struct {
+	UserID    uint         `json:"userId"`
+	From      string       `json:"from"`
+	To        string       `json:"to"`
+	Created   int64        `json:"created"`
+	Completed int64        `json:"completed"`
+	Daily     []DailyStats `json:"daily"`
+	// CompletionRate is the share of tasks created in the range that are
+	// completed now
+	CompletionRate float64 `json:"completionRate"`
+	// MedianHoursToComplete covers tasks completed in the range, rounded to
+	// two decimals; null when there are none
+	MedianHoursToComplete *float64         `json:"medianHoursToComplete"`
+	Overdue               OverdueStats     `json:"overdue"`
+	ByPriority            map[string]int64 `json:"byPriority"`
+	ByCategory            map[string]int64 `json:"byCategory"`
+	ByStatus              map[string]int64 `json:"byStatus"`
+}
+
+// statsDialect holds the SQL that differs between the supported databases
+type statsDialect struct {
+	// day renders a timestamp column as a UTC YYYY-MM-DD string
+	day func(column string) string
+	// seconds renders the number of seconds between two timestamp columns
+	seconds func(from, to string) string
+}
+
+func statsDialectFor(db *gorm.DB) statsDialect {
+	if db.Dialector.Name() == "postgres" {
+		return statsDialect{
+			day: func(column string) string {
+				return "TO_CHAR(" + column + " AT TIME ZONE 'UTC', 'YYYY-MM-DD')"
+			},
+			seconds: func(from, to string) string {
+				return "EXTRACT(EPOCH FROM (" + to + " - " + from + "))"
+			},
+		}
+	}
+	return statsDialect{
+		day: func(column string) string {
+			return "STRFTIME('%Y-%m-%d', " + column + ")"
+		},
+		seconds: func(from, to string) string {
+			return "((JULIANDAY(" + to + ") - JULIANDAY(" + from + ")) * 86400)"
+		},
+	}
+}
+
+// completedAtExpr is when a completed task was completed; tasks completed
+// before completion times were recorded fall back to their last update
+const completedAtExpr = "COALESCE(completed_at, updated_at)"
+
+// GetStats reports productivity statistics
+// @Summary Productivity statistics
+// @Description Tasks created versus completed per day, completion rate, median time to complete, overdue counts and breakdowns by priority, category and status. Admins may pass userId to see another user's statistics.
+// @Tags stats
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "First day (YYYY-MM-DD), default 30 days ago"
+// @Param to query string false "Last day (YYYY-MM-DD), default today"
+// @Param userId query int false "User to report on (admins only)"
+// @Success 200 {object} TaskStats
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 403 {object} map[string]interface{}
+// @Router /stats [get]
+func GetStats(c *gin.Context) {
+	callerID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var query StatsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+
+	userID := callerID
+	if query.UserID != nil && *query.UserID != callerID {
+		if role, _ := c.Get("user_role"); role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can view other users' statistics"})
+			return
+		}
+		userID = *query.UserID
+	}
+
+	from, to, err := parseStatsRange(query.From, query.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+
+	stats, err := computeStats(DB, userID, from, to, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not compute statistics", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": stats})
+}
+
+// parseStatsRange reads an inclusive range of UTC calendar days, defaulting
+// to the last 30 days
+func parseStatsRange(fromValue, toValue string) (time.Time, time.Time, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from, to := today.AddDate(0, 0, -(defaultStatsDays-1)), today
+	for _, param := range []struct {
+		value  string
+		target *time.Time
+	}{{fromValue, &from}, {toValue, &to}} {
+		if param.value == "" {
+			continue
+		}
+		day, err := time.Parse("2006-01-02", param.value)
+		if err != nil {
+			return from, to, errors.New("dates must be YYYY-MM-DD")
+		}
+		*param.target = day
+	}
+	if to.Before(from) {
+		return from, to, errors.New("from must not be after to")
+	}
+	if to.Sub(from) >= maxStatsDays*24*time.Hour {
+		return from, to, fmt.Errorf("the range can span at most %d days", maxStatsDays)
+	}
+	return from, to, nil
+}
+
+// computeStats aggregates a user's tasks for the days from..to inclusive
+func computeStats(db *gorm.DB, userID uint, from, to, now time.Time) (TaskStats, error) {
+	dialect := statsDialectFor(db)
+	end := to.AddDate(0, 0, 1)
+	stats := TaskStats{
+		UserID:     userID,
+		From:       from.Format("2006-01-02"),
+		To:         to.Format("2006-01-02"),
+		ByPriority: map[string]int64{},
+		ByCategory: map[string]int64{},
+		ByStatus:   map[string]int64{},
+	}
+
+	tasks := func() *gorm.DB {
+		return db.Model(&Task{}).Where("user_id = ?", userID)
+	}
+	created := func() *gorm.DB {
+		return tasks().Where("created_at >= ? AND created_at < ?", from, end)
+	}
+	completed := func() *gorm.DB {
+		return tasks().Where("status = ?", StatusCompleted).
+			Where(completedAtExpr+" >= ? AND "+completedAtExpr+" < ?", from, end)
+	}
+
+	type dayCount struct {
+		Day   string
+		Count int64
+	}
+	daily := make(map[string]*DailyStats)
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		key := day.Format("2006-01-02")
+		daily[key] = &DailyStats{Date: key}
+	}
+	var createdByDay, completedByDay []dayCount
+	if err := created().Select(dialect.day("created_at") + " AS day, COUNT(*) AS count").
+		Group("day").Scan(&createdByDay).Error; err != nil {
+		return stats, err
+	}
+	if err := completed().Select(dialect.day(completedAtExpr) + " AS day, COUNT(*) AS count").
+		Group("day").Scan(&completedByDay).Error; err != nil {
+		return stats, err
+	}
+	for _, row := range createdByDay {
+		if entry, ok := daily[row.Day]; ok {
+			entry.Created += row.Count
+		}
+		stats.Created += row.Count
+	}
+	for _, row := range completedByDay {
+		if entry, ok := daily[row.Day]; ok {
+			entry.Completed += row.Count
+		}
+		stats.Completed += row.Count
+	}
+	for _, key := range sortedKeys(daily) {
+		stats.Daily = append(stats.Daily, *daily[key])
+	}
+
+	// Breakdowns cover the tasks created in the range
+	type groupCount struct {
+		Value string
+		Count int64
+	}
+	for column, target := range map[string]map[string]int64{
+		"priority": stats.ByPriority,
+		"category": stats.ByCategory,
+		"status":   stats.ByStatus,
+	} {
+		var rows []groupCount
+		if err := created().Select(column + " AS value, COUNT(*) AS count").
+			Group(column).Scan(&rows).Error; err != nil {
+			return stats, err
+		}
+		for _, row := range rows {
+			target[row.Value] = row.Count
+		}
+	}
+	if stats.Created > 0 {
+		stats.CompletionRate = float64(stats.ByStatus[string(StatusCompleted)]) / float64(stats.Created)
+	}
+
+	median, err := medianSecondsToComplete(completed().Where("completed_at IS NOT NULL"), dialect)
+	if err != nil {
+		return stats, err
+	}
+	if median != nil {
+		hours := math.Round(*median/36) / 100
+		stats.MedianHoursToComplete = &hours
+	}
+
+	if err := tasks().Where("status = ? AND due_date < ?", StatusPending, now).
+		Count(&stats.Overdue.Open).Error; err != nil {
+		return stats, err
+	}
+	if err := completed().Where("due_date IS NOT NULL AND " + completedAtExpr + " > due_date").
+		Count(&stats.Overdue.CompletedLate).Error; err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// medianSecondsToComplete finds the median completion time of the tasks in
+// scope by counting them and reading the middle row(s) in order, which needs
+// no database-specific percentile function
+func medianSecondsToComplete(scope *gorm.DB, dialect statsDialect) (*float64, error) {
+	duration := dialect.seconds("created_at", "completed_at")
+
+	var count int64
+	if err := scope.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	take := 1
+	if count%2 == 0 {
+		take = 2
+	}
+	var middle []float64
+	err := scope.Session(&gorm.Session{}).
+		Order(duration).Offset(int((count-1)/2)).Limit(take).
+		Pluck(duration, &middle).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(middle) == 0 {
+		return nil, nil
+	}
+	median := middle[0]
+	if len(middle) == 2 {
+		median = (middle[0] + middle[1]) / 2
+	}
+	return &median, nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TaskStatusChange records a task moving between statuses. The first entry
+// of every task has an empty From and is dated when the task was created.
+type TaskStatusChange struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	TaskID    uint       `gorm:"index:idx_task_status_changes_task,priority:1" json:"taskId"`
+	From      TaskStatus `gorm:"column:from_status;type:varchar(20)" json:"from"`
+	To        TaskStatus `gorm:"column:to_status;type:varchar(20)" json:"to"`
+	ChangedAt time.Time  `gorm:"index:idx_task_status_changes_task,priority:2" json:"changedAt"`
+}
+
+// AfterCreate records the initial status of a new task
+func (t *Task) AfterCreate(tx *gorm.DB) error {
+	status := t.Status
+	if status == "" {
+		status = StatusPending
+	}
+	t.statusChange = nil
+	return tx.Session(&gorm.Session{NewDB: true}).Create(&TaskStatusChange{
+		TaskID:    t.ID,
+		To:        status,
+		ChangedAt: t.CreatedAt,
+	}).Error
+}
+
+// AfterUpdate records a status change made through setStatus
+func (t *Task) AfterUpdate(tx *gorm.DB) error {
+	if t.statusChange == nil {
+		return nil
+	}
+	change := *t.statusChange
+	change.TaskID = t.ID
+	t.statusChange = nil
+	return tx.Session(&gorm.Session{NewDB: true}).Create(&change).Error
+}
+
+// backfillStatusHistory gives tasks created before status changes were
+// recorded an approximate history: pending from creation and, if they have
+// moved on since, their current status from their completion or last update.
+// Tasks that already have a history are left alone, so it is safe to rerun.
+func backfillStatusHistory(db *gorm.DB) error {
+	err := db.Exec(`INSERT INTO task_status_changes (task_id, from_status, to_status, changed_at)
+		SELECT id, ?, status, COALESCE(completed_at, updated_at) FROM tasks
+		WHERE status <> ? AND NOT EXISTS (SELECT 1 FROM task_status_changes h WHERE h.task_id = tasks.id)`,
+		StatusPending, StatusPending).Error
+	if err != nil {
+		return err
+	}
+	return db.Exec(`INSERT INTO task_status_changes (task_id, from_status, to_status, changed_at)
+		SELECT id, '', ?, created_at FROM tasks
+		WHERE NOT EXISTS (SELECT 1 FROM task_status_changes h WHERE h.task_id = tasks.id AND h.from_status = '')`,
+		StatusPending).Error
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type Tag struct {
+	gorm.Model
+	Name string `gorm:"type:varchar(100);uniqueIndex;not null" json:"name"`
+}
+
+// findOrCreateTags resolves tag names to Tag rows, creating missing ones.
+// Names are trimmed and de-duplicated case-insensitively.
+func findOrCreateTags(db *gorm.DB, names []string) ([]Tag, error) {
+	tags := make([]Tag, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		var tag Tag
+		if err := db.Where("LOWER(name) = ?", key).FirstOrCreate(&tag, Tag{Name: name}).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
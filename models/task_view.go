@@ -0,0 +1,164 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// TaskView controls the shape of task responses: `fields` selects a sparse
+// fieldset and `include` embeds related records
+type TaskView struct {
+	Fields  string `form:"fields"`
+	Include string `form:"include"`
+}
+
+// taskIncludes maps include names to the relations they preload
+var taskIncludes = map[string]func(db *gorm.DB) *gorm.DB{
+	"user":    func(db *gorm.DB) *gorm.DB { return db.Preload("User") },
+	"project": func(db *gorm.DB) *gorm.DB { return db.Preload("Project") },
+	"tags":    func(db *gorm.DB) *gorm.DB { return db.Preload("Tags") },
+	"comments": func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Comments", func(db *gorm.DB) *gorm.DB { return db.Order("created_at ASC") })
+	},
+	"subtasks": func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Subtasks", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") })
+	},
+	"checklist": func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Checklist", func(db *gorm.DB) *gorm.DB { return db.Order("position ASC, id ASC") })
+	},
+	"attachments": func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Attachments", func(db *gorm.DB) *gorm.DB { return db.Order("id ASC") })
+	},
+}
+
+// taskViewFields lists the fields selectable with `fields`, mapping the
+// lower-cased JSON name to the name used in responses
+var taskViewFields = jsonFieldNames(reflect.TypeOf(Task{}))
+
+// jsonFieldNames collects the JSON names of a struct's fields, descending
+// into embedded structs and skipping relations served by `include`
+func jsonFieldNames(t reflect.Type) map[string]string {
+	names := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if field.Anonymous && tag == "" {
+			for key, name := range jsonFieldNames(field.Type) {
+				names[key] = name
+			}
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, isRelation := taskIncludes[strings.ToLower(name)]; isRelation {
+			continue
+		}
+		names[strings.ToLower(name)] = name
+	}
+	return names
+}
+
+// taskViewSpec is a validated TaskView
+type taskViewSpec struct {
+	fields   []string
+	includes []string
+}
+
+// parse validates the requested fields and relations
+func (v TaskView) parse() (taskViewSpec, error) {
+	var spec taskViewSpec
+	for _, name := range splitList(v.Include) {
+		name = strings.ToLower(name)
+		if _, ok := taskIncludes[name]; !ok {
+			return spec, fmt.Errorf("unknown include %q, expected one of %s", name, strings.Join(sortedKeys(taskIncludes), ", "))
+		}
+		spec.includes = append(spec.includes, name)
+	}
+	for _, name := range splitList(v.Fields) {
+		key, ok := taskViewFields[strings.ToLower(name)]
+		if !ok {
+			return spec, fmt.Errorf("unknown field %q", name)
+		}
+		spec.fields = append(spec.fields, key)
+	}
+	return spec, nil
+}
+
+// preload adds a batched preload for every included relation, so each
+// relation costs one query regardless of the number of tasks
+func (s taskViewSpec) preload(db *gorm.DB) *gorm.DB {
+	for _, name := range s.includes {
+		db = taskIncludes[name](db)
+	}
+	return db
+}
+
+// render converts tasks into their response form. Without a sparse
+// fieldset the tasks are returned unchanged.
+func (s taskViewSpec) render(tasks []Task) (interface{}, error) {
+	if len(s.fields) == 0 {
+		return tasks, nil
+	}
+	rendered := make([]map[string]interface{}, len(tasks))
+	for i := range tasks {
+		item, err := s.renderOne(&tasks[i])
+		if err != nil {
+			return nil, err
+		}
+		rendered[i] = item
+	}
+	return rendered, nil
+}
+
+func (s taskViewSpec) renderOne(task *Task) (map[string]interface{}, error) {
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return nil, err
+	}
+	var full map[string]interface{}
+	if err := json.Unmarshal(payload, &full); err != nil {
+		return nil, err
+	}
+	item := make(map[string]interface{}, len(s.fields)+len(s.includes))
+	for _, key := range s.fields {
+		if value, ok := full[key]; ok {
+			item[key] = value
+		}
+	}
+	for _, name := range s.includes {
+		if value, ok := full[name]; ok {
+			item[name] = value
+		}
+	}
+	return item, nil
+}
+
+// splitList splits a comma-separated query parameter, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
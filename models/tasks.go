@@ -1,10 +1,13 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/KingLeak95/todo-list-go/pkg/filter"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
@@ -27,17 +30,76 @@ const (
 	StatusCancelled TaskStatus = "cancelled"
 )
 
+// Valid reports whether p is a known priority
+func (p TaskPriority) Valid() bool {
+	switch p {
+	case PriorityLow, PriorityMedium, PriorityHigh:
+		return true
+	}
+	return false
+}
+
+// Valid reports whether s is a known status
+func (s TaskStatus) Valid() bool {
+	switch s {
+	case StatusPending, StatusCompleted, StatusCancelled:
+		return true
+	}
+	return false
+}
+
 type Task struct {
 	gorm.Model
-	Task        string       `gorm:"column:name;type:varchar(255);not null" json:"task"`
-	Description string       `gorm:"type:text" json:"description"`
-	Priority    TaskPriority `gorm:"type:varchar(20);default:'medium'" json:"priority"`
-	Status      TaskStatus   `gorm:"type:varchar(20);default:'pending'" json:"status"`
-	DueDate     *time.Time   `json:"dueDate,omitempty"`
-	Category    string       `gorm:"type:varchar(100)" json:"category"`
-	Completed   bool         `json:"completed"` // Deprecated: use Status instead
-	UserID      int          `json:"userId"`
-	User        User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Task         string            `gorm:"column:name;type:varchar(255);not null" json:"task"`
+	Description  string            `gorm:"type:text" json:"description"`
+	Priority     TaskPriority      `gorm:"type:varchar(20);default:'medium'" json:"priority"`
+	Status       TaskStatus        `gorm:"type:varchar(20);default:'pending'" json:"status"`
+	DueDate      *time.Time        `json:"dueDate,omitempty"`
+	Category     string            `gorm:"type:varchar(100)" json:"category"`
+	Completed    bool              `json:"completed"` // Deprecated: use Status instead
+	UserID       int               `json:"userId"`
+	ParentID     *uint             `gorm:"index" json:"parentId,omitempty"`
+	ProjectID    *uint             `gorm:"index" json:"projectId,omitempty"`
+	CustomFields CustomFieldValues `gorm:"type:text;serializer:json" json:"customFields,omitempty"`
+	CompletedAt  *time.Time        `json:"completedAt,omitempty"`
+	ArchivedAt   *time.Time        `gorm:"index" json:"archivedAt,omitempty"`
+	DeferUntil   *time.Time        `gorm:"index" json:"deferUntil,omitempty"`
+	Recurrence   string            `gorm:"type:varchar(255)" json:"recurrence,omitempty"`       // RFC 5545 RRULE, kept from imports
+	ExternalID   string            `gorm:"type:varchar(512);index" json:"externalId,omitempty"` // Source of an imported task
+	Urgency      *float64          `gorm:"->;-:migration" json:"urgency,omitempty"`             // Computed by tasksWithUrgency
+	Blocked      *bool             `gorm:"->;-:migration" json:"blocked,omitempty"`             // Computed by tasksWithUrgency
+	DuplicateOf  *uint             `gorm:"-" json:"duplicateOf,omitempty"`                      // Canonical task, set by GetTaskByID
+	Links        []TaskLinkView    `gorm:"-" json:"links,omitempty"`                            // Set by GetTaskByID
+	User         *User             `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Project      *Project          `gorm:"foreignKey:ProjectID" json:"project,omitempty"`
+	Tags         []Tag             `gorm:"many2many:task_tags;" json:"tags,omitempty"`
+	Comments     []Comment         `gorm:"foreignKey:TaskID" json:"comments,omitempty"`
+	Subtasks     []Task            `gorm:"foreignKey:ParentID" json:"subtasks,omitempty"`
+	Parent       *Task             `gorm:"foreignKey:ParentID" json:"-"` // Loaded for the parent's UID in calendars
+	Checklist    []ChecklistItem   `gorm:"foreignKey:TaskID" json:"checklist,omitempty"`
+	Attachments  []Attachment      `gorm:"foreignKey:TaskID" json:"attachments,omitempty"`
+
+	// statusChange is recorded in the status history when the task is saved
+	statusChange *TaskStatusChange
+}
+
+// setStatus changes the task's status, keeping the deprecated Completed flag
+// and the completion time in sync. Reopening a task also unarchives it.
+func (t *Task) setStatus(status TaskStatus, now time.Time) {
+	if status != t.Status {
+		t.statusChange = &TaskStatusChange{From: t.Status, To: status, ChangedAt: now}
+	}
+	if status == StatusCompleted {
+		if t.Status != StatusCompleted || t.CompletedAt == nil {
+			t.CompletedAt = &now
+		}
+	} else {
+		t.CompletedAt = nil
+		t.ArchivedAt = nil
+	}
+	t.Status = status
+	// Update completed field for backward compatibility
+	t.Completed = status == StatusCompleted
 }
 
 type NewTask struct {
@@ -47,6 +109,10 @@ type NewTask struct {
 	Category    string       `json:"category"`
 	DueDate     *time.Time   `json:"dueDate,omitempty"`
 	UserID      int          `json:"userId" binding:"required"`
+	Tags        []string     `json:"tags,omitempty"`
+	ProjectID   *uint        `json:"projectId,omitempty"`
+	// CustomFields are validated against the project's field definitions
+	CustomFields map[string]interface{} `json:"customFields,omitempty"`
 }
 
 type UpdateTaskRequest struct {
@@ -56,6 +122,14 @@ type UpdateTaskRequest struct {
 	Category    *string       `json:"category,omitempty"`
 	DueDate     *time.Time    `json:"dueDate,omitempty"`
 	Status      *TaskStatus   `json:"status,omitempty"`
+	Tags        []string      `json:"tags,omitempty"`
+	// UserID reassigns the task, notifying the new assignee
+	UserID *int `json:"userId,omitempty" binding:"omitempty,min=1"`
+	// ProjectID moves the task to another project; 0 removes it from its
+	// project. Custom fields are cleared when the project changes.
+	ProjectID *uint `json:"projectId,omitempty"`
+	// CustomFields are merged into the task's values; null clears a field
+	CustomFields map[string]interface{} `json:"customFields,omitempty"`
 }
 
 type TaskQuery struct {
@@ -63,11 +137,111 @@ type TaskQuery struct {
 	Priority  *TaskPriority `form:"priority"`
 	Status    *TaskStatus   `form:"status"`
 	Category  *string       `form:"category"`
+	ProjectID *uint         `form:"projectId"`
 	Page      int           `form:"page,default=1"`
 	Limit     int           `form:"limit,default=10"`
+	Sort      string        `form:"sort"`
 	SortBy    string        `form:"sortBy,default=created_at"`
 	SortOrder string        `form:"sortOrder,default=desc"`
 	Search    string        `form:"search"`
+	Filter    string        `form:"q"`
+	Archived  bool          `form:"archived"`
+	Deferred  bool          `form:"deferred"`
+	After     string        `form:"after"`
+	Before    string        `form:"before"`
+	TaskView
+
+	// scopes narrow the listing further for views built on it
+	scopes []func(*gorm.DB) *gorm.DB
+}
+
+// taskFilterFields lists the fields usable in the `q` filter expression
+var taskFilterFields = filter.Fields{
+	"task":        {Column: "name", Type: filter.Text},
+	"name":        {Column: "name", Type: filter.Text},
+	"description": {Column: "description", Type: filter.Text},
+	"priority":    {Column: "priority", Type: filter.String, Values: []string{string(PriorityLow), string(PriorityMedium), string(PriorityHigh)}},
+	"status":      {Column: "status", Type: filter.String, Values: []string{string(StatusPending), string(StatusCompleted), string(StatusCancelled)}},
+	"category":    {Column: "category", Type: filter.String},
+	"due":         {Column: "due_date", Type: filter.Date},
+	"created":     {Column: "created_at", Type: filter.Date},
+	"updated":     {Column: "updated_at", Type: filter.Date},
+	"user":        {Column: "user_id", Type: filter.Number},
+	"parent":      {Column: "parent_id", Type: filter.Number},
+	"project":     {Column: "project_id", Type: filter.Number},
+	"completed":   {Column: "completed_at", Type: filter.Date},
+	"deferred":    {Column: "defer_until", Type: filter.Date},
+	"urgency":     {Column: "urgency", Type: filter.Number},
+	"blocked":     {Column: "(blocked = 1)", Type: filter.Bool},
+}
+
+// applyTaskFilters narrows a task query by the filters in TaskQuery
+func applyTaskFilters(db *gorm.DB, query TaskQuery) (*gorm.DB, error) {
+	if !query.Archived {
+		db = db.Where("archived_at IS NULL")
+	}
+	if !query.Deferred {
+		db = db.Where("(defer_until IS NULL OR defer_until <= ?)", time.Now())
+	}
+	for _, scope := range query.scopes {
+		db = scope(db)
+	}
+	if query.UserID != nil {
+		db = db.Where("user_id = ?", *query.UserID)
+	}
+	if query.Priority != nil {
+		db = db.Where("priority = ?", *query.Priority)
+	}
+	if query.Status != nil {
+		db = db.Where("status = ?", *query.Status)
+	}
+	if query.Category != nil && *query.Category != "" {
+		db = db.Where("category = ?", *query.Category)
+	}
+	if query.ProjectID != nil {
+		db = db.Where("project_id = ?", *query.ProjectID)
+	}
+	if query.Search != "" {
+		condition, args := taskSearchCondition(db, query.Search)
+		db = db.Where(condition, args...)
+	}
+	if query.Filter != "" {
+		// Custom fields are looked up in the caller's session, without the
+		// conditions of the task query
+		schema := taskFilterSchema{db: db.Session(&gorm.Session{NewDB: true})}
+		condition, args, err := filter.ParseAndCompile(query.Filter, schema, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		db = db.Where(condition, args...)
+	}
+	return db, nil
+}
+
+// respondFilterError reports an invalid `q` expression, including the
+// position of the offending token
+func respondFilterError(c *gin.Context, err error) {
+	var filterErr *filter.Error
+	if errors.As(err, &filterErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter expression", "details": filterErr.Msg, "position": filterErr.Pos})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+}
+
+// findTask loads the task in the path, writing the error response if it
+// does not exist
+func findTask(c *gin.Context) (Task, bool) {
+	var task Task
+	if err := DB.Where("id = ?", c.Param("id")).First(&task).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve task"})
+		}
+		return task, false
+	}
+	return task, true
 }
 
 // CreateTask creates a new task
@@ -88,26 +262,23 @@ func CreateTask(c *gin.Context) {
 		return
 	}
 
-	// Set default priority if not provided
-	if input.Priority == "" {
-		input.Priority = PriorityMedium
+	task, err := newTask(DB, input)
+	var invalid *taskInputError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalid.message, "details": invalid.err.Error()})
+		return
 	}
-
-	task := Task{
-		Task:        input.Task,
-		Description: input.Description,
-		Priority:    input.Priority,
-		Category:    input.Category,
-		DueDate:     input.DueDate,
-		Status:      StatusPending,
-		Completed:   false,
-		UserID:      input.UserID,
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create tags", "details": err.Error()})
+		return
 	}
 
 	if err := DB.Create(&task).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create task", "details": err.Error()})
 		return
 	}
+	actorID, _ := currentUserID(c)
+	notifyTaskChanges(DB, actorID, Task{}, task)
 
 	c.JSON(http.StatusCreated, gin.H{"data": task})
 }
@@ -127,6 +298,8 @@ func DeleteTask(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete task"})
 		return
 	}
+	actorID, _ := currentUserID(c)
+	publishTask(EventTaskDeleted, actorID, task)
 	c.JSON(http.StatusOK, gin.H{"data": id})
 }
 
@@ -141,12 +314,14 @@ func CompleteTask(c *gin.Context) {
 		}
 		return
 	}
-	task.Status = StatusCompleted
-	task.Completed = true
+	before := task
+	task.setStatus(StatusCompleted, time.Now())
 	if err := DB.Save(&task).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not complete task"})
 		return
 	}
+	actorID, _ := currentUserID(c)
+	notifyTaskChanges(DB, actorID, before, task)
 	c.JSON(http.StatusOK, gin.H{"data": task})
 }
 
@@ -160,11 +335,20 @@ func CompleteTask(c *gin.Context) {
 // @Param priority query string false "Filter by priority" Enums(low,medium,high)
 // @Param status query string false "Filter by status" Enums(pending,completed,cancelled)
 // @Param category query string false "Filter by category"
+// @Param projectId query int false "Filter by project ID"
 // @Param search query string false "Search in task name and description"
+// @Param archived query bool false "Include archived tasks"
+// @Param deferred query bool false "Include snoozed tasks whose defer time has not passed"
+// @Param q query string false "Filter expression, e.g. priority:high AND (category:work OR due<7d)"
 // @Param page query int false "Page number" default(1)
 // @Param limit query int false "Items per page" default(10)
-// @Param sortBy query string false "Sort field" default(created_at)
+// @Param sort query string false "Comma-separated sort fields, '-' prefix for descending, e.g. -urgency,dueDate,createdAt"
+// @Param sortBy query string false "Sort field (legacy, use sort)" default(created_at)
 // @Param sortOrder query string false "Sort order" Enums(asc,desc) default(desc)
+// @Param after query string false "Cursor: return tasks after this position (disables offset pagination)"
+// @Param before query string false "Cursor: return tasks before this position (disables offset pagination)"
+// @Param fields query string false "Comma-separated fields to return, e.g. ID,task,dueDate"
+// @Param include query string false "Comma-separated relations to embed: user, tags, comments, subtasks, checklist, attachments"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]interface{}
 // @Failure 500 {object} map[string]interface{}
@@ -176,69 +360,7 @@ func GetAllTasks(c *gin.Context) {
 		return
 	}
 
-	// Set defaults
-	if query.Page <= 0 {
-		query.Page = 1
-	}
-	if query.Limit <= 0 {
-		query.Limit = 10
-	}
-	if query.Limit > 100 {
-		query.Limit = 100 // Max limit
-	}
-
-	var tasks []Task
-	queryBuilder := DB.Model(&Task{})
-
-	// Apply filters
-	if query.UserID != nil {
-		queryBuilder = queryBuilder.Where("user_id = ?", *query.UserID)
-	}
-	if query.Priority != nil {
-		queryBuilder = queryBuilder.Where("priority = ?", *query.Priority)
-	}
-	if query.Status != nil {
-		queryBuilder = queryBuilder.Where("status = ?", *query.Status)
-	}
-	if query.Category != nil && *query.Category != "" {
-		queryBuilder = queryBuilder.Where("category = ?", *query.Category)
-	}
-	if query.Search != "" {
-		queryBuilder = queryBuilder.Where("task ILIKE ? OR description ILIKE ?", "%"+query.Search+"%", "%"+query.Search+"%")
-	}
-
-	// Apply sorting
-	orderBy := query.SortBy
-	if orderBy == "" {
-		orderBy = "created_at"
-	}
-	if query.SortOrder == "asc" {
-		orderBy += " ASC"
-	} else {
-		orderBy += " DESC"
-	}
-	queryBuilder = queryBuilder.Order(orderBy)
-
-	// Get total count
-	var total int64
-	queryBuilder.Count(&total)
-
-	// Apply pagination
-	offset := (query.Page - 1) * query.Limit
-	if err := queryBuilder.Offset(offset).Limit(query.Limit).Find(&tasks).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve tasks", "details": err.Error()})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"data": tasks,
-		"pagination": gin.H{
-			"page":       query.Page,
-			"limit":      query.Limit,
-			"total":      total,
-			"totalPages": (total + int64(query.Limit) - 1) / int64(query.Limit),
-		},
-	})
+	listTasks(c, query)
 }
 
 // GetTasksByUser retrieves tasks for a specific user
@@ -259,6 +381,12 @@ func GetTasksByUser(c *gin.Context) {
 	// Override UserID with the path parameter
 	query.UserID = &userID
 
+	listTasks(c, query)
+}
+
+// listTasks runs a task listing using keyset pagination when an `after` or
+// `before` cursor is given, and offset pagination otherwise
+func listTasks(c *gin.Context, query TaskQuery) {
 	// Set defaults
 	if query.Page <= 0 {
 		query.Page = 1
@@ -266,35 +394,40 @@ func GetTasksByUser(c *gin.Context) {
 	if query.Limit <= 0 {
 		query.Limit = 10
 	}
+	if query.Limit > 100 {
+		query.Limit = 100 // Max limit
+	}
 
-	var tasks []Task
-	queryBuilder := DB.Model(&Task{}).Where("user_id = ?", userID)
-
-	// Apply filters
-	if query.Priority != nil {
-		queryBuilder = queryBuilder.Where("priority = ?", *query.Priority)
+	view, err := query.TaskView.parse()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
 	}
-	if query.Status != nil {
-		queryBuilder = queryBuilder.Where("status = ?", *query.Status)
+
+	var tasks []Task
+	queryBuilder, err := applyTaskFilters(tasksWithUrgency(DB, time.Now()), query)
+	if err != nil {
+		respondFilterError(c, err)
+		return
 	}
-	if query.Category != nil && *query.Category != "" {
-		queryBuilder = queryBuilder.Where("category = ?", *query.Category)
+
+	order, err := taskSortFromQuery(DB, query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
 	}
-	if query.Search != "" {
-		queryBuilder = queryBuilder.Where("task ILIKE ? OR description ILIKE ?", "%"+query.Search+"%", "%"+query.Search+"%")
+
+	if query.After != "" || query.Before != "" {
+		if query.After != "" && query.Before != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": "after and before cannot be combined"})
+			return
+		}
+		listTasksByCursor(c, queryBuilder, query, order, view)
+		return
 	}
 
 	// Apply sorting
-	orderBy := query.SortBy
-	if orderBy == "" {
-		orderBy = "created_at"
-	}
-	if query.SortOrder == "asc" {
-		orderBy += " ASC"
-	} else {
-		orderBy += " DESC"
-	}
-	queryBuilder = queryBuilder.Order(orderBy)
+	queryBuilder = queryBuilder.Order(order.orderClause(false))
 
 	// Get total count
 	var total int64
@@ -302,22 +435,98 @@ func GetTasksByUser(c *gin.Context) {
 
 	// Apply pagination
 	offset := (query.Page - 1) * query.Limit
-	if err := queryBuilder.Offset(offset).Limit(query.Limit).Find(&tasks).Error; err != nil {
+	if err := view.preload(queryBuilder).Offset(offset).Limit(query.Limit).Find(&tasks).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve tasks", "details": err.Error()})
 		return
 	}
 
+	pagination := gin.H{
+		"page":       query.Page,
+		"limit":      query.Limit,
+		"total":      total,
+		"totalPages": (total + int64(query.Limit) - 1) / int64(query.Limit),
+	}
+	// Let clients switch to cursors from any offset page
+	if len(tasks) > 0 && int64(offset+len(tasks)) < total {
+		pagination["nextCursor"] = order.encodeCursor(&tasks[len(tasks)-1])
+	}
+
+	respondTaskList(c, view, tasks, pagination)
+}
+
+// respondTaskList writes a page of tasks in the requested view
+func respondTaskList(c *gin.Context, view taskViewSpec, tasks []Task, pagination gin.H) {
+	data, err := view.render(tasks)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not render tasks", "details": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"data": tasks,
-		"pagination": gin.H{
-			"page":       query.Page,
-			"limit":      query.Limit,
-			"total":      total,
-			"totalPages": (total + int64(query.Limit) - 1) / int64(query.Limit),
-		},
+		"data":       data,
+		"pagination": pagination,
 	})
 }
 
+// listTasksByCursor pages through tasks relative to an opaque cursor. One
+// extra row is fetched to detect whether more results exist, so no COUNT
+// is needed.
+func listTasksByCursor(c *gin.Context, queryBuilder *gorm.DB, query TaskQuery, order taskSort, view taskViewSpec) {
+	backward := query.Before != ""
+	token := query.After
+	if backward {
+		token = query.Before
+	}
+
+	values, err := order.decodeCursor(token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor", "details": err.Error()})
+		return
+	}
+
+	condition, args := order.keysetCondition(values, backward)
+	var tasks []Task
+	err = view.preload(queryBuilder).Where(condition, args...).
+		Order(order.orderClause(backward)).
+		Limit(query.Limit + 1).
+		Find(&tasks).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve tasks", "details": err.Error()})
+		return
+	}
+
+	hasMore := len(tasks) > query.Limit
+	if hasMore {
+		tasks = tasks[:query.Limit]
+	}
+	if backward {
+		for i, j := 0, len(tasks)-1; i < j; i, j = i+1, j-1 {
+			tasks[i], tasks[j] = tasks[j], tasks[i]
+		}
+	}
+
+	// Rows exist on the side the cursor came from
+	hasNext, hasPrev := hasMore, true
+	if backward {
+		hasNext, hasPrev = true, hasMore
+	}
+	pagination := gin.H{
+		"limit":   query.Limit,
+		"hasNext": hasNext,
+		"hasPrev": hasPrev,
+	}
+	if len(tasks) > 0 {
+		if hasNext {
+			pagination["nextCursor"] = order.encodeCursor(&tasks[len(tasks)-1])
+		}
+		if hasPrev {
+			pagination["prevCursor"] = order.encodeCursor(&tasks[0])
+		}
+	}
+
+	respondTaskList(c, view, tasks, pagination)
+}
+
 // UpdateTask updates an existing task
 func UpdateTask(c *gin.Context) {
 	id := c.Param("id")
@@ -337,7 +546,82 @@ func UpdateTask(c *gin.Context) {
 		return
 	}
 
-	// Update fields if provided
+	before := task
+	if err := updateTask(DB, &task, input); err != nil {
+		var invalid *taskInputError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalid.message, "details": invalid.err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update task", "details": err.Error()})
+		}
+		return
+	}
+	actorID, _ := currentUserID(c)
+	notifyTaskChanges(DB, actorID, before, task)
+
+	c.JSON(http.StatusOK, gin.H{"data": task})
+}
+
+// newTask builds a pending task from create input, resolving its tags.
+// Invalid input returns a *taskInputError.
+func newTask(db *gorm.DB, input NewTask) (Task, error) {
+	// Set default priority if not provided
+	if input.Priority == "" {
+		input.Priority = PriorityMedium
+	}
+	if !input.Priority.Valid() {
+		return Task{}, &taskInputError{"Invalid Format", fmt.Errorf("unknown priority %q", input.Priority)}
+	}
+
+	task := Task{
+		Task:        input.Task,
+		Description: input.Description,
+		Priority:    input.Priority,
+		Category:    input.Category,
+		DueDate:     input.DueDate,
+		Status:      StatusPending,
+		Completed:   false,
+		UserID:      input.UserID,
+		ProjectID:   input.ProjectID,
+	}
+
+	customFields, err := resolveCustomFields(db, input.ProjectID, nil, input.CustomFields)
+	if err != nil {
+		return task, &taskInputError{"Invalid custom fields", err}
+	}
+	task.CustomFields = customFields
+
+	if len(input.Tags) > 0 {
+		tags, err := findOrCreateTags(db, input.Tags)
+		if err != nil {
+			return task, err
+		}
+		task.Tags = tags
+	}
+	return task, nil
+}
+
+// taskInputError rejects a new task or an update as invalid, as opposed
+// to a failure to save it
+type taskInputError struct {
+	message string
+	err     error
+}
+
+func (e *taskInputError) Error() string {
+	return e.message + ": " + e.err.Error()
+}
+
+// updateTask validates an update, applies it to the task and saves it with
+// its tags. Invalid updates return a *taskInputError.
+func updateTask(db *gorm.DB, task *Task, input UpdateTaskRequest) error {
+	if input.Priority != nil && !input.Priority.Valid() {
+		return &taskInputError{"Invalid Format", fmt.Errorf("unknown priority %q", *input.Priority)}
+	}
+	if input.Status != nil && !input.Status.Valid() {
+		return &taskInputError{"Invalid Format", fmt.Errorf("unknown status %q", *input.Status)}
+	}
+
 	if input.Task != nil {
 		task.Task = *input.Task
 	}
@@ -353,25 +637,75 @@ func UpdateTask(c *gin.Context) {
 	if input.DueDate != nil {
 		task.DueDate = input.DueDate
 	}
+	if input.UserID != nil {
+		task.UserID = *input.UserID
+	}
 	if input.Status != nil {
-		task.Status = *input.Status
-		// Update completed field for backward compatibility
-		task.Completed = (*input.Status == StatusCompleted)
+		task.setStatus(*input.Status, time.Now())
+	}
+	if input.ProjectID != nil || input.CustomFields != nil {
+		projectID, current := task.ProjectID, task.CustomFields
+		if input.ProjectID != nil {
+			projectID = nil
+			if *input.ProjectID != 0 {
+				projectID = input.ProjectID
+			}
+			if projectID == nil || task.ProjectID == nil || *projectID != *task.ProjectID {
+				var err error
+				if current, err = workspaceCustomFields(db, current); err != nil {
+					return err
+				}
+			}
+		}
+		customFields, err := resolveCustomFields(db, projectID, current, input.CustomFields)
+		if err != nil {
+			return &taskInputError{"Invalid custom fields", err}
+		}
+		task.ProjectID, task.CustomFields = projectID, customFields
 	}
 
-	if err := DB.Save(&task).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not update task", "details": err.Error()})
-		return
+	if err := db.Save(task).Error; err != nil {
+		return err
 	}
-
-	c.JSON(http.StatusOK, gin.H{"data": task})
+	if input.Tags != nil {
+		tags, err := findOrCreateTags(db, input.Tags)
+		if err != nil {
+			return err
+		}
+		if err := db.Model(task).Association("Tags").Replace(tags); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // GetTaskByID retrieves a single task by ID
+// @Summary Get a task
+// @Description Retrieve a task with its links to other tasks, optionally trimmed to a sparse fieldset and with related records embedded
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param fields query string false "Comma-separated fields to return, e.g. ID,task,dueDate"
+// @Param include query string false "Comma-separated relations to embed" Enums(user,tags,comments,subtasks,checklist,attachments)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id} [get]
 func GetTaskByID(c *gin.Context) {
+	var view TaskView
+	if err := c.ShouldBindQuery(&view); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+	spec, err := view.parse()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+
 	id := c.Param("id")
 	var task Task
-	if err := DB.Where("id = ?", id).First(&task).Error; err != nil {
+	if err := spec.preload(tasksWithUrgency(DB, time.Now())).Where("id = ?", id).First(&task).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 		} else {
@@ -379,5 +713,26 @@ func GetTaskByID(c *gin.Context) {
 		}
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"data": task})
+	links, err := taskLinks(DB, task.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve links", "details": err.Error()})
+		return
+	}
+	task.Links = links
+	for _, link := range links {
+		if link.Type == LinkDuplicates {
+			task.DuplicateOf = &link.TaskID
+		}
+	}
+
+	if len(spec.fields) == 0 {
+		c.JSON(http.StatusOK, gin.H{"data": task})
+		return
+	}
+	item, err := spec.renderOne(&task)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not render task", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": item})
 }
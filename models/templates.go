@@ -0,0 +1,346 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	maxTemplateDepth = 5
+	maxTemplateItems = 200
+)
+
+// placeholderPattern matches {{name}} placeholders, allowing inner spaces
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// TemplateItem is a task blueprint within a template. DueOffsetDays is
+// relative to the start date given when the template is instantiated.
+type TemplateItem struct {
+	Task          string         `json:"task"`
+	Description   string         `json:"description,omitempty"`
+	Priority      TaskPriority   `json:"priority,omitempty"`
+	Category      string         `json:"category,omitempty"`
+	DueOffsetDays *int           `json:"dueOffsetDays,omitempty"`
+	Children      []TemplateItem `json:"children,omitempty"`
+}
+
+type TaskTemplate struct {
+	gorm.Model
+	Name        string         `gorm:"type:varchar(255);not null" json:"name"`
+	Description string         `gorm:"type:text" json:"description"`
+	UserID      uint           `gorm:"index" json:"userId"`
+	Items       []TemplateItem `gorm:"type:text;serializer:json" json:"items"`
+	Variables   []string       `gorm:"-" json:"variables"`
+}
+
+type NewTaskTemplate struct {
+	Name        string         `json:"name" binding:"required"`
+	Description string         `json:"description"`
+	Items       []TemplateItem `json:"items" binding:"required,min=1"`
+}
+
+type InstantiateTemplateRequest struct {
+	// StartDate anchors relative due dates; defaults to today
+	StartDate string            `json:"startDate"`
+	Variables map[string]string `json:"variables"`
+	// UserID receives the tasks; defaults to the caller
+	UserID int `json:"userId"`
+}
+
+// AfterFind fills in the placeholders the template uses
+func (t *TaskTemplate) AfterFind(tx *gorm.DB) error {
+	t.Variables = templateVariables(t.Items)
+	return nil
+}
+
+// validateTemplateItems checks priorities, depth and size of an item tree
+func validateTemplateItems(items []TemplateItem) error {
+	count := 0
+	var walk func(items []TemplateItem, depth int) error
+	walk = func(items []TemplateItem, depth int) error {
+		if depth > maxTemplateDepth {
+			return fmt.Errorf("templates can be nested at most %d levels deep", maxTemplateDepth)
+		}
+		for _, item := range items {
+			count++
+			if count > maxTemplateItems {
+				return fmt.Errorf("templates can contain at most %d tasks", maxTemplateItems)
+			}
+			if strings.TrimSpace(item.Task) == "" {
+				return fmt.Errorf("every template task needs a name")
+			}
+			if item.Priority != "" && !item.Priority.Valid() {
+				return fmt.Errorf("invalid priority %q", item.Priority)
+			}
+			if err := walk(item.Children, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return walk(items, 1)
+}
+
+// templateVariables lists the distinct placeholders used in an item tree
+func templateVariables(items []TemplateItem) []string {
+	seen := make(map[string]bool)
+	var walk func(items []TemplateItem)
+	walk = func(items []TemplateItem) {
+		for _, item := range items {
+			for _, text := range []string{item.Task, item.Description, item.Category} {
+				for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+					seen[match[1]] = true
+				}
+			}
+			walk(item.Children)
+		}
+	}
+	walk(items)
+
+	variables := make([]string, 0, len(seen))
+	for name := range seen {
+		variables = append(variables, name)
+	}
+	sort.Strings(variables)
+	return variables
+}
+
+// substitutePlaceholders replaces {{name}} with its value
+func substitutePlaceholders(text string, variables map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		name := placeholderPattern.FindStringSubmatch(match)[1]
+		return variables[name]
+	})
+}
+
+// CreateTemplate stores a new task template owned by the caller
+// @Summary Create a task template
+// @Description Create a reusable tree of tasks with relative due offsets and {{placeholders}}
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param template body NewTaskTemplate true "Template data"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /templates [post]
+func CreateTemplate(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var input NewTaskTemplate
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+		return
+	}
+	if err := validateTemplateItems(input.Items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template", "details": err.Error()})
+		return
+	}
+
+	template := TaskTemplate{
+		Name:        input.Name,
+		Description: input.Description,
+		UserID:      userID,
+		Items:       input.Items,
+	}
+	if err := DB.Create(&template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create template", "details": err.Error()})
+		return
+	}
+	template.Variables = templateVariables(template.Items)
+
+	c.JSON(http.StatusCreated, gin.H{"data": template})
+}
+
+// GetTemplates lists the caller's templates
+func GetTemplates(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var templates []TaskTemplate
+	if err := DB.Where("user_id = ?", userID).Order("name ASC").Find(&templates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve templates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": templates})
+}
+
+// GetTemplateByID retrieves one of the caller's templates
+func GetTemplateByID(c *gin.Context) {
+	template, ok := findOwnTemplate(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": template})
+}
+
+// DeleteTemplate deletes one of the caller's templates
+func DeleteTemplate(c *gin.Context) {
+	template, ok := findOwnTemplate(c)
+	if !ok {
+		return
+	}
+	if err := DB.Delete(&template).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete template"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": c.Param("id")})
+}
+
+// InstantiateTemplate creates real tasks from a template
+// @Summary Instantiate a task template
+// @Description Create the template's tasks in one transaction, filling in {{placeholders}} and anchoring relative due dates to startDate
+// @Tags templates
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Template ID"
+// @Param request body InstantiateTemplateRequest true "Start date and variables"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Failure 500 {object} map[string]interface{}
+// @Router /templates/{id}/instantiate [post]
+func InstantiateTemplate(c *gin.Context) {
+	template, ok := findOwnTemplate(c)
+	if !ok {
+		return
+	}
+
+	var input InstantiateTemplateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Format", "details": err.Error()})
+		return
+	}
+
+	start := time.Now()
+	start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	if input.StartDate != "" {
+		parsed, err := parseDateParam(input.StartDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date", "details": err.Error()})
+			return
+		}
+		start = parsed
+	}
+
+	variables := map[string]string{"startDate": start.Format("2006-01-02")}
+	for name, value := range input.Variables {
+		variables[name] = value
+	}
+	var missing []string
+	for _, name := range template.Variables {
+		if _, ok := variables[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing template variables", "details": strings.Join(missing, ", ")})
+		return
+	}
+
+	userID := input.UserID
+	if userID == 0 {
+		callerID, _ := currentUserID(c)
+		userID = int(callerID)
+	}
+
+	var created []Task
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var create func(items []TemplateItem, parentID *uint) error
+		create = func(items []TemplateItem, parentID *uint) error {
+			for _, item := range items {
+				// Variables may make a name or category too long for its column
+				task, err := migratedTask(
+					substitutePlaceholders(item.Task, variables),
+					substitutePlaceholders(item.Description, variables),
+					substitutePlaceholders(item.Category, variables),
+				)
+				if err != nil {
+					return &taskInputError{"Invalid template variables", err}
+				}
+				task.Status, task.UserID, task.ParentID = StatusPending, userID, parentID
+				if item.Priority != "" {
+					task.Priority = item.Priority
+				}
+				if item.DueOffsetDays != nil {
+					due := start.AddDate(0, 0, *item.DueOffsetDays)
+					task.DueDate = &due
+				}
+				if err := tx.Create(&task).Error; err != nil {
+					return err
+				}
+				created = append(created, task)
+				if err := create(item.Children, &task.ID); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return create(template.Items, nil)
+	})
+	var invalid *taskInputError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalid.message, "details": invalid.err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not instantiate template", "details": err.Error()})
+		return
+	}
+	callerID, _ := currentUserID(c)
+	for _, task := range created {
+		notifyTaskChanges(DB, callerID, Task{}, task)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": created})
+}
+
+// findOwnTemplate loads the template in the path if it belongs to the caller,
+// writing the error response otherwise
+func findOwnTemplate(c *gin.Context) (TaskTemplate, bool) {
+	var template TaskTemplate
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return template, false
+	}
+	if err := DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&template).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve template"})
+		}
+		return template, false
+	}
+	return template, true
+}
+
+// parseDateParam accepts a calendar date (2006-01-02) or an RFC 3339 timestamp
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected YYYY-MM-DD or RFC 3339, got %q", value)
+	}
+	return t, nil
+}
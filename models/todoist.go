@@ -0,0 +1,254 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// todoistID accepts the numeric IDs of older Todoist exports as well as
+// the string IDs of current ones
+type todoistID string
+
+func (id *todoistID) UnmarshalJSON(data []byte) error {
+	*id = todoistID(strings.Trim(string(data), `"`))
+	if *id == "null" {
+		*id = ""
+	}
+	return nil
+}
+
+// todoistExport is the JSON of a Todoist sync, as written by its API and
+// export tools
+type todoistExport struct {
+	Projects []struct {
+		ID   todoistID `json:"id"`
+		Name string    `json:"name"`
+	} `json:"projects"`
+	Sections []struct {
+		ID   todoistID `json:"id"`
+		Name string    `json:"name"`
+	} `json:"sections"`
+	Items []struct {
+		ID          todoistID `json:"id"`
+		ProjectID   todoistID `json:"project_id"`
+		SectionID   todoistID `json:"section_id"`
+		ParentID    todoistID `json:"parent_id"`
+		Content     string    `json:"content"`
+		Description string    `json:"description"`
+		Priority    int       `json:"priority"`
+		Labels      []string  `json:"labels"`
+		Checked     bool      `json:"checked"`
+		IsDeleted   bool      `json:"is_deleted"`
+		CompletedAt string    `json:"completed_at"`
+		AddedAt     string    `json:"added_at"`
+		Due         *struct {
+			Date string `json:"date"`
+		} `json:"due"`
+	} `json:"items"`
+	Notes []struct {
+		ItemID         todoistID `json:"item_id"`
+		Content        string    `json:"content"`
+		PostedAt       string    `json:"posted_at"`
+		IsDeleted      bool      `json:"is_deleted"`
+		FileAttachment *struct {
+			FileName string `json:"file_name"`
+			FileType string `json:"file_type"`
+			FileSize int64  `json:"file_size"`
+			FileURL  string `json:"file_url"`
+		} `json:"file_attachment"`
+	} `json:"notes"`
+}
+
+// todoistMapped lists the fields of a Todoist export that are imported
+var todoistMapped = map[string]bool{
+	"projects.id": true, "projects.name": true,
+	"sections.id": true, "sections.name": true, "sections.project_id": true,
+	"items.id": true, "items.project_id": true, "items.section_id": true, "items.parent_id": true,
+	"items.content": true, "items.description": true, "items.priority": true, "items.labels": true,
+	"items.checked": true, "items.is_deleted": true, "items.completed_at": true, "items.added_at": true,
+	"items.due.date": true,
+	"labels.name":    true,
+	"notes.id":       true, "notes.item_id": true, "notes.content": true, "notes.posted_at": true, "notes.is_deleted": true,
+	"notes.file_attachment.file_name": true, "notes.file_attachment.file_type": true,
+	"notes.file_attachment.file_size": true, "notes.file_attachment.file_url": true,
+}
+
+// todoistPriorities maps Todoist priorities, where 4 is p1 and 1 means
+// none, onto ours
+var todoistPriorities = map[int]TaskPriority{4: PriorityHigh, 3: PriorityMedium, 2: PriorityLow, 1: PriorityMedium}
+
+// ImportTodoist creates tasks for the caller from a Todoist export
+// @Summary Import from Todoist
+// @Description Upload the JSON of a Todoist sync (with projects, sections, items, labels and notes) as the `file` form field or as the request body. Projects become projects, reusing yours with the same name; sections become categories; items become tasks with their subtasks, labels as tags, due dates and completion; notes become comments and their files attachments. Priorities p1, p2 and p3 become high, medium and low. Items imported before are skipped. The report counts every field that carries data but was not imported under `unmapped`. `dryRun=true` reports without importing.
+// @Tags import
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file false "Todoist JSON export"
+// @Param dryRun query bool false "Report what would be imported without importing it"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /import/todoist [post]
+func ImportTodoist(c *gin.Context) {
+	if _, ok := currentUserID(c); !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	data, err := readImportFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import", "details": err.Error()})
+		return
+	}
+	var export todoistExport
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &export); err == nil {
+		err = json.Unmarshal(data, &document)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Todoist export", "details": err.Error()})
+		return
+	}
+	if export.Items == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Todoist export", "details": "expected an items array"})
+		return
+	}
+	unmapped := map[string]int{}
+	unmappedFields(unmapped, todoistMapped, "", document)
+
+	runMigration(c, unmapped, func(tx *gorm.DB, userID uint, report *MigrationReport) error {
+		sections := make(map[todoistID]string)
+		for _, section := range export.Sections {
+			sections[section.ID] = section.Name
+		}
+		projectNames := make(map[todoistID]string)
+		for _, project := range export.Projects {
+			projectNames[project.ID] = project.Name
+		}
+		projects := make(map[todoistID]uint)
+
+		taskIDs := make(map[todoistID]uint)
+		for index, item := range export.Items {
+			if item.IsDeleted {
+				continue
+			}
+			externalID := "todoist:" + string(item.ID)
+			if exists, err := importedTaskExists(tx, userID, externalID); err != nil {
+				return err
+			} else if exists {
+				report.skip(index, string(item.ID), item.Content, "imported before")
+				continue
+			}
+			task, err := migratedTask(item.Content, item.Description, sections[item.SectionID])
+			if err == nil && item.Due != nil && item.Due.Date != "" {
+				task.DueDate, err = parseTodoistTime(item.Due.Date)
+			}
+			if err != nil {
+				report.invalid(index, string(item.ID), item.Content, err)
+				continue
+			}
+			if priority, ok := todoistPriorities[item.Priority]; ok {
+				task.Priority = priority
+			}
+			if added, err := parseTodoistTime(item.AddedAt); err == nil && added != nil {
+				task.CreatedAt = *added
+			}
+			if item.Checked {
+				completedAt := time.Now()
+				if t, err := parseTodoistTime(item.CompletedAt); err == nil && t != nil {
+					completedAt = *t
+				}
+				task.setStatus(StatusCompleted, completedAt)
+			}
+			if name, ok := projectNames[item.ProjectID]; ok {
+				if _, ok := projects[item.ProjectID]; !ok {
+					project, err := findOrCreateProject(tx, userID, name, "", report)
+					if err != nil {
+						return err
+					}
+					projects[item.ProjectID] = project.ID
+				}
+				projectID := projects[item.ProjectID]
+				task.ProjectID = &projectID
+			}
+			task.UserID = int(userID)
+			task.ExternalID = externalID
+			if err := createImportedTask(tx, &task, item.Labels); err != nil {
+				return err
+			}
+			taskIDs[item.ID] = task.ID
+			report.Imported++
+			report.TaskIDs = append(report.TaskIDs, task.ID)
+		}
+
+		// Parents are set once every item exists, since a subtask may come
+		// before its parent. Items whose parent is their own subtask stay
+		// at the top level.
+		for index, item := range export.Items {
+			taskID, ok := taskIDs[item.ID]
+			parentID, found := taskIDs[item.ParentID]
+			if !ok || !found {
+				continue
+			}
+			cycle, err := isAncestor(tx, parentID, taskID)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				report.invalid(index, string(item.ID), item.Content, fmt.Errorf("parent %s is a subtask of the item; imported without a parent", item.ParentID))
+				continue
+			}
+			if err := tx.Model(&Task{}).Where("id = ?", taskID).UpdateColumn("parent_id", parentID).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, note := range export.Notes {
+			taskID, ok := taskIDs[note.ItemID]
+			if !ok || note.IsDeleted {
+				continue
+			}
+			postedAt, _ := parseTodoistTime(note.PostedAt)
+			if strings.TrimSpace(note.Content) != "" {
+				comment := Comment{TaskID: taskID, UserID: userID, Body: note.Content}
+				if postedAt != nil {
+					comment.CreatedAt = *postedAt
+				}
+				if err := tx.Create(&comment).Error; err != nil {
+					return err
+				}
+				report.Comments++
+			}
+			if file := note.FileAttachment; file != nil && file.FileURL != "" {
+				attachment := Attachment{TaskID: taskID, FileName: file.FileName, ContentType: file.FileType, Size: file.FileSize, URL: file.FileURL}
+				if err := tx.Create(&attachment).Error; err != nil {
+					return err
+				}
+				report.Attachments++
+			}
+		}
+		return nil
+	})
+}
+
+// parseTodoistTime reads the dates of a Todoist export: a day, a floating
+// time, read as UTC, or an RFC 3339 time. Empty values give nil.
+func parseTodoistTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04:05", time.RFC3339} {
+		if t, err := time.Parse(layout, value); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid date %q", value)
+}
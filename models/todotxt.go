@@ -0,0 +1,244 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/KingLeak95/todo-list-go/pkg/todotxt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// todoTxtPriorities maps priorities onto todo.txt letters. Letters after C
+// are read as low.
+var todoTxtPriorities = map[TaskPriority]string{
+	PriorityHigh:   "A",
+	PriorityMedium: "B",
+	PriorityLow:    "C",
+}
+
+// ExportTasksTodoTxt streams the tasks matching the listing filters in the
+// todo.txt format
+// @Summary Export tasks as todo.txt
+// @Description Accepts the filters and sort options of GET /tasks; pagination is ignored. The category becomes a +project, tags become @contexts, and due and defer dates become due: and t: values. Descriptions are not exported.
+// @Tags import
+// @Produce text/plain
+// @Security BearerAuth
+// @Param status query string false "Filter by status" Enums(pending,completed,cancelled)
+// @Param q query string false "Filter expression"
+// @Param sort query string false "Comma-separated sort fields, '-' prefix for descending"
+// @Success 200 {string} string "todo.txt data"
+// @Failure 400 {object} map[string]interface{}
+// @Router /tasks/export.txt [get]
+func ExportTasksTodoTxt(c *gin.Context) {
+	streamTaskExport(c, "text/plain; charset=utf-8", "todo.txt", func(tasks []Task, _ bool) error {
+		lines := make([]todotxt.Task, len(tasks))
+		for i, task := range tasks {
+			lines[i] = taskTodoTxt(task)
+		}
+		return todotxt.Encode(c.Writer, lines)
+	})
+}
+
+// ImportTasksTodoTxt creates tasks for the caller from a todo.txt file
+// @Summary Import tasks from todo.txt
+// @Description Upload a todo.txt file as the `file` form field or as the request body. Each line becomes a task: the first +project becomes the category, @contexts become tags, and due:, t: (defer until) and pri: values are read. Other tokens stay in the task name. Unreadable lines are reported as invalid.
+// @Tags import
+// @Accept multipart/form-data
+// @Accept text/plain
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file false "todo.txt file"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /tasks/import.txt [post]
+func ImportTasksTodoTxt(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	data, err := readImportFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import", "details": err.Error()})
+		return
+	}
+	lines, err := todotxt.Decode(bytes.NewReader(data))
+	if err != nil {
+		if err == bufio.ErrTooLong {
+			err = fmt.Errorf("a line is longer than 1 MB")
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid todo.txt data", "details": err.Error()})
+		return
+	}
+
+	result := newImportResult()
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		for _, line := range lines {
+			// Issues are indexed by line, counting from 0 like other imports
+			index, summary := line.Number-1, line.Task.Text
+			if line.Err != nil {
+				result.invalid(index, "", summary, line.Err)
+				continue
+			}
+			task, tagNames, err := todoTxtTask(line.Task)
+			if err != nil {
+				result.invalid(index, "", summary, err)
+				continue
+			}
+			task.UserID = int(userID)
+			if err := createImportedTask(tx, &task, tagNames); err != nil {
+				return err
+			}
+			result.Imported++
+			result.TaskIDs = append(result.TaskIDs, task.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not import tasks", "details": err.Error()})
+		return
+	}
+	publishCreatedTasks(DB, userID, result.TaskIDs)
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// taskTodoTxt renders a task as a todo.txt line. Completed and cancelled
+// tasks keep their priority as a pri: value, since the format drops it on
+// completion, and cancelled ones are marked with status:cancelled.
+func taskTodoTxt(task Task) todotxt.Task {
+	created := dateOnly(task.CreatedAt)
+	line := todotxt.Task{CreationDate: &created}
+
+	// Lines end the task, so the name is kept on one line, and its words
+	// that look like tokens are escaped so that they are read back as text
+	var words []string
+	for _, word := range strings.Fields(task.Task) {
+		words = append(words, todotxt.Escape(word))
+	}
+	if task.Category != "" {
+		words = append(words, todotxt.Token("+", task.Category))
+	}
+	for _, tag := range task.Tags {
+		words = append(words, todotxt.Token("@", tag.Name))
+	}
+	if task.DueDate != nil {
+		words = append(words, "due:"+task.DueDate.UTC().Format(todotxt.DateLayout))
+	}
+	if task.DeferUntil != nil {
+		words = append(words, "t:"+task.DeferUntil.UTC().Format(todotxt.DateLayout))
+	}
+
+	priority := todoTxtPriorities[task.Priority]
+	if task.Status == StatusPending {
+		line.Priority = priority
+	} else {
+		line.Completed = true
+		completed := task.UpdatedAt
+		if task.CompletedAt != nil {
+			completed = *task.CompletedAt
+		}
+		completed = dateOnly(completed)
+		line.CompletionDate = &completed
+		if priority != "" {
+			words = append(words, "pri:"+priority)
+		}
+		if task.Status == StatusCancelled {
+			words = append(words, "status:cancelled")
+		}
+	}
+	line.Text = strings.Join(words, " ")
+	return line
+}
+
+// todoTxtTask reads a todo.txt line into a task and the names of its tags.
+// The tokens it maps onto fields are removed from the name.
+func todoTxtTask(line todotxt.Task) (Task, []string, error) {
+	task := Task{Priority: todoTxtPriority(line.Priority)}
+
+	status := StatusPending
+	if line.Completed {
+		status = StatusCompleted
+	}
+	var name, tagNames []string
+	for _, word := range strings.Fields(line.Text) {
+		if text, ok := todotxt.Unescape(word); ok {
+			name = append(name, text)
+			continue
+		}
+		if project, ok := todotxt.Project(word); ok && task.Category == "" {
+			task.Category = project
+			continue
+		}
+		if context, ok := todotxt.Context(word); ok {
+			tagNames = append(tagNames, context)
+			continue
+		}
+		key, value, ok := todotxt.KeyValue(word)
+		switch {
+		case !ok:
+			name = append(name, word)
+		case key == "due" || key == "t":
+			date, err := time.Parse(todotxt.DateLayout, value)
+			if err != nil {
+				return task, nil, fmt.Errorf("invalid %s: date %q", key, value)
+			}
+			if key == "due" {
+				task.DueDate = &date
+			} else {
+				task.DeferUntil = &date
+			}
+		case key == "pri" && line.Completed && len(value) == 1 && value >= "A" && value <= "Z":
+			task.Priority = todoTxtPriority(value)
+		case key == "status" && value == "cancelled" && line.Completed:
+			status = StatusCancelled
+		default:
+			name = append(name, word)
+		}
+	}
+
+	task.Task = strings.Join(name, " ")
+	if task.Task == "" {
+		return task, nil, fmt.Errorf("task has no name besides its tokens")
+	}
+	if utf8.RuneCountInString(task.Task) > 255 {
+		return task, nil, fmt.Errorf("task is longer than 255 characters")
+	}
+	if utf8.RuneCountInString(task.Category) > 100 {
+		return task, nil, fmt.Errorf("project %q is longer than 100 characters", task.Category)
+	}
+
+	now := time.Now()
+	if line.CreationDate != nil {
+		task.CreatedAt = *line.CreationDate
+	}
+	task.setStatus(status, now)
+	if status == StatusCompleted && line.CompletionDate != nil {
+		completedAt := *line.CompletionDate
+		task.CompletedAt = &completedAt
+	}
+	return task, tagNames, nil
+}
+
+// todoTxtPriority reads a priority letter; tasks without one are medium
+func todoTxtPriority(letter string) TaskPriority {
+	switch letter {
+	case "", "B":
+		return PriorityMedium
+	case "A":
+		return PriorityHigh
+	}
+	return PriorityLow
+}
+
+// dateOnly returns the UTC calendar day of a time
+func dateOnly(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
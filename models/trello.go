@@ -0,0 +1,242 @@
+package models
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// trelloBoard is the JSON export of a Trello board
+type trelloBoard struct {
+	Name  string `json:"name"`
+	Desc  string `json:"desc"`
+	Lists []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"lists"`
+	Cards []struct {
+		ID          string     `json:"id"`
+		Name        string     `json:"name"`
+		Desc        string     `json:"desc"`
+		IDList      string     `json:"idList"`
+		Closed      bool       `json:"closed"`
+		Start       *time.Time `json:"start"`
+		Due         *time.Time `json:"due"`
+		DueComplete bool       `json:"dueComplete"`
+		Labels      []struct {
+			Name  string `json:"name"`
+			Color string `json:"color"`
+		} `json:"labels"`
+		Attachments []struct {
+			Name     string `json:"name"`
+			URL      string `json:"url"`
+			MimeType string `json:"mimeType"`
+			Bytes    int64  `json:"bytes"`
+		} `json:"attachments"`
+	} `json:"cards"`
+	Checklists []struct {
+		Name       string `json:"name"`
+		IDCard     string `json:"idCard"`
+		CheckItems []struct {
+			Name  string  `json:"name"`
+			State string  `json:"state"`
+			Pos   float64 `json:"pos"`
+		} `json:"checkItems"`
+	} `json:"checklists"`
+	Actions []trelloAction `json:"actions"`
+}
+
+type trelloAction struct {
+	Type string    `json:"type"`
+	Date time.Time `json:"date"`
+	Data struct {
+		Text string `json:"text"`
+		Card struct {
+			ID string `json:"id"`
+		} `json:"card"`
+	} `json:"data"`
+}
+
+// trelloMapped lists the fields of a board export that are imported. Of
+// the actions, only comments are.
+var trelloMapped = map[string]bool{
+	"id": true, "name": true, "desc": true,
+	"lists.id": true, "lists.name": true,
+	"cards.id": true, "cards.name": true, "cards.desc": true, "cards.idList": true, "cards.idBoard": true,
+	"cards.closed": true, "cards.start": true, "cards.due": true, "cards.dueComplete": true,
+	"cards.idLabels": true, "cards.labels.id": true, "cards.labels.idBoard": true, "cards.labels.name": true, "cards.labels.color": true,
+	"cards.idChecklists": true, "cards.attachments.id": true, "cards.attachments.name": true,
+	"cards.attachments.url": true, "cards.attachments.mimeType": true, "cards.attachments.bytes": true,
+	"labels.id": true, "labels.idBoard": true, "labels.name": true, "labels.color": true,
+	"checklists.id": true, "checklists.idBoard": true, "checklists.idCard": true, "checklists.name": true,
+	"checklists.checkItems.id": true, "checklists.checkItems.idChecklist": true, "checklists.checkItems.name": true,
+	"checklists.checkItems.state": true, "checklists.checkItems.pos": true,
+	"actions.id": true, "actions.type": true, "actions.date": true, "actions.data.text": true, "actions.data.card.id": true,
+}
+
+// ImportTrello creates tasks for the caller from a Trello board export
+// @Summary Import from Trello
+// @Description Upload the JSON export of a Trello board as the `file` form field or as the request body. The board becomes a project, reusing yours with the same name; lists become categories; cards become tasks with their labels as tags (unnamed labels by color), start and due dates, and completion; checklists become checklist items, attachments are linked, and comment actions become comments. Archived cards are imported archived. Cards imported before are skipped. The report counts every field that carries data but was not imported under `unmapped`, with other actions counted by type. `dryRun=true` reports without importing.
+// @Tags import
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param file formData file false "Trello board JSON export"
+// @Param dryRun query bool false "Report what would be imported without importing it"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /import/trello [post]
+func ImportTrello(c *gin.Context) {
+	if _, ok := currentUserID(c); !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	data, err := readImportFile(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import", "details": err.Error()})
+		return
+	}
+	var board trelloBoard
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &board); err == nil {
+		err = json.Unmarshal(data, &document)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Trello export", "details": err.Error()})
+		return
+	}
+	if board.Name == "" || board.Cards == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Trello export", "details": "expected a board with a name and cards"})
+		return
+	}
+
+	// Actions other than comments are reported by type rather than field.
+	// Each action is classified by its own type: the document may hold
+	// keys that differ only in case, so it need not line up with the board.
+	unmapped := map[string]int{}
+	if actions, ok := document["actions"].([]interface{}); ok {
+		comments := actions[:0:0]
+		for _, action := range actions {
+			fields, _ := action.(map[string]interface{})
+			actionType, _ := fields["type"].(string)
+			if actionType == "commentCard" {
+				comments = append(comments, action)
+			} else {
+				unmapped["actions["+actionType+"]"]++
+			}
+		}
+		document["actions"] = comments
+	}
+	unmappedFields(unmapped, trelloMapped, "", document)
+
+	runMigration(c, unmapped, func(tx *gorm.DB, userID uint, report *MigrationReport) error {
+		project, err := findOrCreateProject(tx, userID, board.Name, board.Desc, report)
+		if err != nil {
+			return err
+		}
+		lists := make(map[string]string)
+		for _, list := range board.Lists {
+			lists[list.ID] = list.Name
+		}
+
+		now := time.Now()
+		taskIDs := make(map[string]uint)
+		for index, card := range board.Cards {
+			externalID := "trello:" + card.ID
+			if exists, err := importedTaskExists(tx, userID, externalID); err != nil {
+				return err
+			} else if exists {
+				report.skip(index, card.ID, card.Name, "imported before")
+				continue
+			}
+			task, err := migratedTask(card.Name, card.Desc, lists[card.IDList])
+			if err != nil {
+				report.invalid(index, card.ID, card.Name, err)
+				continue
+			}
+			task.DueDate, task.DeferUntil = card.Due, card.Start
+			if card.DueComplete {
+				task.setStatus(StatusCompleted, now)
+			}
+			if card.Closed {
+				task.ArchivedAt = &now
+			}
+			var tagNames []string
+			for _, label := range card.Labels {
+				if label.Name != "" {
+					tagNames = append(tagNames, label.Name)
+				} else if label.Color != "" {
+					tagNames = append(tagNames, label.Color)
+				}
+			}
+			task.UserID = int(userID)
+			task.ProjectID = &project.ID
+			task.ExternalID = externalID
+			if err := createImportedTask(tx, &task, tagNames); err != nil {
+				return err
+			}
+			taskIDs[card.ID] = task.ID
+			report.Imported++
+			report.TaskIDs = append(report.TaskIDs, task.ID)
+
+			for _, file := range card.Attachments {
+				if file.URL == "" {
+					continue
+				}
+				attachment := Attachment{TaskID: task.ID, FileName: file.Name, ContentType: file.MimeType, Size: file.Bytes, URL: file.URL}
+				if err := tx.Create(&attachment).Error; err != nil {
+					return err
+				}
+				report.Attachments++
+			}
+		}
+
+		// Cards with several checklists get one list, with the items of each
+		// prefixed by its name
+		checklistCount := make(map[string]int)
+		for _, checklist := range board.Checklists {
+			checklistCount[checklist.IDCard]++
+		}
+		positions := make(map[string]int)
+		for _, checklist := range board.Checklists {
+			taskID, ok := taskIDs[checklist.IDCard]
+			if !ok {
+				continue
+			}
+			items := checklist.CheckItems
+			sort.SliceStable(items, func(i, j int) bool { return items[i].Pos < items[j].Pos })
+			for _, checkItem := range items {
+				text := checkItem.Name
+				if checklistCount[checklist.IDCard] > 1 {
+					text = checklist.Name + ": " + text
+				}
+				item := ChecklistItem{TaskID: taskID, Text: truncateRunes(text, 500), Done: checkItem.State == "complete", Position: positions[checklist.IDCard]}
+				if err := tx.Create(&item).Error; err != nil {
+					return err
+				}
+				positions[checklist.IDCard]++
+				report.ChecklistItems++
+			}
+		}
+
+		for _, action := range board.Actions {
+			taskID, ok := taskIDs[action.Data.Card.ID]
+			if action.Type != "commentCard" || !ok || action.Data.Text == "" {
+				continue
+			}
+			comment := Comment{TaskID: taskID, UserID: userID, Body: action.Data.Text}
+			comment.CreatedAt = action.Date
+			if err := tx.Create(&comment).Error; err != nil {
+				return err
+			}
+			report.Comments++
+		}
+		return nil
+	})
+}
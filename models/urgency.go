@@ -0,0 +1,92 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UrgencyWeights scales the components of a task's urgency score. Each
+// component lies between 0 and 1 before weighting.
+type UrgencyWeights struct {
+	// Priority: high 1, medium 0.65, low 0.3
+	Priority float64
+	// Due rises from 0.2 for tasks due in two weeks or more to 1 for tasks
+	// a week overdue; tasks without a due date score 0
+	Due float64
+	// Age grows linearly over the first year after creation
+	Age float64
+	// Blocked applies to tasks with a pending blocker, so it is normally
+	// negative
+	Blocked float64
+}
+
+// DefaultUrgencyWeights rank due dates above priority, and push blocked
+// tasks down
+var DefaultUrgencyWeights = UrgencyWeights{Priority: 6, Due: 12, Age: 2, Blocked: -5}
+
+// urgencyWeights are the weights in use, overridable with the
+// URGENCY_WEIGHT_PRIORITY, URGENCY_WEIGHT_DUE, URGENCY_WEIGHT_AGE and
+// URGENCY_WEIGHT_BLOCKED environment variables
+var urgencyWeights = UrgencyWeights{
+	Priority: getEnvFloat("URGENCY_WEIGHT_PRIORITY", DefaultUrgencyWeights.Priority),
+	Due:      getEnvFloat("URGENCY_WEIGHT_DUE", DefaultUrgencyWeights.Due),
+	Age:      getEnvFloat("URGENCY_WEIGHT_AGE", DefaultUrgencyWeights.Age),
+	Blocked:  getEnvFloat("URGENCY_WEIGHT_BLOCKED", DefaultUrgencyWeights.Blocked),
+}
+
+// urgencyExpr renders the urgency score as SQL. The returned arguments bind
+// the reference time, which is the start of the current UTC day so that
+// scores, and cursors built from them, stay stable for the day.
+func urgencyExpr(db *gorm.DB, w UrgencyWeights, now time.Time) (string, []interface{}) {
+	today := now.UTC().Truncate(24 * time.Hour)
+	var daysUntilDue, ageDays string
+	if db.Dialector.Name() == "postgres" {
+		daysUntilDue = "(EXTRACT(EPOCH FROM (due_date - CAST(? AS TIMESTAMPTZ))) / 86400)"
+		ageDays = "(EXTRACT(EPOCH FROM (CAST(? AS TIMESTAMPTZ) - created_at)) / 86400)"
+	} else {
+		daysUntilDue = "(JULIANDAY(due_date) - JULIANDAY(?))"
+		ageDays = "(JULIANDAY(?) - JULIANDAY(created_at))"
+	}
+
+	priority := "(CASE priority WHEN 'high' THEN 1.0 WHEN 'medium' THEN 0.65 WHEN 'low' THEN 0.3 ELSE 0.0 END)"
+	due := fmt.Sprintf("(CASE WHEN due_date IS NULL THEN 0.0 WHEN %[1]s <= -7 THEN 1.0 WHEN %[1]s >= 14 THEN 0.2 "+
+		"ELSE 0.2 + (14 - %[1]s) * 0.8 / 21 END)", daysUntilDue)
+	age := fmt.Sprintf("(CASE WHEN %[1]s >= 365 THEN 1.0 WHEN %[1]s <= 0 THEN 0.0 ELSE %[1]s / 365 END)", ageDays)
+
+	expr := fmt.Sprintf("(%g * %s + %g * %s + %g * %s + %g * %s)",
+		w.Priority, priority, w.Due, due, w.Age, age, w.Blocked, blockedExpr)
+	args := make([]interface{}, strings.Count(expr, "?"))
+	for i := range args {
+		args[i] = today
+	}
+	return expr, args
+}
+
+// blockedExpr is 1 for tasks with a pending blocker and 0 otherwise
+const blockedExpr = "(CASE WHEN " + blockedCondition + " THEN 1 ELSE 0 END)"
+
+// tasksWithUrgency selects tasks with their computed urgency and blocked
+// columns, through a derived table still named tasks so that filters and
+// sort keys can refer to the computed columns like any other
+func tasksWithUrgency(db *gorm.DB, now time.Time) *gorm.DB {
+	urgency, args := urgencyExpr(db, urgencyWeights, now)
+	inner := db.Model(&Task{}).Select("tasks.*, "+urgency+" AS urgency, "+blockedExpr+" AS blocked", args...)
+	return db.Model(&Task{}).Table("(?) AS tasks", inner)
+}
+
+// getEnvFloat reads a finite number from the environment. Weights are
+// formatted into SQL, where NaN and Inf are not valid literals.
+func getEnvFloat(key string, fallback float64) float64 {
+	if valueStr, ok := os.LookupEnv(key); ok {
+		if value, err := strconv.ParseFloat(valueStr, 64); err == nil && !math.IsNaN(value) && !math.IsInf(value, 0) {
+			return value
+		}
+	}
+	return fallback
+}
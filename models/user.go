@@ -11,17 +11,29 @@ import (
 
 type User struct {
 	gorm.Model
-	Name     string `gorm:"not null" json:"name"`
-	Email    string `gorm:"unique; not null" json:"email"`
-	Password string `gorm:"not null" json:"-"` // Hidden from JSON
-	Role     string `gorm:"default:'user'" json:"role"`
-	Tasks    []Task `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"tasks,omitempty"`
+	Name     string  `gorm:"not null" json:"name"`
+	Email    string  `gorm:"unique; not null" json:"email"`
+	Handle   *string `gorm:"type:varchar(32);uniqueIndex" json:"handle,omitempty"` // Lower-cased, for @mentions
+	Password string  `gorm:"not null" json:"-"`                                    // Hidden from JSON
+	Role     string  `gorm:"default:'user'" json:"role"`
+	Tasks    []Task  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;" json:"tasks,omitempty"`
 }
 
 type NewUser struct {
 	Name     string `json:"name" binding:"required,min=3"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required,min=6"`
+	// Handle lets other users @mention this user
+	Handle string `json:"handle,omitempty" binding:"omitempty,alphanum,min=2,max=32"`
+}
+
+// handle returns the lower-cased handle, or nil when none was chosen
+func (u NewUser) handle() *string {
+	if u.Handle == "" {
+		return nil
+	}
+	handle := strings.ToLower(u.Handle)
+	return &handle
 }
 
 type LoginRequest struct {
@@ -58,6 +70,7 @@ func CreateUser(c *gin.Context) {
 		Email:    input.Email,
 		Password: hashedPassword,
 		Role:     "user", // Default role
+		Handle:   input.handle(),
 	}
 
 	result := DB.Create(&newUser)
@@ -65,7 +78,7 @@ func CreateUser(c *gin.Context) {
 	if result.Error != nil {
 		// Check for duplicate email error
 		if strings.Contains(result.Error.Error(), "Duplicate") || strings.Contains(result.Error.Error(), "duplicate") {
-			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+			c.JSON(http.StatusConflict, gin.H{"error": "Email or handle already exists"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create user"})
 		}
@@ -139,12 +152,13 @@ func Register(c *gin.Context) {
 		Email:    input.Email,
 		Password: hashedPassword,
 		Role:     "user",
+		Handle:   input.handle(),
 	}
 
 	result := DB.Create(&newUser)
 	if result.Error != nil {
 		if strings.Contains(result.Error.Error(), "Duplicate") || strings.Contains(result.Error.Error(), "duplicate") {
-			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+			c.JSON(http.StatusConflict, gin.H{"error": "Email or handle already exists"})
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create user"})
 		}
@@ -242,3 +256,13 @@ func RefreshToken(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"data": gin.H{"access_token": newAccessToken}})
 }
+
+// currentUserID returns the ID of the authenticated user set by AuthMiddleware
+func currentUserID(c *gin.Context) (uint, bool) {
+	value, exists := c.Get("user_id")
+	if !exists {
+		return 0, false
+	}
+	userID, ok := value.(uint)
+	return userID, ok
+}
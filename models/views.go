@@ -0,0 +1,152 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MatrixQuery selects the tasks of the Eisenhower matrix. All TaskQuery
+// filters apply, `limit` caps each quadrant and only pending tasks are
+// shown unless `status` says otherwise.
+type MatrixQuery struct {
+	TaskQuery
+	// UrgentWithinDays marks tasks due within this many days, or overdue,
+	// as urgent
+	UrgentWithinDays int `form:"urgentWithinDays,default=2"`
+}
+
+// matrixQuadrants are the Eisenhower quadrants in display order. Important
+// tasks have high priority.
+var matrixQuadrants = []struct {
+	name      string
+	important bool
+	urgent    bool
+}{
+	{"do", true, true},
+	{"schedule", true, false},
+	{"delegate", false, true},
+	{"eliminate", false, false},
+}
+
+// GetMatrixView buckets tasks into the four important/urgent quadrants
+// @Summary Eisenhower matrix
+// @Description Buckets tasks into do (important and urgent), schedule (important), delegate (urgent) and eliminate. Important tasks have high priority; urgent tasks are due within urgentWithinDays or overdue. Each quadrant is sorted by urgency.
+// @Tags views
+// @Produce json
+// @Param urgentWithinDays query int false "Days ahead that count as urgent" default(2)
+// @Param limit query int false "Tasks per quadrant" default(10)
+// @Param userId query int false "Filter by user ID"
+// @Param category query string false "Filter by category"
+// @Param q query string false "Filter expression"
+// @Param fields query string false "Comma-separated fields to return"
+// @Param include query string false "Comma-separated relations to embed"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /views/matrix [get]
+func GetMatrixView(c *gin.Context) {
+	var query MatrixQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+	if query.Limit <= 0 || query.Limit > 100 {
+		query.Limit = 10
+	}
+	if query.Status == nil {
+		pending := StatusPending
+		query.Status = &pending
+	}
+	view, err := query.TaskView.parse()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	base, err := applyTaskFilters(tasksWithUrgency(DB, now), query.TaskQuery)
+	if err != nil {
+		respondFilterError(c, err)
+		return
+	}
+	horizon := now.AddDate(0, 0, query.UrgentWithinDays)
+
+	data := gin.H{}
+	for _, quadrant := range matrixQuadrants {
+		q := base.Session(&gorm.Session{})
+		if quadrant.important {
+			q = q.Where("priority = ?", PriorityHigh)
+		} else {
+			q = q.Where("priority <> ?", PriorityHigh)
+		}
+		if quadrant.urgent {
+			q = q.Where("due_date IS NOT NULL AND due_date < ?", horizon)
+		} else {
+			q = q.Where("(due_date IS NULL OR due_date >= ?)", horizon)
+		}
+
+		var total int64
+		if err := q.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve tasks", "details": err.Error()})
+			return
+		}
+		var tasks []Task
+		if err := view.preload(q).Order("urgency DESC, id ASC").Limit(query.Limit).Find(&tasks).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve tasks", "details": err.Error()})
+			return
+		}
+		rendered, err := view.render(tasks)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not render tasks", "details": err.Error()})
+			return
+		}
+		data[quadrant.name] = gin.H{"tasks": rendered, "total": total}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
+
+// GetInboxView lists the tasks that need attention: pending tasks not yet
+// triaged with a category or due date, and snoozed tasks whose defer time
+// has passed. Resurfaced tasks come first and stay until they are
+// unsnoozed, snoozed again or completed.
+// @Summary Inbox
+// @Description Untriaged and resurfaced tasks, for the caller unless userId is given. Supports the usual filters, sorting and pagination.
+// @Tags views
+// @Produce json
+// @Param userId query int false "Filter by user ID, defaults to the caller"
+// @Param limit query int false "Items per page" default(10)
+// @Param sort query string false "Sort fields" default(-deferUntil,-createdAt)
+// @Param after query string false "Cursor: return tasks after this position"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]interface{}
+// @Router /views/inbox [get]
+func GetInboxView(c *gin.Context) {
+	var query TaskQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+		return
+	}
+	if query.UserID == nil {
+		if callerID, ok := currentUserID(c); ok {
+			userID := int(callerID)
+			query.UserID = &userID
+		}
+	}
+	if query.Status == nil {
+		pending := StatusPending
+		query.Status = &pending
+	}
+	if query.Sort == "" {
+		query.Sort = "-deferUntil,-createdAt"
+	}
+	// Tasks still snoozed never show; those past their defer time resurface
+	query.Deferred = false
+	query.scopes = append(query.scopes, func(db *gorm.DB) *gorm.DB {
+		return db.Where("(defer_until IS NOT NULL OR (COALESCE(category, '') = '' AND due_date IS NULL))")
+	})
+
+	listTasks(c, query)
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TaskWatcher subscribes a user to a task's notifications. Users watch the
+// tasks they create or are assigned automatically.
+type TaskWatcher struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	TaskID    uint      `gorm:"uniqueIndex:idx_task_watcher" json:"taskId"`
+	UserID    uint      `gorm:"uniqueIndex:idx_task_watcher;index" json:"userId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// GetTaskWatchers lists the users watching a task
+// @Summary List a task's watchers
+// @Tags tasks
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id}/watchers [get]
+func GetTaskWatchers(c *gin.Context) {
+	task, ok := findTask(c)
+	if !ok {
+		return
+	}
+	var users []User
+	err := DB.Where("id IN (?)", DB.Model(&TaskWatcher{}).Select("user_id").Where("task_id = ?", task.ID)).
+		Order("id ASC").Find(&users).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve watchers"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": users})
+}
+
+// WatchTask subscribes the caller to a task
+// @Summary Watch a task
+// @Tags tasks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 404 {object} map[string]interface{}
+// @Router /tasks/{id}/watch [post]
+func WatchTask(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	task, ok := findTask(c)
+	if !ok {
+		return
+	}
+	if err := watchTask(DB, task.ID, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not watch task", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"taskId": task.ID, "watching": true}})
+}
+
+// UnwatchTask unsubscribes the caller from a task
+// @Summary Stop watching a task
+// @Tags tasks
+// @Produce json
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Router /tasks/{id}/watch [delete]
+func UnwatchTask(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	if err := DB.Where("task_id = ? AND user_id = ?", c.Param("id"), userID).Delete(&TaskWatcher{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not unwatch task"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"taskId": c.Param("id"), "watching": false}})
+}
+
+// watchTask subscribes a user to a task if they are not already watching it
+func watchTask(db *gorm.DB, taskID, userID uint) error {
+	watcher := TaskWatcher{TaskID: taskID, UserID: userID}
+	return db.Where(watcher).FirstOrCreate(&watcher).Error
+}
+
+// taskWatchers returns the IDs of the users watching a task
+func taskWatchers(db *gorm.DB, taskID uint) ([]uint, error) {
+	var userIDs []uint
+	err := db.Model(&TaskWatcher{}).Where("task_id = ?", taskID).Order("user_id ASC").Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
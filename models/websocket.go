@@ -0,0 +1,381 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KingLeak95/todo-list-go/pkg/events"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gorilla/websocket"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+// Limits of each socket connection
+const (
+	socketMaxMessageBytes = 64 << 10
+	socketMaxTopics       = 50
+	// socketOutboxSize is how many replies may wait to be written before
+	// the connection stops reading requests
+	socketOutboxSize = 16
+	socketWriteWait  = 10 * time.Second
+	socketPongWait   = 60 * time.Second
+	socketPingPeriod = socketPongWait * 9 / 10
+)
+
+// socketConnections counts the open sockets of each user
+var socketConnections = newConnectionCounter()
+
+var socketUpgrader = websocket.Upgrader{ReadBufferSize: 4096, WriteBufferSize: 4096}
+
+// SocketRequest is a message from a client. Task holds a NewTask for
+// create and an UpdateTaskRequest for update.
+type SocketRequest struct {
+	// ID is echoed in the acknowledgement
+	ID     string          `json:"id"`
+	Type   string          `json:"type" enums:"subscribe,unsubscribe,create,update,complete"`
+	Topic  string          `json:"topic,omitempty"`
+	TaskID uint            `json:"taskId,omitempty"`
+	Task   json.RawMessage `json:"task,omitempty" swaggertype:"object"`
+}
+
+// SocketAck answers a request with the status and body the equivalent
+// HTTP request would have
+type SocketAck struct {
+	Type    string      `json:"type"`
+	ID      string      `json:"id"`
+	OK      bool        `json:"ok"`
+	Status  int         `json:"status"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	Details string      `json:"details,omitempty"`
+}
+
+// SocketEvent carries a task event to the subscribers of a matching topic
+type SocketEvent struct {
+	Type  string    `json:"type"`
+	Event TaskEvent `json:"event"`
+}
+
+// socketTopic selects the tasks whose events a connection receives: all
+// of them ("tasks"), or those of one task, project, assignee or category
+type socketTopic struct {
+	kind string
+	id   uint
+	name string
+}
+
+func parseSocketTopic(topic string) (socketTopic, error) {
+	if topic == "tasks" {
+		return socketTopic{kind: topic}, nil
+	}
+	kind, value, found := strings.Cut(topic, ":")
+	if !found || value == "" {
+		return socketTopic{}, fmt.Errorf("unknown topic %q, expected tasks, task:<id>, project:<id>, user:<id> or category:<name>", topic)
+	}
+	switch kind {
+	case "category":
+		return socketTopic{kind: kind, name: value}, nil
+	case "task", "project", "user":
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return socketTopic{}, fmt.Errorf("invalid %s ID %q", kind, value)
+		}
+		return socketTopic{kind: kind, id: uint(id)}, nil
+	}
+	return socketTopic{}, fmt.Errorf("unknown topic %q, expected tasks, task:<id>, project:<id>, user:<id> or category:<name>", topic)
+}
+
+func (t socketTopic) matches(task Task) bool {
+	switch t.kind {
+	case "tasks":
+		return true
+	case "task":
+		return task.ID == t.id
+	case "project":
+		return task.ProjectID != nil && *task.ProjectID == t.id
+	case "user":
+		return task.UserID == int(t.id)
+	case "category":
+		return task.Category == t.name
+	}
+	return false
+}
+
+// socketSession is the state of one connection
+type socketSession struct {
+	userID  uint
+	limiter *rate.Limiter
+
+	mu     sync.Mutex
+	topics map[string]socketTopic
+}
+
+func (s *socketSession) wants(task Task) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, topic := range s.topics {
+		if topic.matches(task) {
+			return true
+		}
+	}
+	return false
+}
+
+// Socket upgrades to a WebSocket over which the caller receives task events
+// and sends task changes
+// @Summary Task WebSocket
+// @Description Upgrades to a WebSocket authenticated like the rest of the API. Clients send JSON requests (see SocketRequest) with an `id` that the `ack` reply echoes with the HTTP status and body of the equivalent request: `subscribe` and `unsubscribe` to a `topic` (tasks, task:<id>, project:<id>, user:<id> or category:<name>), `create` with a task, `update` with a `taskId` and changes, and `complete` with a `taskId`. Events for subscribed topics arrive as `{"type":"event","event":{...}}` with the same data as GET /events. `topics` subscribes on connect, and with `lastEventId` missed events are replayed, or a `reset` message is sent when they no longer can be. Requests are rate limited per connection, and a connection that falls behind on events is closed with code 1013 so the client resumes.
+// @Tags events
+// @Security BearerAuth
+// @Param topics query string false "Comma-separated topics to subscribe to on connect"
+// @Param lastEventId query string false "Replay the events of those topics after this one"
+// @Success 101 {string} string "Switching Protocols"
+// @Failure 400 {object} map[string]interface{}
+// @Failure 401 {object} map[string]interface{}
+// @Failure 429 {object} map[string]interface{}
+// @Router /ws [get]
+func Socket(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	perSecond := getEnvInt("WS_MESSAGES_PER_SECOND", 20)
+	session := &socketSession{
+		userID:  userID,
+		limiter: rate.NewLimiter(rate.Limit(perSecond), 2*perSecond),
+		topics:  make(map[string]socketTopic),
+	}
+	if value := c.Query("topics"); value != "" {
+		for _, name := range strings.Split(value, ",") {
+			topic, err := parseSocketTopic(strings.TrimSpace(name))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": err.Error()})
+				return
+			}
+			session.topics[strings.TrimSpace(name)] = topic
+		}
+	}
+	lastEventID := c.Query("lastEventId")
+	after, err := strconv.ParseUint(lastEventID, 10, 64)
+	if err != nil && lastEventID != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters", "details": fmt.Sprintf("invalid event ID %q", lastEventID)})
+		return
+	}
+
+	if max := getEnvInt("WS_CONNECTIONS_PER_USER", 5); !socketConnections.open(userID, max) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many connections", "details": fmt.Sprintf("at most %d sockets may be open per user", max)})
+		return
+	}
+	defer socketConnections.close(userID)
+
+	conn, err := socketUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		return
+	}
+	defer conn.Close()
+	sub, replay, complete := taskEvents.Subscribe(eventSubscriberBuffer, lastEventID != "", after)
+	defer sub.Close()
+
+	outbox := make(chan interface{}, socketOutboxSize)
+	done, stopped := make(chan struct{}), make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(stopped)
+		session.write(conn, outbox, sub, done)
+	}()
+	// A full outbox blocks reading, so clients that do not read their
+	// replies are slowed down rather than buffered without bound
+	send := func(message interface{}) bool {
+		select {
+		case outbox <- message:
+			return true
+		case <-stopped:
+			return false
+		}
+	}
+
+	if !complete && !send(gin.H{"type": "reset"}) {
+		return
+	}
+	for _, event := range replay {
+		if message, ok := session.event(event); ok && !send(message) {
+			return
+		}
+	}
+
+	conn.SetReadLimit(socketMaxMessageBytes)
+	conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+	for {
+		var request SocketRequest
+		if err := conn.ReadJSON(&request); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+				return
+			}
+			request = SocketRequest{Type: "invalid"}
+		}
+		if !send(session.handle(request)) {
+			return
+		}
+	}
+}
+
+// write sends the replies and subscribed events of a connection, and pings
+// it. It is the only writer of the connection.
+func (s *socketSession) write(conn *websocket.Conn, outbox <-chan interface{}, sub *events.Subscription, done <-chan struct{}) {
+	ping := time.NewTicker(socketPingPeriod)
+	defer ping.Stop()
+	// Closing the connection ends the reader too
+	defer conn.Close()
+	for {
+		var message interface{}
+		select {
+		case <-done:
+			return
+		case message = <-outbox:
+		case event, ok := <-sub.C:
+			if !ok {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// The broker dropped the subscription; the client resumes
+				// from its last event
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind, resume with lastEventId"), time.Now().Add(socketWriteWait))
+				return
+			}
+			if message, ok = s.event(event); !ok {
+				continue
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait)); err != nil {
+				return
+			}
+			continue
+		}
+		conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+		if err := conn.WriteJSON(message); err != nil {
+			return
+		}
+	}
+}
+
+// event returns the message for an event, if the session subscribes to it
+func (s *socketSession) event(event events.Event) (SocketEvent, bool) {
+	data, ok := event.Data.(TaskEvent)
+	if !ok || !s.wants(data.Task) {
+		return SocketEvent{}, false
+	}
+	data.ID = event.ID
+	return SocketEvent{Type: "event", Event: data}, true
+}
+
+// handle runs a request and returns its acknowledgement
+func (s *socketSession) handle(request SocketRequest) SocketAck {
+	ack := func(status int, data interface{}) SocketAck {
+		return SocketAck{Type: "ack", ID: request.ID, OK: true, Status: status, Data: data}
+	}
+	fail := func(status int, message string, err error) SocketAck {
+		failure := SocketAck{Type: "ack", ID: request.ID, Status: status, Error: message}
+		if err != nil {
+			failure.Details = err.Error()
+		}
+		return failure
+	}
+	if !s.limiter.Allow() {
+		return fail(http.StatusTooManyRequests, "Rate limit exceeded", nil)
+	}
+
+	switch request.Type {
+	case "subscribe":
+		topic, err := parseSocketTopic(request.Topic)
+		if err != nil {
+			return fail(http.StatusBadRequest, "Invalid topic", err)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.topics[request.Topic]; !ok && len(s.topics) >= socketMaxTopics {
+			return fail(http.StatusBadRequest, "Too many subscriptions", fmt.Errorf("at most %d topics may be subscribed per connection", socketMaxTopics))
+		}
+		s.topics[request.Topic] = topic
+		return ack(http.StatusOK, gin.H{"topic": request.Topic})
+	case "unsubscribe":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.topics, request.Topic)
+		return ack(http.StatusOK, gin.H{"topic": request.Topic})
+	case "create":
+		var input NewTask
+		if err := decodeSocketInput(request.Task, &input); err != nil {
+			return fail(http.StatusBadRequest, "Invalid Format", err)
+		}
+		task, err := newTask(DB, input)
+		var invalid *taskInputError
+		if errors.As(err, &invalid) {
+			return fail(http.StatusBadRequest, invalid.message, invalid.err)
+		}
+		if err != nil {
+			return fail(http.StatusInternalServerError, "Could not create tags", err)
+		}
+		if err := DB.Create(&task).Error; err != nil {
+			return fail(http.StatusInternalServerError, "Could not create task", err)
+		}
+		notifyTaskChanges(DB, s.userID, Task{}, task)
+		return ack(http.StatusCreated, task)
+	case "update", "complete":
+		var input UpdateTaskRequest
+		if request.Type == "complete" {
+			status := StatusCompleted
+			input.Status = &status
+		} else if err := decodeSocketInput(request.Task, &input); err != nil {
+			return fail(http.StatusBadRequest, "Invalid Format", err)
+		}
+		var task Task
+		if err := DB.Where("id = ?", request.TaskID).First(&task).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fail(http.StatusNotFound, "Task not found", nil)
+			}
+			return fail(http.StatusInternalServerError, "Could not retrieve task", err)
+		}
+		before := task
+		if err := updateTask(DB, &task, input); err != nil {
+			var invalid *taskInputError
+			if errors.As(err, &invalid) {
+				return fail(http.StatusBadRequest, invalid.message, invalid.err)
+			}
+			return fail(http.StatusInternalServerError, "Could not "+request.Type+" task", err)
+		}
+		notifyTaskChanges(DB, s.userID, before, task)
+		return ack(http.StatusOK, task)
+	case "invalid":
+		return fail(http.StatusBadRequest, "Invalid Format", errors.New("messages must be JSON request objects"))
+	}
+	return fail(http.StatusBadRequest, "Invalid Format", fmt.Errorf("unknown request type %q", request.Type))
+}
+
+// decodeSocketInput reads and validates the task of a request like the
+// binding of the equivalent HTTP request
+func decodeSocketInput(raw json.RawMessage, input interface{}) error {
+	if len(raw) == 0 {
+		return errors.New("task is required")
+	}
+	if err := json.Unmarshal(raw, input); err != nil {
+		return err
+	}
+	return binding.Validator.ValidateStruct(input)
+}
@@ -0,0 +1,118 @@
+// Package events fans events out to subscribers and keeps the most recent
+// ones in a bounded buffer, so that a subscriber that reconnects can resume
+// from the last event it saw.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is a published event. IDs increase by one with every event.
+type Event struct {
+	ID   uint64
+	Type string
+	Data interface{}
+}
+
+// Broker publishes events to its subscribers. The zero value is not usable;
+// create brokers with NewBroker.
+type Broker struct {
+	mu     sync.Mutex
+	size   int
+	buffer []Event
+	next   uint64
+	subs   map[*Subscription]struct{}
+}
+
+// NewBroker returns a broker replaying up to size events. IDs start from
+// the current time in microseconds, so IDs handed out before a restart are
+// older than the new buffer and are not mistaken for recent ones.
+func NewBroker(size int) *Broker {
+	if size < 1 {
+		size = 1
+	}
+	return &Broker{
+		size: size,
+		next: uint64(time.Now().UnixMicro()),
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the events published after it was made
+type Subscription struct {
+	// C is closed when the subscription is closed, or when the subscriber
+	// falls so far behind that its channel fills up. A subscriber dropped
+	// this way can subscribe again from the last event it received.
+	C      <-chan Event
+	ch     chan Event
+	broker *Broker
+}
+
+// Publish assigns the next ID to an event and sends it to every subscriber.
+// Subscribers whose channel is full are dropped rather than waited for.
+func (b *Broker) Publish(eventType string, data interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	event := Event{ID: b.next, Type: eventType, Data: data}
+	b.next++
+	if len(b.buffer) == b.size {
+		copy(b.buffer, b.buffer[1:])
+		b.buffer = b.buffer[:b.size-1]
+	}
+	b.buffer = append(b.buffer, event)
+	for sub := range b.subs {
+		select {
+		case sub.ch <- event:
+		default:
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	}
+	return event
+}
+
+// Subscribe registers a subscriber whose channel holds up to capacity
+// events. With resume set, the buffered events after the ID `after` are
+// returned for replay, and complete reports whether they are all the events
+// since then: it is false when some have left the buffer or the ID is not
+// one of this broker's.
+func (b *Broker) Subscribe(capacity int, resume bool, after uint64) (sub *Subscription, replay []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch := make(chan Event, capacity)
+	sub = &Subscription{C: ch, ch: ch, broker: b}
+	b.subs[sub] = struct{}{}
+	if !resume {
+		return sub, nil, true
+	}
+
+	first := b.next - uint64(len(b.buffer))
+	if after >= b.next || after+1 < first {
+		return sub, nil, false
+	}
+	for _, event := range b.buffer {
+		if event.ID > after {
+			replay = append(replay, event)
+		}
+	}
+	return sub, replay, true
+}
+
+// Close stops the subscription and closes its channel, unless the broker
+// already dropped it
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	if _, ok := s.broker.subs[s]; ok {
+		delete(s.broker.subs, s)
+		close(s.ch)
+	}
+}
+
+// Subscribers returns the number of active subscriptions
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
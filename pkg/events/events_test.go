@@ -0,0 +1,76 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestPublishAndReplay(t *testing.T) {
+	b := NewBroker(3)
+	sub, replay, complete := b.Subscribe(10, false, 0)
+	if len(replay) != 0 || !complete {
+		t.Fatalf("unexpected replay for a new subscriber: %v %v", replay, complete)
+	}
+	var published []Event
+	for _, name := range []string{"a", "b", "c", "d"} {
+		published = append(published, b.Publish(name, nil))
+	}
+	for i, want := range published {
+		got := <-sub.C
+		if got.ID != want.ID || got.Type != want.Type {
+			t.Fatalf("event %d: got %+v, want %+v", i, got, want)
+		}
+		if i > 0 && got.ID != published[i-1].ID+1 {
+			t.Fatalf("IDs are not consecutive: %d after %d", got.ID, published[i-1].ID)
+		}
+	}
+	sub.Close()
+	sub.Close()
+	if b.Subscribers() != 0 {
+		t.Fatalf("expected no subscribers, got %d", b.Subscribers())
+	}
+
+	tests := []struct {
+		after    uint64
+		types    string
+		complete bool
+	}{
+		{published[1].ID, "cd", true},
+		{published[0].ID, "bcd", true},
+		{published[3].ID, "", true},
+		// a has left the buffer, so what came after it is incomplete
+		{published[0].ID - 1, "", false},
+		{published[3].ID + 1, "", false},
+	}
+	for _, tt := range tests {
+		sub, replay, complete := b.Subscribe(1, true, tt.after)
+		types := ""
+		for _, event := range replay {
+			types += event.Type
+		}
+		if types != tt.types || complete != tt.complete {
+			t.Fatalf("resume after %d: got %q %v, want %q %v", tt.after, types, complete, tt.types, tt.complete)
+		}
+		sub.Close()
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBroker(10)
+	slow, _, _ := b.Subscribe(1, false, 0)
+	fast, _, _ := b.Subscribe(10, false, 0)
+	first := b.Publish("a", nil)
+	b.Publish("b", nil)
+
+	if event, ok := <-slow.C; !ok || event.ID != first.ID {
+		t.Fatalf("expected the buffered event, got %+v %v", event, ok)
+	}
+	if _, ok := <-slow.C; ok {
+		t.Fatalf("expected the slow subscriber to be closed")
+	}
+	if len(fast.C) != 2 || b.Subscribers() != 1 {
+		t.Fatalf("expected the fast subscriber to keep both events, got %d of %d subscribers", len(fast.C), b.Subscribers())
+	}
+	// Closing a dropped subscription is harmless
+	slow.Close()
+	fast.Close()
+}
@@ -0,0 +1,341 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldType determines which operators and values a field accepts
+type FieldType int
+
+const (
+	// String fields support equality only
+	String FieldType = iota
+	// Text fields support substring matching with ':' and exact matching with '='
+	Text
+	// Number fields support equality and ordering
+	Number
+	// Date fields accept dates, keywords (today, tomorrow) and offsets (7d, -2w)
+	Date
+	// Bool fields accept true/false
+	Bool
+	// Day fields hold calendar days as YYYY-MM-DD text and accept the same
+	// values as Date fields
+	Day
+	// List fields hold several values. Column is a condition testing
+	// membership of the value bound to its final placeholder; ':' and '='
+	// match lists containing the value and '!=' lists without it.
+	List
+)
+
+// Field maps an expression field name to a SQL column or expression.
+// Column is trusted SQL and may itself contain placeholders bound by Args.
+type Field struct {
+	Column string
+	Args   []interface{}
+	Type   FieldType
+	// Values restricts a String or List field to a fixed, case-insensitive set
+	Values []string
+}
+
+// Schema resolves field names used in expressions
+type Schema interface {
+	Lookup(name string) (Field, bool)
+}
+
+// Fields is a static Schema keyed by lower-case field name
+type Fields map[string]Field
+
+// Lookup implements Schema
+func (f Fields) Lookup(name string) (Field, bool) {
+	field, ok := f[strings.ToLower(name)]
+	return field, ok
+}
+
+// Compile turns a parsed expression into a SQL condition with `?`
+// placeholders and the matching arguments. Relative dates are resolved
+// against now.
+func Compile(node Node, schema Schema, now time.Time) (string, []interface{}, error) {
+	c := &compiler{schema: schema, now: now}
+	if err := c.compile(node); err != nil {
+		return "", nil, err
+	}
+	return c.sql.String(), c.args, nil
+}
+
+// ParseAndCompile is a convenience wrapper around Parse and Compile
+func ParseAndCompile(input string, schema Schema, now time.Time) (string, []interface{}, error) {
+	node, err := Parse(input)
+	if err != nil {
+		return "", nil, err
+	}
+	return Compile(node, schema, now)
+}
+
+type compiler struct {
+	schema Schema
+	now    time.Time
+	sql    strings.Builder
+	args   []interface{}
+}
+
+// compile writes the SQL of node to c.sql
+func (c *compiler) compile(node Node) error {
+	switch n := node.(type) {
+	case *BinaryExpr:
+		c.sql.WriteString("(")
+		if err := c.compile(n.Left); err != nil {
+			return err
+		}
+		c.sql.WriteString(" " + n.Op + " ")
+		if err := c.compile(n.Right); err != nil {
+			return err
+		}
+		c.sql.WriteString(")")
+		return nil
+	case *NotExpr:
+		c.sql.WriteString("NOT ")
+		return c.compile(n.X)
+	case *Comparison:
+		sql, err := c.comparison(n)
+		if err != nil {
+			return err
+		}
+		c.sql.WriteString(sql)
+		return nil
+	}
+	return &Error{Pos: node.Pos(), Msg: "unsupported expression"}
+}
+
+// column appends the field's own arguments and returns its SQL expression
+func (c *compiler) column(f Field) string {
+	c.args = append(c.args, f.Args...)
+	return f.Column
+}
+
+func (c *compiler) comparison(n *Comparison) (string, error) {
+	field, ok := c.schema.Lookup(n.Field)
+	if !ok {
+		return "", &Error{Pos: n.pos, Msg: fmt.Sprintf("unknown field %q", n.Field)}
+	}
+
+	if strings.EqualFold(n.Value, "none") && field.Type != List {
+		return c.none(n, field)
+	}
+
+	switch field.Type {
+	case String, Text:
+		return c.text(n, field)
+	case List:
+		return c.list(n, field)
+	case Number:
+		v, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil {
+			return "", &Error{Pos: n.ValuePos, Msg: fmt.Sprintf("%q is not a number", n.Value)}
+		}
+		return c.ordered(n, field, v)
+	case Bool:
+		v, err := strconv.ParseBool(strings.ToLower(n.Value))
+		if err != nil {
+			return "", &Error{Pos: n.ValuePos, Msg: fmt.Sprintf("%q is not a boolean", n.Value)}
+		}
+		switch n.Op {
+		case ":", "=":
+			col := c.column(field)
+			c.args = append(c.args, v)
+			return "(" + col + " = ?)", nil
+		case "!=":
+			return c.notEqual(field, v), nil
+		}
+		return "", c.badOp(n)
+	case Date:
+		return c.date(n, field)
+	case Day:
+		t, err := ParseDate(n.Value, c.now)
+		if err != nil {
+			return "", &Error{Pos: n.ValuePos, Msg: err.Error()}
+		}
+		return c.ordered(n, field, t.Format("2006-01-02"))
+	}
+	return "", &Error{Pos: n.pos, Msg: fmt.Sprintf("field %q cannot be filtered", n.Field)}
+}
+
+func (c *compiler) badOp(n *Comparison) error {
+	return &Error{Pos: n.pos, Msg: fmt.Sprintf("operator %q is not supported for field %q", n.Op, n.Field)}
+}
+
+// none handles `field:none` and `field!=none`
+func (c *compiler) none(n *Comparison, field Field) (string, error) {
+	var isNull string
+	if field.Type == String || field.Type == Text {
+		isNull = "(" + c.column(field) + " IS NULL OR " + c.column(field) + " = '')"
+	} else {
+		isNull = "(" + c.column(field) + " IS NULL)"
+	}
+	switch n.Op {
+	case ":", "=":
+		return isNull, nil
+	case "!=":
+		return "NOT " + isNull, nil
+	}
+	return "", c.badOp(n)
+}
+
+// canonicalValue checks a value against the field's allowed values,
+// returning it in its canonical case
+func canonicalValue(n *Comparison, field Field) (string, error) {
+	if len(field.Values) == 0 {
+		return n.Value, nil
+	}
+	for _, allowed := range field.Values {
+		if strings.EqualFold(allowed, n.Value) {
+			return allowed, nil
+		}
+	}
+	return "", &Error{Pos: n.ValuePos, Msg: fmt.Sprintf("invalid value %q for field %q, expected one of %s", n.Value, n.Field, strings.Join(field.Values, ", "))}
+}
+
+func (c *compiler) text(n *Comparison, field Field) (string, error) {
+	value, err := canonicalValue(n, field)
+	if err != nil {
+		return "", err
+	}
+
+	switch n.Op {
+	case ":":
+		if field.Type == Text {
+			col := c.column(field)
+			c.args = append(c.args, "%"+EscapeLike(strings.ToLower(value))+"%")
+			return "(LOWER(" + col + ") LIKE ? ESCAPE '\\')", nil
+		}
+		fallthrough
+	case "=":
+		col := c.column(field)
+		c.args = append(c.args, value)
+		return "(" + col + " = ?)", nil
+	case "!=":
+		return c.notEqual(field, value), nil
+	}
+	return "", c.badOp(n)
+}
+
+func (c *compiler) list(n *Comparison, field Field) (string, error) {
+	value, err := canonicalValue(n, field)
+	if err != nil {
+		return "", err
+	}
+	contains := c.column(field)
+	c.args = append(c.args, value)
+	switch n.Op {
+	case ":", "=":
+		return "(" + contains + ")", nil
+	case "!=":
+		return "NOT (" + contains + ")", nil
+	}
+	return "", c.badOp(n)
+}
+
+// notEqual matches rows whose value differs from v, including NULLs
+func (c *compiler) notEqual(field Field, v interface{}) string {
+	isNull := c.column(field) + " IS NULL"
+	col := c.column(field)
+	c.args = append(c.args, v)
+	return "(" + isNull + " OR " + col + " <> ?)"
+}
+
+// ordered handles comparisons on fields with a natural ordering
+func (c *compiler) ordered(n *Comparison, field Field, v interface{}) (string, error) {
+	op := n.Op
+	switch op {
+	case ":":
+		op = "="
+	case "!=":
+		return c.notEqual(field, v), nil
+	case "=", "<", "<=", ">", ">=":
+	default:
+		return "", c.badOp(n)
+	}
+	col := c.column(field)
+	c.args = append(c.args, v)
+	return "(" + col + " " + op + " ?)", nil
+}
+
+func (c *compiler) date(n *Comparison, field Field) (string, error) {
+	t, err := ParseDate(n.Value, c.now)
+	if err != nil {
+		return "", &Error{Pos: n.ValuePos, Msg: err.Error()}
+	}
+	switch n.Op {
+	case ":", "=":
+		start := startOfDay(t)
+		from := c.column(field)
+		c.args = append(c.args, start)
+		to := c.column(field)
+		c.args = append(c.args, start.AddDate(0, 0, 1))
+		return "(" + from + " >= ? AND " + to + " < ?)", nil
+	case "!=":
+		start := startOfDay(t)
+		isNull := c.column(field) + " IS NULL"
+		before := c.column(field)
+		c.args = append(c.args, start)
+		after := c.column(field)
+		c.args = append(c.args, start.AddDate(0, 0, 1))
+		return "(" + isNull + " OR " + before + " < ? OR " + after + " >= ?)", nil
+	}
+	return c.ordered(n, field, t)
+}
+
+var relativeDate = regexp.MustCompile(`^([+-]?\d+)([hdwm])$`)
+
+// ParseDate resolves an absolute date (2006-01-02 or RFC 3339), a keyword
+// (now, today, tomorrow, yesterday) or an offset from now such as 7d, -2w,
+// 12h or 1m
+func ParseDate(value string, now time.Time) (time.Time, error) {
+	switch strings.ToLower(value) {
+	case "now":
+		return now, nil
+	case "today":
+		return startOfDay(now), nil
+	case "tomorrow":
+		return startOfDay(now).AddDate(0, 0, 1), nil
+	case "yesterday":
+		return startOfDay(now).AddDate(0, 0, -1), nil
+	}
+	if m := relativeDate.FindStringSubmatch(strings.ToLower(value)); m != nil {
+		amount, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid offset %q", value)
+		}
+		switch m[2] {
+		case "h":
+			return now.Add(time.Duration(amount) * time.Hour), nil
+		case "d":
+			return now.AddDate(0, 0, amount), nil
+		case "w":
+			return now.AddDate(0, 0, 7*amount), nil
+		case "m":
+			return now.AddDate(0, amount, 0), nil
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD, RFC 3339, today, tomorrow or an offset like 7d", value)
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// EscapeLike escapes LIKE wildcards so user input is matched literally
+func EscapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
@@ -0,0 +1,134 @@
+package filter
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testFields = Fields{
+	"priority": {Column: "priority", Type: String, Values: []string{"low", "medium", "high"}},
+	"status":   {Column: "status", Type: String, Values: []string{"pending", "completed"}},
+	"category": {Column: "category", Type: String},
+	"task":     {Column: "name", Type: Text},
+	"due":      {Column: "due_date", Type: Date},
+	"user":     {Column: "user_id", Type: Number},
+	"cf.start": {Column: "json_extract(fields, '$.start')", Type: Day},
+	"cf.labels": {
+		Column: "EXISTS (SELECT 1 FROM json_each(fields, ?) WHERE value = ?)",
+		Args:   []interface{}{"$.labels"},
+		Type:   List,
+		Values: []string{"bug", "feature"},
+	},
+}
+
+func TestCompileExpression(t *testing.T) {
+	now := time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input string
+		sql   string
+		args  []interface{}
+	}{
+		{
+			input: "priority:HIGH",
+			sql:   "(priority = ?)",
+			args:  []interface{}{"high"},
+		},
+		{
+			input: "priority:high AND (category:work OR due<7d) AND NOT status:completed",
+			sql:   "(((priority = ?) AND ((category = ?) OR (due_date < ?))) AND NOT (status = ?))",
+			args:  []interface{}{"high", "work", now.AddDate(0, 0, 7), "completed"},
+		},
+		{
+			input: "category:work category:home or user>=2",
+			sql:   "(((category = ?) AND (category = ?)) OR (user_id >= ?))",
+			args:  []interface{}{"work", "home", float64(2)},
+		},
+		{
+			input: `task:"50%_off"`,
+			sql:   `(LOWER(name) LIKE ? ESCAPE '\')`,
+			args:  []interface{}{`%50\%\_off%`},
+		},
+		{
+			input: "due:2024-03-12",
+			sql:   "(due_date >= ? AND due_date < ?)",
+			args: []interface{}{
+				time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			input: "due:none",
+			sql:   "(due_date IS NULL)",
+			args:  nil,
+		},
+		{
+			input: "cf.start>=tomorrow",
+			sql:   "(json_extract(fields, '$.start') >= ?)",
+			args:  []interface{}{"2024-03-11"},
+		},
+		{
+			input: "cf.labels:BUG AND cf.labels!=feature",
+			sql:   "((EXISTS (SELECT 1 FROM json_each(fields, ?) WHERE value = ?)) AND NOT (EXISTS (SELECT 1 FROM json_each(fields, ?) WHERE value = ?)))",
+			args:  []interface{}{"$.labels", "bug", "$.labels", "feature"},
+		},
+		{
+			input: "category!=work",
+			sql:   "(category IS NULL OR category <> ?)",
+			args:  []interface{}{"work"},
+		},
+		{
+			input: strings.Repeat("NOT (", 16) + "user=1" + strings.Repeat(")", 16),
+			sql:   strings.Repeat("NOT ", 16) + "(user_id = ?)",
+			args:  []interface{}{float64(1)},
+		},
+	}
+
+	for _, tt := range tests {
+		sql, args, err := ParseAndCompile(tt.input, testFields, now)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.input, err)
+		}
+		if sql != tt.sql {
+			t.Errorf("%q: sql = %s, want %s", tt.input, sql, tt.sql)
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%q: args = %v, want %v", tt.input, args, tt.args)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+	}{
+		{"", 0},
+		{"priority:high AND", 17},
+		{"(priority:high", 14},
+		{"priority high", 9},
+		{"priority:urgent", 9},
+		{"owner:me", 0},
+		{"status:pending AND due<soon", 23},
+		{`task:"unterminated`, 5},
+		{"priority!high", 8},
+		{"category<work", 0},
+		{strings.Repeat("NOT ", 33) + "user=1", 128},
+		{strings.Repeat("(", 33) + "user=1" + strings.Repeat(")", 33), 32},
+		{"user=1" + strings.Repeat(" OR user=1", 200), 2000},
+	}
+
+	for _, tt := range tests {
+		_, _, err := ParseAndCompile(tt.input, testFields, time.Now())
+		var filterErr *Error
+		if !errors.As(err, &filterErr) {
+			t.Fatalf("%q: expected *Error, got %v", tt.input, err)
+		}
+		if filterErr.Pos != tt.pos {
+			t.Errorf("%q: position = %d, want %d (%s)", tt.input, filterErr.Pos, tt.pos, filterErr.Msg)
+		}
+	}
+}
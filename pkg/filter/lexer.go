@@ -0,0 +1,142 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tokenKind identifies the lexical class of a token
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokEOF:
+		return "end of input"
+	case tokWord:
+		return "word"
+	case tokString:
+		return "string"
+	case tokOp:
+		return "operator"
+	case tokLParen:
+		return "'('"
+	case tokRParen:
+		return "')'"
+	case tokAnd:
+		return "AND"
+	case tokOr:
+		return "OR"
+	case tokNot:
+		return "NOT"
+	}
+	return "token"
+}
+
+// token is a single lexical unit; pos is the byte offset in the input
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// isWordByte reports whether b may appear in an unquoted word
+func isWordByte(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\r', '(', ')', ':', '<', '>', '=', '!', '"':
+		return false
+	}
+	return true
+}
+
+// lex splits the input into tokens
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		b := input[i]
+		switch {
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r':
+			i++
+		case b == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case b == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case b == ':' || b == '=':
+			tokens = append(tokens, token{kind: tokOp, text: string(b), pos: i})
+			i++
+		case b == '<' || b == '>' || b == '!':
+			op := string(b)
+			if i+1 < len(input) && input[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, &Error{Pos: i, Msg: "unexpected '!', did you mean '!='?"}
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		case b == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(input) {
+				if input[i] == '\\' && i+1 < len(input) {
+					sb.WriteByte(input[i+1])
+					i += 2
+					continue
+				}
+				if input[i] == '"' {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteByte(input[i])
+				i++
+			}
+			if !closed {
+				return nil, &Error{Pos: start, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{kind: tokString, text: sb.String(), pos: start})
+		default:
+			start := i
+			for i < len(input) && isWordByte(input[i]) {
+				i++
+			}
+			word := input[start:i]
+			kind := tokWord
+			switch strings.ToUpper(word) {
+			case "AND":
+				kind = tokAnd
+			case "OR":
+				kind = tokOr
+			case "NOT":
+				kind = tokNot
+			}
+			tokens = append(tokens, token{kind: kind, text: word, pos: start})
+		}
+	}
+	tokens = append(tokens, token{kind: tokEOF, pos: len(input)})
+	return tokens, nil
+}
+
+// describe renders a token for use in error messages
+func (t token) describe() string {
+	if t.kind == tokEOF {
+		return t.kind.String()
+	}
+	return fmt.Sprintf("%q", t.text)
+}
@@ -0,0 +1,204 @@
+// Package filter implements a small boolean expression language used to
+// filter listings, e.g. `priority:high AND (category:work OR due<7d)`.
+//
+// Expressions are parsed into an AST and compiled against a Schema into a
+// parameterised SQL fragment; user input never ends up in the SQL text.
+package filter
+
+import "fmt"
+
+// Error is a parse or compile error annotated with the byte offset in the
+// expression where it occurred
+type Error struct {
+	Pos int    `json:"position"`
+	Msg string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("at position %d: %s", e.Pos, e.Msg)
+}
+
+// Node is an element of a parsed expression
+type Node interface {
+	Pos() int
+}
+
+// BinaryExpr combines two expressions with AND or OR
+type BinaryExpr struct {
+	Op    string
+	Left  Node
+	Right Node
+	pos   int
+}
+
+func (b *BinaryExpr) Pos() int { return b.pos }
+
+// NotExpr negates an expression
+type NotExpr struct {
+	X   Node
+	pos int
+}
+
+func (n *NotExpr) Pos() int { return n.pos }
+
+// Comparison is a single `field op value` term
+type Comparison struct {
+	Field    string
+	Op       string
+	Value    string
+	ValuePos int
+	pos      int
+}
+
+func (c *Comparison) Pos() int { return c.pos }
+
+const (
+	// maxLength caps the length of an expression in bytes
+	maxLength = 2000
+	// maxDepth caps the nesting of parentheses and NOT, which the parser
+	// and compiler handle recursively
+	maxDepth = 32
+)
+
+// parser is a recursive-descent parser over the token stream
+//
+//	expr    = or
+//	or      = and { "OR" and }
+//	and     = unary { ["AND"] unary }
+//	unary   = "NOT" unary | primary
+//	primary = "(" expr ")" | field op value
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+// Parse parses an expression into its AST
+func Parse(input string) (Node, error) {
+	if len(input) > maxLength {
+		return nil, &Error{Pos: maxLength, Msg: fmt.Sprintf("expression is longer than %d characters", maxLength)}
+	}
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, &Error{Pos: 0, Msg: "empty expression"}
+	}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &Error{Pos: t.pos, Msg: "unexpected " + t.describe()}
+	}
+	return node, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		op := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "OR", Left: left, Right: right, pos: op.pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch t.kind {
+		case tokAnd:
+			p.next()
+		case tokNot, tokLParen, tokWord, tokString:
+			// Adjacent terms are implicitly ANDed
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: "AND", Left: left, Right: right, pos: t.pos}
+	}
+}
+
+// enter descends one level of nesting at t, failing when the expression
+// nests too deeply; the caller leaves with p.depth--
+func (p *parser) enter(t token) error {
+	if p.depth++; p.depth > maxDepth {
+		return &Error{Pos: t.pos, Msg: fmt.Sprintf("expression is nested more than %d levels deep", maxDepth)}
+	}
+	return nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if t := p.peek(); t.kind == tokNot {
+		p.next()
+		if err := p.enter(t); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{X: x, pos: t.pos}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		if err := p.enter(t); err != nil {
+			return nil, err
+		}
+		defer func() { p.depth-- }()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, &Error{Pos: closing.pos, Msg: "expected ')' but found " + closing.describe()}
+		}
+		return x, nil
+	case tokWord:
+		op := p.next()
+		if op.kind != tokOp {
+			return nil, &Error{Pos: op.pos, Msg: fmt.Sprintf("expected operator after field %q but found %s", t.text, op.describe())}
+		}
+		value := p.next()
+		if value.kind != tokWord && value.kind != tokString {
+			return nil, &Error{Pos: value.pos, Msg: "expected value but found " + value.describe()}
+		}
+		return &Comparison{Field: t.text, Op: op.text, Value: value.text, ValuePos: value.pos, pos: t.pos}, nil
+	default:
+		return nil, &Error{Pos: t.pos, Msg: "expected field or '(' but found " + t.describe()}
+	}
+}
@@ -0,0 +1,217 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	// Embedded zone data resolves TZIDs on hosts without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// maxLineBytes bounds a single unfolded content line when decoding
+const maxLineBytes = 1 << 20
+
+// Decode parses iCalendar data into its top-level components, normally a
+// single VCALENDAR. Folded lines are unfolded and parameter values
+// unquoted; property values are returned unescaped as written.
+func Decode(r io.Reader) ([]Component, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+
+	var lines []string
+	var lineNumbers []int
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if n == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		lines = append(lines, line)
+		lineNumbers = append(lineNumbers, n)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var roots []Component
+	var stack []*Component
+	for i, line := range lines {
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNumbers[i], err)
+		}
+		switch strings.ToUpper(p.Name) {
+		case "BEGIN":
+			stack = append(stack, &Component{Name: strings.ToUpper(p.Value)})
+		case "END":
+			name := strings.ToUpper(p.Value)
+			if len(stack) == 0 || stack[len(stack)-1].Name != name {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", lineNumbers[i], p.Value)
+			}
+			done := *stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				roots = append(roots, done)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, done)
+			}
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property %s outside a component", lineNumbers[i], p.Name)
+			}
+			c := stack[len(stack)-1]
+			c.Properties = append(c.Properties, p)
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("missing END:%s", stack[len(stack)-1].Name)
+	}
+	return roots, nil
+}
+
+// parseLine splits a content line into its name, parameters and value
+func parseLine(line string) (Property, error) {
+	var p Property
+	end := strings.IndexAny(line, ";:")
+	if end <= 0 {
+		return p, fmt.Errorf("malformed content line %q", line)
+	}
+	p.Name = strings.ToUpper(line[:end])
+	rest := line[end:]
+	for strings.HasPrefix(rest, ";") {
+		rest = rest[1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return p, fmt.Errorf("malformed parameter in %s", p.Name)
+		}
+		name := strings.ToUpper(rest[:eq])
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			closing := strings.IndexByte(rest[1:], '"')
+			if closing < 0 {
+				return p, fmt.Errorf("unterminated quoted parameter in %s", p.Name)
+			}
+			value, rest = rest[1:closing+1], rest[closing+2:]
+		} else {
+			stop := strings.IndexAny(rest, ";:")
+			if stop < 0 {
+				return p, fmt.Errorf("missing value in %s", p.Name)
+			}
+			value, rest = rest[:stop], rest[stop:]
+		}
+		if p.Params == nil {
+			p.Params = make(map[string]string)
+		}
+		p.Params[name] = value
+	}
+	if !strings.HasPrefix(rest, ":") {
+		return p, fmt.Errorf("missing value in %s", p.Name)
+	}
+	p.Value = rest[1:]
+	return p, nil
+}
+
+// ParseText unescapes a TEXT value
+func ParseText(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// ParseTextList splits a comma-separated list of TEXT values and unescapes
+// them, dropping empty entries
+func ParseTextList(s string) []string {
+	var values []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			if v := strings.TrimSpace(ParseText(s[start:i])); v != "" {
+				values = append(values, v)
+			}
+			start = i + 1
+		}
+	}
+	if v := strings.TrimSpace(ParseText(s[start:])); v != "" {
+		values = append(values, v)
+	}
+	return values
+}
+
+// ParseTime parses a DATE or DATE-TIME property. allDay reports a DATE
+// value, returned as midnight UTC. Times with a TZID are resolved in that
+// zone when it is known; floating times and unknown zones are taken as UTC.
+func ParseTime(p Property) (t time.Time, allDay bool, err error) {
+	value := strings.TrimSpace(p.Value)
+	if strings.EqualFold(p.Params["VALUE"], "DATE") || len(value) == 8 {
+		t, err = time.Parse("20060102", value)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+	loc := time.UTC
+	if tzid := p.Params["TZID"]; tzid != "" {
+		if zone, zoneErr := time.LoadLocation(strings.TrimPrefix(tzid, "/")); zoneErr == nil {
+			loc = zone
+		}
+	}
+	t, err = time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// recurrenceFrequencies are the FREQ values of RFC 5545 recurrence rules
+var recurrenceFrequencies = map[string]bool{
+	"SECONDLY": true, "MINUTELY": true, "HOURLY": true, "DAILY": true,
+	"WEEKLY": true, "MONTHLY": true, "YEARLY": true,
+}
+
+// ValidateRecurrence checks that an RRULE value is a list of NAME=VALUE
+// parts with exactly one valid FREQ
+func ValidateRecurrence(rule string) error {
+	freq := ""
+	for _, part := range strings.Split(rule, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || name == "" || value == "" {
+			return fmt.Errorf("malformed recurrence rule part %q", part)
+		}
+		if strings.EqualFold(name, "FREQ") {
+			if freq != "" {
+				return fmt.Errorf("recurrence rule has more than one FREQ")
+			}
+			freq = strings.ToUpper(value)
+		}
+	}
+	if !recurrenceFrequencies[freq] {
+		return fmt.Errorf("recurrence rule needs a FREQ of DAILY, WEEKLY, MONTHLY, YEARLY or similar")
+	}
+	return nil
+}
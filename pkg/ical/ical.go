@@ -0,0 +1,154 @@
+// Package ical reads and writes iCalendar (RFC 5545) data: calendars of
+// components such as VTODO and VEVENT made of properties, with the text
+// escaping and line folding the format requires.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxLineOctets is the longest content line allowed before folding,
+// excluding the line break
+const maxLineOctets = 75
+
+// Property is a content line. Value is written as is, so text values must
+// be escaped with Text or TextList.
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Component is a named block of properties and nested components
+type Component struct {
+	Name       string
+	Properties []Property
+	Components []Component
+}
+
+// Add appends a property to the component
+func (c *Component) Add(name, value string) {
+	c.Properties = append(c.Properties, Property{Name: name, Value: value})
+}
+
+// AddWithParams appends a property with parameters to the component
+func (c *Component) AddWithParams(name string, params map[string]string, value string) {
+	c.Properties = append(c.Properties, Property{Name: name, Params: params, Value: value})
+}
+
+// Get returns the first property with the given name
+func (c *Component) Get(name string) (Property, bool) {
+	for _, p := range c.Properties {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return Property{}, false
+}
+
+// NewCalendar returns a VCALENDAR component with the required version and
+// product identifier
+func NewCalendar(prodID string) Component {
+	cal := Component{Name: "VCALENDAR"}
+	cal.Add("VERSION", "2.0")
+	cal.Add("PRODID", prodID)
+	cal.Add("CALSCALE", "GREGORIAN")
+	return cal
+}
+
+// Text escapes a TEXT value
+func Text(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, ";", `\;`)
+	s = strings.ReplaceAll(s, ",", `\,`)
+	s = strings.ReplaceAll(s, "\r\n", `\n`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+// TextList escapes a comma-separated list of TEXT values
+func TextList(values []string) string {
+	escaped := make([]string, len(values))
+	for i, v := range values {
+		escaped[i] = Text(v)
+	}
+	return strings.Join(escaped, ",")
+}
+
+// DateTime formats a time as a UTC DATE-TIME value
+func DateTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// Date formats the calendar day of a time as a DATE value
+func Date(t time.Time) string {
+	return t.Format("20060102")
+}
+
+// Encode writes a component, normally a VCALENDAR, with CRLF line breaks
+// and long lines folded
+func Encode(w io.Writer, c Component) error {
+	bw := bufio.NewWriter(w)
+	writeComponent(bw, c)
+	return bw.Flush()
+}
+
+func writeComponent(w *bufio.Writer, c Component) {
+	writeLine(w, "BEGIN:"+c.Name)
+	for _, p := range c.Properties {
+		writeLine(w, p.line())
+	}
+	for _, child := range c.Components {
+		writeComponent(w, child)
+	}
+	writeLine(w, "END:"+c.Name)
+}
+
+// line renders a property as an unfolded content line, with parameters in
+// a stable order
+func (p Property) line() string {
+	var b strings.Builder
+	b.WriteString(p.Name)
+	names := make([]string, 0, len(p.Params))
+	for name := range p.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString(";" + name + "=" + paramValue(p.Params[name]))
+	}
+	b.WriteString(":" + p.Value)
+	return b.String()
+}
+
+// paramValue quotes parameter values containing separators
+func paramValue(v string) string {
+	v = strings.ReplaceAll(v, `"`, "'")
+	if strings.ContainsAny(v, ";:,") {
+		return `"` + v + `"`
+	}
+	return v
+}
+
+// writeLine writes a content line, folding it into lines of at most 75
+// octets without splitting UTF-8 sequences
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineOctets
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space, which counts towards the limit
+		limit = maxLineOctets - 1
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
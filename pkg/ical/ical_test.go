@@ -0,0 +1,149 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeCalendar(t *testing.T) {
+	due := time.Date(2024, 6, 3, 17, 30, 0, 0, time.FixedZone("CEST", 2*3600))
+	todo := Component{Name: "VTODO"}
+	todo.Add("UID", "task-1@example.com")
+	todo.Add("SUMMARY", Text("Call Bob; then, Alice\\Eve\nsoon"))
+	todo.Add("CATEGORIES", TextList([]string{"work", "a,b"}))
+	todo.Add("DUE", DateTime(due))
+	todo.AddWithParams("DTSTART", map[string]string{"VALUE": "DATE"}, Date(due))
+	todo.AddWithParams("X-NOTE", map[string]string{"X-LABEL": "a:b"}, "x")
+
+	cal := NewCalendar("-//Test//EN")
+	cal.Components = append(cal.Components, todo)
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, cal); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	want := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Test//EN",
+		"CALSCALE:GREGORIAN",
+		"BEGIN:VTODO",
+		"UID:task-1@example.com",
+		`SUMMARY:Call Bob\; then\, Alice\\Eve\nsoon`,
+		`CATEGORIES:work,a\,b`,
+		"DUE:20240603T153000Z",
+		"DTSTART;VALUE=DATE:20240603",
+		`X-NOTE;X-LABEL="a:b":x`,
+		"END:VTODO",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n")
+	if got := buf.String(); got != want {
+		t.Fatalf("unexpected calendar:\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestEncodeFoldsLongLines(t *testing.T) {
+	c := Component{Name: "VTODO"}
+	c.Add("DESCRIPTION", strings.Repeat("é", 60))
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, c); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected the description folded over two lines, got %q", lines)
+	}
+	for _, line := range lines {
+		if len(line) > maxLineOctets {
+			t.Fatalf("line longer than %d octets: %q", maxLineOctets, line)
+		}
+	}
+	if !strings.HasPrefix(lines[2], " ") {
+		t.Fatalf("expected a continuation line, got %q", lines[2])
+	}
+	unfolded := lines[1] + strings.TrimPrefix(lines[2], " ")
+	if unfolded != "DESCRIPTION:"+strings.Repeat("é", 60) {
+		t.Fatalf("folding split a character: %q", unfolded)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	input := "\ufeffBEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VTODO\r\n" +
+		"UID:abc-1\r\n" +
+		"SUMMARY:Call Bob\\; then\\, Alice\\nsoon and a very long line that the\r\n" +
+		"  exporter folded\r\n" +
+		"DUE;TZID=Europe/Berlin:20240603T173000\r\n" +
+		"X-NOTE;X-LABEL=\"a:b;c\";LANGUAGE=en:x:y\r\n" +
+		"CATEGORIES:work,a\\,b,\r\n" +
+		"END:VTODO\n" +
+		"END:VCALENDAR\n"
+	roots, err := Decode(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(roots) != 1 || roots[0].Name != "VCALENDAR" || len(roots[0].Components) != 1 {
+		t.Fatalf("unexpected structure: %+v", roots)
+	}
+	todo := roots[0].Components[0]
+	summary, _ := todo.Get("summary")
+	if got := ParseText(summary.Value); got != "Call Bob; then, Alice\nsoon and a very long line that the exporter folded" {
+		t.Fatalf("unexpected summary %q", got)
+	}
+	note, _ := todo.Get("X-NOTE")
+	if note.Params["X-LABEL"] != "a:b;c" || note.Params["LANGUAGE"] != "en" || note.Value != "x:y" {
+		t.Fatalf("unexpected parameters: %+v", note)
+	}
+	categories, _ := todo.Get("CATEGORIES")
+	if got := ParseTextList(categories.Value); len(got) != 2 || got[0] != "work" || got[1] != "a,b" {
+		t.Fatalf("unexpected categories %q", got)
+	}
+	due, _ := todo.Get("DUE")
+	at, allDay, err := ParseTime(due)
+	if err != nil || allDay || !at.Equal(time.Date(2024, 6, 3, 15, 30, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected due time %v (all day %t, %v)", at, allDay, err)
+	}
+
+	for _, bad := range []string{
+		"BEGIN:VTODO\r\nEND:VEVENT\r\n",
+		"BEGIN:VTODO\r\nSUMMARY:x\r\n",
+		"SUMMARY:x\r\n",
+		"BEGIN:VTODO\r\nSUMMARY\r\nEND:VTODO\r\n",
+	} {
+		if _, err := Decode(strings.NewReader(bad)); err == nil {
+			t.Fatalf("expected an error decoding %q", bad)
+		}
+	}
+}
+
+func TestParseTimeAndRecurrence(t *testing.T) {
+	at, allDay, err := ParseTime(Property{Name: "DUE", Params: map[string]string{"VALUE": "DATE"}, Value: "20240603"})
+	if err != nil || !allDay || !at.Equal(time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected date %v (all day %t, %v)", at, allDay, err)
+	}
+	if at, _, err := ParseTime(Property{Name: "DUE", Value: "20240603T080000Z"}); err != nil || at.Hour() != 8 {
+		t.Fatalf("unexpected UTC time %v (%v)", at, err)
+	}
+	if _, _, err := ParseTime(Property{Name: "DUE", Value: "tomorrow"}); err == nil {
+		t.Fatalf("expected an error for an invalid time")
+	}
+
+	for rule, valid := range map[string]bool{
+		"FREQ=WEEKLY;BYDAY=MO,WE":     true,
+		"freq=daily;COUNT=3":          true,
+		"INTERVAL=2":                  false,
+		"FREQ=FORTNIGHTLY":            false,
+		"FREQ=DAILY;FREQ=WEEKLY":      false,
+		"FREQ=DAILY;;INTERVAL=2":      false,
+		"FREQ=MONTHLY;BYMONTHDAY=-1;": false,
+	} {
+		if err := ValidateRecurrence(rule); (err == nil) != valid {
+			t.Fatalf("ValidateRecurrence(%q) = %v, want valid %t", rule, err, valid)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Package todotxt reads and writes the todo.txt format
+// (https://github.com/todotxt/todo.txt): one task per line with an
+// optional completion marker, priority and dates, followed by text that
+// may carry +project, @context and key:value tokens.
+//
+// The text of a task is kept as written, so parsing a well-formed line and
+// formatting the task again gives back the same line.
+package todotxt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// DateLayout is the format of dates in todo.txt
+const DateLayout = "2006-01-02"
+
+// Task is one line of a todo.txt file
+type Task struct {
+	Completed bool
+	// Priority is a letter from A (highest) to Z, or empty
+	Priority string
+	// CompletionDate is only written for completed tasks
+	CompletionDate *time.Time
+	CreationDate   *time.Time
+	// Text is the rest of the line, including its tokens
+	Text string
+}
+
+// Parse reads a line. Dates are in UTC.
+func Parse(line string) (Task, error) {
+	var t Task
+	rest := strings.TrimSpace(line)
+	if word, tail := cut(rest); word == "x" {
+		t.Completed = true
+		rest = tail
+		if date, ok := parseDate(rest); ok {
+			t.CompletionDate = &date
+			rest = skipWord(rest)
+			if date, ok := parseDate(rest); ok {
+				t.CreationDate = &date
+				rest = skipWord(rest)
+			}
+		}
+	} else {
+		if len(rest) >= 4 && rest[0] == '(' && rest[1] >= 'A' && rest[1] <= 'Z' && rest[2] == ')' && rest[3] == ' ' {
+			t.Priority = rest[1:2]
+			rest = strings.TrimLeft(rest[4:], " ")
+		}
+		if date, ok := parseDate(rest); ok {
+			t.CreationDate = &date
+			rest = skipWord(rest)
+		}
+	}
+	if rest == "" {
+		return t, fmt.Errorf("task has no text")
+	}
+	t.Text = rest
+	return t, nil
+}
+
+// String formats the task as a line
+func (t Task) String() string {
+	var parts []string
+	if t.Completed {
+		parts = append(parts, "x")
+		if t.CompletionDate != nil {
+			parts = append(parts, t.CompletionDate.Format(DateLayout))
+		}
+	} else if t.Priority != "" {
+		parts = append(parts, "("+t.Priority+")")
+	}
+	// A creation date can only follow a completion date on completed tasks
+	if t.CreationDate != nil && (!t.Completed || t.CompletionDate != nil) {
+		parts = append(parts, t.CreationDate.Format(DateLayout))
+	}
+	return strings.Join(append(parts, t.Text), " ")
+}
+
+// Line is a parsed line of a file, numbered from 1. Err is set when the
+// line is not a valid task.
+type Line struct {
+	Number int
+	Task   Task
+	Err    error
+}
+
+// Decode reads the tasks of a file, skipping blank lines
+func Decode(r io.Reader) ([]Line, error) {
+	var lines []Line
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	number := 0
+	for scanner.Scan() {
+		number++
+		text := strings.TrimPrefix(scanner.Text(), "\ufeff")
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		task, err := Parse(text)
+		lines = append(lines, Line{Number: number, Task: task, Err: err})
+	}
+	return lines, scanner.Err()
+}
+
+// Encode writes tasks one per line
+func Encode(w io.Writer, tasks []Task) error {
+	bw := bufio.NewWriter(w)
+	for _, t := range tasks {
+		bw.WriteString(t.String())
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
+
+// Projects returns the +project tokens of the text, without the plus
+func (t Task) Projects() []string {
+	var projects []string
+	for _, word := range strings.Fields(t.Text) {
+		if name, ok := Project(word); ok {
+			projects = append(projects, name)
+		}
+	}
+	return projects
+}
+
+// Contexts returns the @context tokens of the text, without the at sign
+func (t Task) Contexts() []string {
+	var contexts []string
+	for _, word := range strings.Fields(t.Text) {
+		if name, ok := Context(word); ok {
+			contexts = append(contexts, name)
+		}
+	}
+	return contexts
+}
+
+// Value returns the value of the first key:value token with the key
+func (t Task) Value(key string) (string, bool) {
+	for _, word := range strings.Fields(t.Text) {
+		if k, v, ok := KeyValue(word); ok && k == key {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// Project reports whether a word is a +project token
+func Project(word string) (string, bool) {
+	if len(word) > 1 && word[0] == '+' {
+		return word[1:], true
+	}
+	return "", false
+}
+
+// Context reports whether a word is an @context token
+func Context(word string) (string, bool) {
+	if len(word) > 1 && word[0] == '@' {
+		return word[1:], true
+	}
+	return "", false
+}
+
+// KeyValue reports whether a word is a key:value token. Neither part may
+// contain a colon, so URLs are not mistaken for tokens.
+func KeyValue(word string) (key, value string, ok bool) {
+	key, value, found := strings.Cut(word, ":")
+	if !found || key == "" || value == "" || strings.Contains(value, ":") || strings.HasPrefix(value, "//") {
+		return "", "", false
+	}
+	return key, value, true
+}
+
+// Token formats a token, replacing whitespace in the name, which would end
+// the token, with dashes
+func Token(prefix, name string) string {
+	return prefix + strings.Join(strings.Fields(name), "-")
+}
+
+// Escape prefixes a word of plain text with a backslash if it would
+// otherwise be read as a token, or if it starts with a backslash itself
+func Escape(word string) string {
+	_, project := Project(word)
+	_, context := Context(word)
+	_, _, keyValue := KeyValue(word)
+	if project || context || keyValue || strings.HasPrefix(word, `\`) {
+		return `\` + word
+	}
+	return word
+}
+
+// Unescape reports whether a word was escaped and returns it without the
+// backslash
+func Unescape(word string) (string, bool) {
+	if len(word) > 1 && word[0] == '\\' {
+		return word[1:], true
+	}
+	return word, false
+}
+
+// parseDate reads a date at the start of s
+func parseDate(s string) (time.Time, bool) {
+	word, _ := cut(s)
+	date, err := time.Parse(DateLayout, word)
+	return date, err == nil
+}
+
+func cut(s string) (string, string) {
+	word, rest, _ := strings.Cut(s, " ")
+	return word, strings.TrimLeft(rest, " ")
+}
+
+func skipWord(s string) string {
+	_, rest := cut(s)
+	return rest
+}
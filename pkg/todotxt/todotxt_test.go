@@ -0,0 +1,133 @@
+package todotxt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	task, err := Parse("x 2024-06-02 2024-06-01 Call mom +family @phone due:2024-06-05 pri:A")
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if !task.Completed || task.Priority != "" || task.Text != "Call mom +family @phone due:2024-06-05 pri:A" {
+		t.Fatalf("unexpected task: %+v", task)
+	}
+	if task.CompletionDate == nil || !task.CompletionDate.Equal(time.Date(2024, 6, 2, 0, 0, 0, 0, time.UTC)) ||
+		task.CreationDate == nil || task.CreationDate.Day() != 1 {
+		t.Fatalf("unexpected dates: %v %v", task.CompletionDate, task.CreationDate)
+	}
+	if fmt.Sprint(task.Projects()) != "[family]" || fmt.Sprint(task.Contexts()) != "[phone]" {
+		t.Fatalf("unexpected tokens: %v %v", task.Projects(), task.Contexts())
+	}
+	if due, ok := task.Value("due"); !ok || due != "2024-06-05" {
+		t.Fatalf("unexpected due value %q", due)
+	}
+
+	tests := []struct {
+		line     string
+		priority string
+		created  bool
+		text     string
+	}{
+		{"(A) 2024-06-01 Pay rent", "A", true, "Pay rent"},
+		{"(b) Lowercase is not a priority", "", false, "(b) Lowercase is not a priority"},
+		{"(A)->Not a priority either", "", false, "(A)->Not a priority either"},
+		{"2024-13-01 is not a date", "", false, "2024-13-01 is not a date"},
+		{"xylophone lessons", "", false, "xylophone lessons"},
+	}
+	for _, tt := range tests {
+		task, err := Parse(tt.line)
+		if err != nil || task.Completed || task.Priority != tt.priority || (task.CreationDate != nil) != tt.created || task.Text != tt.text {
+			t.Errorf("Parse(%q) = %+v, %v", tt.line, task, err)
+		}
+	}
+
+	for _, line := range []string{"", "x", "(A) 2024-06-01"} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("Parse(%q) expected an error", line)
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		word  string
+		key   string
+		value string
+		ok    bool
+	}{
+		{"due:2024-06-01", "due", "2024-06-01", true},
+		{"https://example.com", "", "", false},
+		{"time:10:30", "", "", false},
+		{"trailing:", "", "", false},
+		{":leading", "", "", false},
+	}
+	for _, tt := range tests {
+		key, value, ok := KeyValue(tt.word)
+		if key != tt.key || value != tt.value || ok != tt.ok {
+			t.Errorf("KeyValue(%q) = %q, %q, %v", tt.word, key, value, ok)
+		}
+	}
+	if _, ok := Project("+"); ok {
+		t.Error("a lone plus is not a project")
+	}
+	if got := Token("+", " Home  office "); got != "+Home-office" {
+		t.Errorf("Token = %q", got)
+	}
+
+	for word, want := range map[string]string{
+		"@bob": `\@bob`, "+launch": `\+launch`, "due:soon": `\due:soon`, `\n`: `\\n`,
+		"plain": "plain", "https://example.com": "https://example.com", "+": "+", `\`: `\\`,
+	} {
+		escaped := Escape(word)
+		if escaped != want {
+			t.Errorf("Escape(%q) = %q, want %q", word, escaped, want)
+		}
+		if got, _ := Unescape(escaped); got != word {
+			t.Errorf("Unescape(%q) = %q, want %q", escaped, got, word)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	file := strings.Join([]string{
+		"(A) 2024-06-01 Call mom +family @phone due:2024-06-05",
+		"x 2024-06-02 2024-05-30 Water plants @home",
+		"x 2024-06-03 Done without creation date",
+		"Plain task with a url https://example.com/a:b",
+		"(C) Spaces   inside the text are kept",
+		"",
+	}, "\n")
+	lines, err := Decode(strings.NewReader("\ufeff" + strings.Replace(file, "\n", "\n\n", 1)))
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(lines) != 5 || lines[1].Number != 3 {
+		t.Fatalf("unexpected lines: %+v", lines)
+	}
+	tasks := make([]Task, len(lines))
+	for i, line := range lines {
+		if line.Err != nil {
+			t.Fatalf("line %d: %v", line.Number, line.Err)
+		}
+		tasks[i] = line.Task
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, tasks); err != nil {
+		t.Fatalf("encode failed: %v", err)
+	}
+	if buf.String() != file {
+		t.Fatalf("round trip changed the file:\n%s\nwant:\n%s", buf.String(), file)
+	}
+
+	// Completed tasks only carry a creation date after a completion date
+	created := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	task := Task{Completed: true, Priority: "A", CreationDate: &created, Text: "Done"}
+	if got := task.String(); got != "x Done" {
+		t.Fatalf("unexpected line %q", got)
+	}
+}